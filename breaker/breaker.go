@@ -0,0 +1,288 @@
+// Package breaker provides circuit breaker as invoker.Interceptor,
+// failures are tracked for each function of each service, calls of
+// function whose circuit is open are rejected immediately.
+package breaker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/invoker"
+)
+
+// State of circuit
+type State int
+
+const (
+	// Closed circuit allow all calls
+	Closed State = iota
+	// Open circuit reject all calls until OpenTimeout passed
+	Open
+	// HalfOpen circuit allow limited probes, circuit is closed when
+	// all probes succeeded, and open again when any probe failed
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// key identify one function of service
+type key struct {
+	service  string
+	funcName string
+}
+
+func (k key) String() string {
+	return k.service + "." + k.funcName
+}
+
+// bucket of rolling window, n is the sequence number of its period
+type bucket struct {
+	n        int64
+	calls    int
+	failures int
+}
+
+// circuit of one function
+type circuit struct {
+	state State
+	// generation is increased for each state change, so the result
+	// of call allowed in the previous state is ignored
+	generation int64
+	openedAt   time.Time
+	buckets    []bucket
+	// in-flight and succeeded probes of half-open state
+	probes    int
+	successes int
+}
+
+// Breaker track failures of functions and decide whether call is allowed
+type Breaker struct {
+	opts Options
+	now  func() time.Time
+
+	sync.Mutex
+	circuits map[key]*circuit
+}
+
+// NewBreaker create circuit breaker with options
+func NewBreaker(opts ...Option) *Breaker {
+	return &Breaker{
+		opts:     newOptions(opts...),
+		now:      time.Now,
+		circuits: make(map[key]*circuit),
+	}
+}
+
+func (b *Breaker) circuit(k key) *circuit {
+	c, ok := b.circuits[k]
+	if !ok {
+		c = &circuit{buckets: make([]bucket, b.opts.Buckets)}
+		b.circuits[k] = c
+	}
+	return c
+}
+
+// setState change state of circuit and notify OnStateChange
+func (b *Breaker) setState(k key, c *circuit, s State, now time.Time) {
+	from := c.state
+	c.state = s
+	c.generation++
+	c.probes = 0
+	c.successes = 0
+	switch s {
+	case Open:
+		c.openedAt = now
+	case Closed:
+		for i := range c.buckets {
+			c.buckets[i] = bucket{}
+		}
+	}
+	if b.opts.OnStateChange != nil {
+		b.opts.OnStateChange(k.service, k.funcName, from, s)
+	}
+}
+
+// period get sequence number of bucket period of t
+func (b *Breaker) period(t time.Time) int64 {
+	width := int64(b.opts.Window) / int64(b.opts.Buckets)
+	if width <= 0 {
+		width = 1
+	}
+	return t.UnixNano() / width
+}
+
+// add result to rolling window, and return calls and failures in window
+func (b *Breaker) add(c *circuit, failure bool, now time.Time) (int, int) {
+	n := b.period(now)
+	bk := &c.buckets[int(n%int64(len(c.buckets)))]
+	if bk.n != n {
+		*bk = bucket{n: n}
+	}
+	bk.calls++
+	if failure {
+		bk.failures++
+	}
+
+	var calls, failures int
+	for _, bk := range c.buckets {
+		if bk.n > n-int64(len(c.buckets)) {
+			calls += bk.calls
+			failures += bk.failures
+		}
+	}
+	return calls, failures
+}
+
+// Allow judge whether call of funcName of service is allowed, error
+// with code CircuitOpen is returned if not, otherwise done must be
+// called with the result of call
+func (b *Breaker) Allow(service string, funcName string) (func(error), error) {
+	k := key{service: service, funcName: funcName}
+	now := b.now()
+
+	b.Lock()
+	defer b.Unlock()
+	c := b.circuit(k)
+	if c.state == Open && now.Sub(c.openedAt) >= b.opts.OpenTimeout {
+		b.setState(k, c, HalfOpen, now)
+	}
+	switch c.state {
+	case Open:
+		return nil, errors.Newf(errors.CircuitOpen, "circuit of %s is open", k)
+	case HalfOpen:
+		if c.probes >= b.opts.Probes {
+			return nil, errors.Newf(errors.CircuitOpen, "circuit of %s is half-open", k)
+		}
+		c.probes++
+	}
+
+	generation := c.generation
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			b.done(k, generation, b.opts.IsFailure(err))
+		})
+	}, nil
+}
+
+// done record the result of call allowed in generation
+func (b *Breaker) done(k key, generation int64, failure bool) {
+	now := b.now()
+
+	b.Lock()
+	defer b.Unlock()
+	c := b.circuit(k)
+	if c.generation != generation {
+		return
+	}
+	switch c.state {
+	case Closed:
+		calls, failures := b.add(c, failure, now)
+		if calls >= b.opts.MinRequests &&
+			float64(failures)/float64(calls) >= b.opts.ErrorRatio {
+			b.setState(k, c, Open, now)
+		}
+	case HalfOpen:
+		if failure {
+			b.setState(k, c, Open, now)
+			return
+		}
+		c.probes--
+		c.successes++
+		if c.successes >= b.opts.Probes {
+			b.setState(k, c, Closed, now)
+		}
+	}
+}
+
+// State get state of circuit of funcName of service
+func (b *Breaker) State(service string, funcName string) State {
+	k := key{service: service, funcName: funcName}
+	b.Lock()
+	defer b.Unlock()
+	c, ok := b.circuits[k]
+	if !ok {
+		return Closed
+	}
+	// open circuit is half-open after timeout even without call
+	if c.state == Open && b.now().Sub(c.openedAt) >= b.opts.OpenTimeout {
+		return HalfOpen
+	}
+	return c.state
+}
+
+// States get states of all tracked circuits, key is service.funcName
+func (b *Breaker) States() map[string]State {
+	b.Lock()
+	keys := make([]key, 0, len(b.circuits))
+	for k := range b.circuits {
+		keys = append(keys, k)
+	}
+	b.Unlock()
+
+	states := make(map[string]State, len(keys))
+	for _, k := range keys {
+		states[k.String()] = b.State(k.service, k.funcName)
+	}
+	return states
+}
+
+// Reset forget status of all functions of service, circuits are closed
+func (b *Breaker) Reset(service string) {
+	b.Lock()
+	defer b.Unlock()
+	for k := range b.circuits {
+		if k.service == service {
+			delete(b.circuits, k)
+		}
+	}
+}
+
+// result get error of call, which is the last out parameter
+func result(mo invoker.Message, err error) error {
+	if err != nil || mo == nil {
+		return err
+	}
+	params := mo.Parameters()
+	if len(params) == 0 {
+		return nil
+	}
+	err, _ = params[len(params)-1].(error)
+	return err
+}
+
+// Interceptor reject calls of function whose circuit is open,
+// name of service is got from invoker.ServiceNameAttachment, panic
+// of call is recorded as failure and panic again
+func (b *Breaker) Interceptor() invoker.Interceptor {
+	return func(fn invoker.InvokeFunc) invoker.InvokeFunc {
+		return func(ctx context.Context, mi invoker.Message,
+			opts ...invoker.InvokeOption) (mo invoker.Message, err error) {
+			service, _ := mi.Attachment(invoker.ServiceNameAttachment)
+			done, err := b.Allow(service, mi.FuncName())
+			if err != nil {
+				return nil, err
+			}
+			defer func() {
+				if p := recover(); p != nil {
+					done(errors.Newf(errors.Internal, "panic: %v", p))
+					panic(p)
+				}
+				done(result(mo, err))
+			}()
+			return fn(ctx, mi, opts...)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package breaker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/invoker"
+)
+
+var (
+	unavailable = errors.New(errors.Unavailable, "unavailable")
+	handler     = errors.New(errors.HandlerError, "handler")
+)
+
+func newTestBreaker(opts ...Option) (*Breaker, *time.Time) {
+	t := time.Unix(1000, 0)
+	b := NewBreaker(opts...)
+	b.now = func() time.Time {
+		return t
+	}
+	return b, &t
+}
+
+func call(b *Breaker, err error) error {
+	done, aerr := b.Allow("Hello", "SayHello")
+	if aerr != nil {
+		return aerr
+	}
+	done(err)
+	return nil
+}
+
+func TestBreaker_Allow(t *testing.T) {
+	b, now := newTestBreaker(ErrorRatio(0.5, 4), OpenTimeout(time.Second), Probes(2))
+	// handler error is not failure
+	for i := 0; i < 4; i++ {
+		call(b, handler)
+	}
+	if got := b.State("Hello", "SayHello"); got != Closed {
+		t.Errorf("State() = %v, want %v", got, Closed)
+	}
+	b.Reset("Hello")
+
+	call(b, nil)
+	call(b, nil)
+	call(b, unavailable)
+	if got := b.State("Hello", "SayHello"); got != Closed {
+		t.Errorf("State() = %v, want %v", got, Closed)
+	}
+	call(b, unavailable)
+	if got := b.State("Hello", "SayHello"); got != Open {
+		t.Errorf("State() = %v, want %v", got, Open)
+	}
+	if err := call(b, nil); !errors.Is(err, errors.CircuitOpen) {
+		t.Errorf("Allow() err = %v, want %v", err, errors.CircuitOpen)
+	}
+
+	// half-open allow limited probes
+	*now = now.Add(time.Second)
+	if got := b.State("Hello", "SayHello"); got != HalfOpen {
+		t.Errorf("State() = %v, want %v", got, HalfOpen)
+	}
+	done1, err1 := b.Allow("Hello", "SayHello")
+	done2, err2 := b.Allow("Hello", "SayHello")
+	_, err3 := b.Allow("Hello", "SayHello")
+	if err1 != nil || err2 != nil || !errors.Is(err3, errors.CircuitOpen) {
+		t.Errorf("Allow() err = %v %v %v, want two probes", err1, err2, err3)
+	}
+	done1(nil)
+	done2(unavailable)
+	if got := b.State("Hello", "SayHello"); got != Open {
+		t.Errorf("State() = %v, want %v", got, Open)
+	}
+
+	*now = now.Add(time.Second)
+	call(b, nil)
+	call(b, nil)
+	if got := b.State("Hello", "SayHello"); got != Closed {
+		t.Errorf("State() = %v, want %v", got, Closed)
+	}
+}
+
+func TestBreaker_Window(t *testing.T) {
+	b, now := newTestBreaker(Window(time.Second, 10), ErrorRatio(0.5, 2))
+	call(b, unavailable)
+	// the failure is out of window
+	*now = now.Add(time.Second)
+	call(b, nil)
+	call(b, nil)
+	call(b, unavailable)
+	if got := b.State("Hello", "SayHello"); got != Closed {
+		t.Errorf("State() = %v, want %v", got, Closed)
+	}
+	*now = now.Add(100 * time.Millisecond)
+	call(b, unavailable)
+	if got := b.State("Hello", "SayHello"); got != Open {
+		t.Errorf("State() = %v, want %v", got, Open)
+	}
+}
+
+func TestBreaker_Interceptor(t *testing.T) {
+	var changes []State
+	b, _ := newTestBreaker(ErrorRatio(0.5, 1), OnStateChange(func(service, funcName string, from, to State) {
+		changes = append(changes, to)
+	}))
+	var calls int
+	fn := b.Interceptor()(func(ctx context.Context, mi invoker.Message,
+		opts ...invoker.InvokeOption) (invoker.Message, error) {
+		calls++
+		mo := invoker.NewMessage()
+		mo.SetParameters([]interface{}{unavailable})
+		return mo, nil
+	})
+	mi := invoker.NewMessage()
+	mi.SetFuncName("SayHello")
+	mi.SetAttachment(invoker.ServiceNameAttachment, "Hello")
+	for i := 0; i < 3; i++ {
+		fn(context.Background(), mi)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %v, want %v", calls, 1)
+	}
+	if _, err := fn(context.Background(), mi); !errors.Is(err, errors.CircuitOpen) {
+		t.Errorf("Invoke() err = %v, want %v", err, errors.CircuitOpen)
+	}
+	if got := b.States(); got["Hello.SayHello"] != Open {
+		t.Errorf("States() = %v, want %v", got, Open)
+	}
+	if len(changes) != 1 || changes[0] != Open {
+		t.Errorf("OnStateChange() = %v, want %v", changes, []State{Open})
+	}
+}
+
+func TestBreaker_InterceptorPanic(t *testing.T) {
+	b, _ := newTestBreaker(ErrorRatio(0.5, 1))
+	fn := b.Interceptor()(func(ctx context.Context, mi invoker.Message,
+		opts ...invoker.InvokeOption) (invoker.Message, error) {
+		panic("boom")
+	})
+	mi := invoker.NewMessage()
+	mi.SetFuncName("SayHello")
+	mi.SetAttachment(invoker.ServiceNameAttachment, "Hello")
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("recover() = %v, want %v", p, "boom")
+			}
+		}()
+		fn(context.Background(), mi)
+	}()
+	if got := b.State("Hello", "SayHello"); got != Open {
+		t.Errorf("State() = %v, want %v", got, Open)
+	}
+}
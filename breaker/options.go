@@ -0,0 +1,97 @@
+package breaker
+
+import (
+	"time"
+
+	"github.com/haormj/dodo/errors"
+)
+
+type Options struct {
+	// Window is the length of rolling window, which is divided
+	// into Buckets, old bucket is dropped as a whole
+	Window  time.Duration
+	Buckets int
+	// ErrorRatio open circuit when failure ratio in window reach it,
+	// and there are at least MinRequests calls
+	ErrorRatio  float64
+	MinRequests int
+	// OpenTimeout is the time of open state before half-open
+	OpenTimeout time.Duration
+	// Probes is the max in-flight calls in half-open state, and
+	// circuit is closed after Probes calls succeeded
+	Probes int
+	// IsFailure judge whether error of call is failure, error
+	// returned by handler is not failure by default
+	IsFailure func(error) bool
+	// OnStateChange is called when state of circuit changed,
+	// it is called with lock held, so it should be fast
+	OnStateChange func(service, funcName string, from, to State)
+}
+
+type Option func(*Options)
+
+func newOptions(opts ...Option) Options {
+	options := Options{
+		Window:      10 * time.Second,
+		Buckets:     10,
+		ErrorRatio:  0.5,
+		MinRequests: 20,
+		OpenTimeout: 5 * time.Second,
+		Probes:      1,
+		IsFailure:   errors.IsFailure,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.Buckets <= 0 {
+		options.Buckets = 1
+	}
+	if options.Probes <= 0 {
+		options.Probes = 1
+	}
+	return options
+}
+
+// Window sets the length and buckets of rolling window
+func Window(d time.Duration, buckets int) Option {
+	return func(o *Options) {
+		o.Window = d
+		o.Buckets = buckets
+	}
+}
+
+// ErrorRatio sets the failure ratio and min calls to open circuit
+func ErrorRatio(ratio float64, minRequests int) Option {
+	return func(o *Options) {
+		o.ErrorRatio = ratio
+		o.MinRequests = minRequests
+	}
+}
+
+// OpenTimeout sets the time of open state before half-open
+func OpenTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.OpenTimeout = d
+	}
+}
+
+// Probes sets the max probes of half-open state
+func Probes(n int) Option {
+	return func(o *Options) {
+		o.Probes = n
+	}
+}
+
+// Failure sets the judgement of failure
+func Failure(f func(error) bool) Option {
+	return func(o *Options) {
+		o.IsFailure = f
+	}
+}
+
+// OnStateChange sets the callback of state change, e.g. for metrics
+func OnStateChange(f func(service, funcName string, from, to State)) Option {
+	return func(o *Options) {
+		o.OnStateChange = f
+	}
+}
@@ -14,9 +14,25 @@ type Client interface {
 	Options() Options
 	Call(ctx context.Context, address string, serviceName string, funcName string,
 		req interface{}, rsp interface{}, opts ...CallOption) error
+	Stream(ctx context.Context, address string, serviceName string, funcName string,
+		opts ...CallOption) (Stream, error)
 	String() string
 }
 
+// Stream is a bidirectional stream of one streaming call, for server
+// streaming, Send the request and CloseSend, then Recv until io.EOF.
+// Stream is closed when ctx is done, Close should be called if the
+// stream is not received until the end.
+type Stream interface {
+	Context() context.Context
+	Send(interface{}) error
+	// Recv return io.EOF when server has no more message
+	Recv(interface{}) error
+	// CloseSend tell server there is no more message
+	CloseSend() error
+	Close() error
+}
+
 // Option used by the Client
 type Option func(*Options)
 
@@ -6,13 +6,19 @@ import (
 	"time"
 
 	"github.com/haormj/dodo/codec"
+	"github.com/haormj/dodo/compressor"
 	"github.com/haormj/dodo/transport"
 )
 
 type Options struct {
 	Transport transport.Transport
 	Codecs    []codec.Codec
-	// Connection Pool
+	// Compressors used to compress body, body smaller than
+	// CompressThreshold will not be compressed
+	Compressors       []compressor.Compressor
+	CompressThreshold int
+	// Connection Pool, requests are multiplexed on
+	// at most PoolSize connections for each address
 	PoolSize int
 	PoolTTL  time.Duration
 	// Other options for implementations of the interface
@@ -23,6 +29,9 @@ type Options struct {
 type CallOptions struct {
 	Codec     string
 	TLSConfig *tls.Config
+	// Compressor used to compress request and response,
+	// empty means not compress
+	Compressor string
 	// Other options for implementations of the interface
 	// can be stored in a context
 	Context context.Context
@@ -41,6 +50,19 @@ func Codec(c codec.Codec) Option {
 	}
 }
 
+func Compressor(c compressor.Compressor) Option {
+	return func(o *Options) {
+		o.Compressors = append(o.Compressors, c)
+	}
+}
+
+// CompressThreshold sets the min body size to compress
+func CompressThreshold(n int) Option {
+	return func(o *Options) {
+		o.CompressThreshold = n
+	}
+}
+
 // PoolSize sets the connection pool size
 func PoolSize(d int) Option {
 	return func(o *Options) {
@@ -61,6 +83,12 @@ func WithCodec(c string) CallOption {
 	}
 }
 
+func WithCompressor(c string) CallOption {
+	return func(o *CallOptions) {
+		o.Compressor = c
+	}
+}
+
 func WithTLSConfig(t *tls.Config) CallOption {
 	return func(o *CallOptions) {
 		o.TLSConfig = t
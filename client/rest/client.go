@@ -0,0 +1,213 @@
+// Package rest implement client by http, it call rest server
+// by POST /{ServiceName}/{FuncName}
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haormj/dodo/client"
+	"github.com/haormj/dodo/codec"
+	"github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/metadata"
+)
+
+// maxClients is the max number of http clients cached by tls config,
+// one of them is closed when caller use too many configs
+const maxClients = 16
+
+type Client struct {
+	sync.RWMutex
+	opts   client.Options
+	codecs map[string]codec.Codec
+	// http client for each tls config, nil key is plain http
+	clients map[*tls.Config]*http.Client
+}
+
+func NewClient(opts ...client.Option) client.Client {
+	options := newOptions(opts...)
+
+	c := &Client{
+		opts:    options,
+		codecs:  make(map[string]codec.Codec),
+		clients: make(map[*tls.Config]*http.Client),
+	}
+
+	return c
+}
+
+func (c *Client) Init(opts ...client.Option) error {
+	c.Lock()
+	for _, o := range opts {
+		o(&c.opts)
+	}
+	for _, cdc := range c.opts.Codecs {
+		c.codecs[cdc.String()] = cdc
+	}
+	c.Unlock()
+
+	return nil
+}
+
+func (c *Client) Options() client.Options {
+	c.RLock()
+	opts := c.opts
+	c.RUnlock()
+	return opts
+}
+
+// getClient get http client by tls config, http client will be reused
+func (c *Client) getClient(config *tls.Config) *http.Client {
+	c.RLock()
+	hc, ok := c.clients[config]
+	c.RUnlock()
+	if ok {
+		return hc
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if hc, ok := c.clients[config]; ok {
+		return hc
+	}
+	if len(c.clients) >= maxClients {
+		for k, v := range c.clients {
+			v.CloseIdleConnections()
+			delete(c.clients, k)
+			break
+		}
+	}
+	hc = &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSClientConfig:     config,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConnsPerHost: c.opts.PoolSize,
+			IdleConnTimeout:     c.opts.PoolTTL,
+		},
+	}
+	c.clients[config] = hc
+	return hc
+}
+
+func (c *Client) Call(ctx context.Context, address string, serviceName string, funcName string,
+	req interface{}, rsp interface{}, opts ...client.CallOption) error {
+	callOptions := client.CallOptions{
+		Codec: "json",
+	}
+	for _, o := range opts {
+		o(&callOptions)
+	}
+
+	c.RLock()
+	cdc, ok := c.codecs[callOptions.Codec]
+	c.RUnlock()
+	if !ok {
+		return errors.New(errors.CodecNotFound, "not find codec "+callOptions.Codec)
+	}
+
+	reqBytes, err := cdc.Marshal(req)
+	if err != nil {
+		return errors.New(errors.EncodeError, err.Error())
+	}
+
+	scheme := "http"
+	if callOptions.TLSConfig != nil {
+		scheme = "https"
+	}
+	u := fmt.Sprintf("%s://%s/%s/%s", scheme, address, serviceName, funcName)
+	hreq, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(reqBytes))
+	if err != nil {
+		return err
+	}
+	hreq = hreq.WithContext(ctx)
+	hreq.Header.Set("Content-Type", contentType(callOptions.Codec))
+	// keys of metadata are url encoded in one header, so they are not
+	// canonicalized as header names
+	if md, ok := metadata.FromContext(ctx); ok && len(md) > 0 {
+		values := make(url.Values, len(md))
+		for k, v := range md {
+			values.Set(k, v)
+		}
+		hreq.Header.Set(metadataHeader, values.Encode())
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		hreq.Header.Set(timeoutHeader, time.Until(deadline).String())
+	}
+
+	hrsp, err := c.getClient(callOptions.TLSConfig).Do(hreq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return errors.New(errors.Unavailable, err.Error())
+	}
+	defer hrsp.Body.Close()
+
+	rspBytes, err := ioutil.ReadAll(hrsp.Body)
+	if err != nil {
+		return errors.New(errors.Unavailable, err.Error())
+	}
+
+	if hrsp.StatusCode == http.StatusGatewayTimeout {
+		return context.DeadlineExceeded
+	}
+	if hrsp.StatusCode < http.StatusOK || hrsp.StatusCode >= http.StatusMultipleChoices {
+		s := hrsp.Header.Get("Error")
+		if len(s) == 0 {
+			s = strings.TrimSpace(string(rspBytes))
+		}
+		if len(s) == 0 {
+			s = hrsp.Status
+		}
+		return parseError(hrsp.Header, s)
+	}
+
+	if err := cdc.Unmarshal(rspBytes, rsp); err != nil {
+		return errors.New(errors.DecodeError, err.Error())
+	}
+	return nil
+}
+
+// Stream is not supported by http
+func (c *Client) Stream(ctx context.Context, address string, serviceName string, funcName string,
+	opts ...client.CallOption) (client.Stream, error) {
+	return nil, errors.New(errors.Unimplemented, "stream is not supported by rest client")
+}
+
+func (c *Client) String() string {
+	return "rest"
+}
+
+// parseError get error from Error-Code and url encoded Error-Details header,
+// response without code is HandlerError
+func parseError(h http.Header, msg string) *errors.Error {
+	e := errors.New(errors.HandlerError, msg)
+	if c := h.Get(errorCodeHeader); len(c) != 0 {
+		code, err := strconv.Atoi(c)
+		if err != nil {
+			e.Code = errors.Unknown
+		} else {
+			e.Code = errors.ErrorCode(code)
+		}
+	}
+	values, _ := url.ParseQuery(h.Get(errorDetailsHeader))
+	for k, v := range values {
+		e.WithDetail(k, v[0])
+	}
+	return e
+}
@@ -0,0 +1,121 @@
+package rest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	derrors "github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/invoker/receiver"
+	"github.com/haormj/dodo/metadata"
+	"github.com/haormj/dodo/server/rest"
+)
+
+type Hello struct{}
+
+func (*Hello) SayHello(ctx context.Context, req string, rsp *string) error {
+	md, _ := metadata.FromContext(ctx)
+	*rsp = req + " dodo" + md["NodeID"]
+	return nil
+}
+
+func (*Hello) SayDeadline(ctx context.Context, req string, rsp *string) error {
+	if _, ok := ctx.Deadline(); !ok {
+		return errors.New("no deadline")
+	}
+	return nil
+}
+
+func (*Hello) SayError(ctx context.Context, req string, rsp *string) error {
+	return errors.New("say error")
+}
+
+func (*Hello) SayCodeError(ctx context.Context, req string, rsp *string) error {
+	return derrors.New(derrors.Unavailable, "say code error").
+		WithDetail("retry_after", "1s").WithDetail("userID", "42")
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	inv := receiver.NewInvoker(new(Hello))
+	if err := inv.Init(); err != nil {
+		t.Fatal(err)
+	}
+	s := rest.NewServer()
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register(inv); err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(s.(http.Handler))
+}
+
+func TestClient_Call(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	address := strings.TrimPrefix(ts.URL, "http://")
+
+	c := NewClient()
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := metadata.NewContext(context.Background(), metadata.Metadata{"NodeID": "1"})
+	var rsp string
+	if err := c.Call(ctx, address, "Hello", "SayHello", "hello", &rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp != "hello dodo1" {
+		t.Errorf("Call() rsp = %v, want %v", rsp, "hello dodo1")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.Call(ctx, address, "Hello", "SayDeadline", "hello", &rsp); err != nil {
+		t.Error(err)
+	}
+
+	err := c.Call(context.Background(), address, "Hello", "SayError", "hello", &rsp)
+	if err == nil || err.Error() != "say error" {
+		t.Errorf("Call() err = %v, want %v", err, "say error")
+	}
+	if got := derrors.Code(err); got != derrors.HandlerError {
+		t.Errorf("Code() = %v, want %v", got, derrors.HandlerError)
+	}
+
+	// keys of details keep their case
+	err = c.Call(context.Background(), address, "Hello", "SayCodeError", "hello", &rsp)
+	if got := derrors.Code(err); got != derrors.Unavailable {
+		t.Errorf("Code() = %v, want %v", got, derrors.Unavailable)
+	}
+	want := map[string]string{"retry_after": "1s", "userID": "42"}
+	if e, ok := err.(*derrors.Error); !ok || !reflect.DeepEqual(e.Details, want) {
+		t.Errorf("Call() err = %#v, want details %v", err, want)
+	}
+
+	err = c.Call(context.Background(), address, "World", "SayHello", "hello", &rsp)
+	if got := derrors.Code(err); got != derrors.ServiceNotFound {
+		t.Errorf("Code() = %v, want %v", got, derrors.ServiceNotFound)
+	}
+}
+
+func TestClient_getClient(t *testing.T) {
+	c := NewClient().(*Client)
+	config := &tls.Config{InsecureSkipVerify: true}
+	if c.getClient(config) != c.getClient(config) {
+		t.Error("getClient() is not reused for the same config")
+	}
+	// http clients are limited when config is created for each call
+	for i := 0; i < maxClients*2; i++ {
+		c.getClient(&tls.Config{InsecureSkipVerify: true})
+	}
+	if got := len(c.clients); got > maxClients {
+		t.Errorf("len(clients) = %v, want <= %v", got, maxClients)
+	}
+}
@@ -0,0 +1,13 @@
+package rest
+
+const (
+	metadataHeader     = "Metadata"
+	timeoutHeader      = "Timeout"
+	errorCodeHeader    = "Error-Code"
+	errorDetailsHeader = "Error-Details"
+)
+
+// contentType get content type from codec name
+func contentType(codecName string) string {
+	return "application/" + codecName
+}
@@ -2,29 +2,33 @@ package rpc
 
 import (
 	"context"
-	"errors"
 	"sync"
+	"time"
 
 	"github.com/haormj/dodo/client"
 	"github.com/haormj/dodo/codec"
+	"github.com/haormj/dodo/compressor"
+	"github.com/haormj/dodo/errors"
 	"github.com/haormj/dodo/metadata"
 	"github.com/haormj/dodo/transport"
 )
 
 type Client struct {
 	sync.RWMutex
-	opts   client.Options
-	pool   *pool
-	codecs map[string]codec.Codec
+	opts        client.Options
+	pool        *pool
+	codecs      map[string]codec.Codec
+	compressors map[string]compressor.Compressor
 }
 
 func NewClient(opts ...client.Option) client.Client {
 	options := newOptions(opts...)
 
 	c := &Client{
-		opts:   options,
-		pool:   newPool(options.PoolSize, options.PoolTTL),
-		codecs: make(map[string]codec.Codec),
+		opts:        options,
+		pool:        newPool(options.PoolSize, options.PoolTTL),
+		codecs:      make(map[string]codec.Codec),
+		compressors: make(map[string]compressor.Compressor),
 	}
 
 	return c
@@ -41,6 +45,10 @@ func (c *Client) Init(opts ...client.Option) error {
 		c.codecs[cdc.String()] = cdc
 	}
 
+	for _, cps := range c.opts.Compressors {
+		c.compressors[cps.String()] = cps
+	}
+
 	return nil
 }
 
@@ -60,16 +68,19 @@ func (c *Client) Call(ctx context.Context, address string, serviceName string, f
 		o(&callOptions)
 	}
 
+	// caller has given up
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	cdc, ok := c.codecs[callOptions.Codec]
 	if !ok {
-		// TODO better handle error
-		s := "not find codec " + callOptions.Codec
-		return errors.New(s)
+		return errors.New(errors.CodecNotFound, "not find codec "+callOptions.Codec)
 	}
 
 	reqBytes, err := cdc.Marshal(req)
 	if err != nil {
-		return err
+		return errors.New(errors.EncodeError, err.Error())
 	}
 	md, _ := metadata.FromContext(ctx)
 	pi := protocol{
@@ -81,38 +92,146 @@ func (c *Client) Call(ctx context.Context, address string, serviceName string, f
 		},
 		Body: reqBytes,
 	}
+	// compress request body when it is large enough,
+	// and tell server response can be compressed
+	if len(callOptions.Compressor) != 0 {
+		cps, ok := c.compressors[callOptions.Compressor]
+		if !ok {
+			return errors.New(errors.CompressorNotFound, "not find compressor "+callOptions.Compressor)
+		}
+		pi.header.AcceptCompress = callOptions.Compressor
+		if len(reqBytes) >= c.opts.CompressThreshold {
+			b, err := cps.Compress(reqBytes)
+			if err != nil {
+				return errors.New(errors.EncodeError, err.Error())
+			}
+			pi.Body = b
+			pi.header.Compress = callOptions.Compressor
+		}
+	}
+	conn, timeout, err := c.dial(ctx, address, callOptions)
+	if err != nil {
+		return err
+	}
+	pi.header.Timeout = timeout
+	mi := format(pi)
+	mo, err := conn.call(ctx, &mi)
+	if err != nil {
+		// context error is returned as it is
+		if err == ctx.Err() {
+			return err
+		}
+		return errors.FromError(err, errors.Unavailable)
+	}
+	po := parse(mo)
+	if po.header.Error != nil {
+		// same as the deadline exceeded of client
+		if po.header.Error.Code == errors.DeadlineExceeded {
+			return context.DeadlineExceeded
+		}
+		return po.header.Error
+	}
+	if len(po.header.Compress) != 0 {
+		cps, ok := c.compressors[po.header.Compress]
+		if !ok {
+			return errors.New(errors.CompressorNotFound, "not find compressor "+po.header.Compress)
+		}
+		b, err := cps.Decompress(po.Body)
+		if err != nil {
+			return errors.New(errors.DecodeError, err.Error())
+		}
+		po.Body = b
+	}
+	if err := cdc.Unmarshal(po.Body, rsp); err != nil {
+		return errors.New(errors.DecodeError, err.Error())
+	}
+	return nil
+}
+
+// dial get connection of address, timeout is the remaining time of ctx,
+// which should be sent to server, zero means no deadline
+func (c *Client) dial(ctx context.Context, address string,
+	callOptions client.CallOptions) (*poolConn, time.Duration, error) {
 	// transport dail option
 	var topts []transport.DialOption
 	if callOptions.TLSConfig != nil {
 		topts = append(topts, transport.WithDailTLSConfig(callOptions.TLSConfig))
 	}
+	// tell server the remaining time, and dial no longer than it
+	var timeout time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+		if timeout <= 0 {
+			return nil, 0, context.DeadlineExceeded
+		}
+		if timeout < transport.DefaultDialTimeout {
+			topts = append(topts, transport.WithTimeout(timeout))
+		}
+	}
 
 	conn, err := c.pool.getConn(address, c.opts.Transport, topts...)
 	if err != nil {
-		return err
+		return nil, 0, errors.New(errors.Unavailable, err.Error())
 	}
-	var cerr error
-	defer func() {
-		c.pool.release(address, conn, cerr)
-	}()
-	mi := format(pi)
-	if err := conn.Send(&mi); err != nil {
-		cerr = err
-		return err
+	return conn, timeout, nil
+}
+
+// Stream open a stream to the streaming function, every message
+// is sent as one frame on the multiplexed connection
+func (c *Client) Stream(ctx context.Context, address string, serviceName string, funcName string,
+	opts ...client.CallOption) (client.Stream, error) {
+	callOptions := client.CallOptions{
+		Codec: "json",
 	}
-	var mo transport.Message
-	if err := conn.Recv(&mo); err != nil {
-		cerr = err
-		return err
+	for _, o := range opts {
+		o(&callOptions)
 	}
-	po := parse(mo)
-	if len(po.header.Error) != 0 {
-		return errors.New(po.header.Error)
+
+	// caller has given up
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	if err := cdc.Unmarshal(po.Body, rsp); err != nil {
-		return err
+
+	cdc, ok := c.codecs[callOptions.Codec]
+	if !ok {
+		return nil, errors.New(errors.CodecNotFound, "not find codec "+callOptions.Codec)
 	}
-	return nil
+	md, _ := metadata.FromContext(ctx)
+	pi := protocol{
+		header: header{
+			ServiceName: serviceName,
+			FuncName:    funcName,
+			Codec:       callOptions.Codec,
+			Metadata:    md,
+			Stream:      true,
+		},
+	}
+	var cps compressor.Compressor
+	if len(callOptions.Compressor) != 0 {
+		cps, ok = c.compressors[callOptions.Compressor]
+		if !ok {
+			return nil, errors.New(errors.CompressorNotFound, "not find compressor "+callOptions.Compressor)
+		}
+		pi.header.AcceptCompress = callOptions.Compressor
+	}
+
+	conn, timeout, err := c.dial(ctx, address, callOptions)
+	if err != nil {
+		return nil, err
+	}
+	pi.header.Timeout = timeout
+	mi := format(pi)
+	id, q, err := conn.stream(&mi)
+	if err != nil {
+		return nil, errors.FromError(err, errors.Unavailable)
+	}
+
+	s := newStream(ctx, conn, id, q, pi.header)
+	s.codec = cdc
+	s.compressor = cps
+	s.compressors = c.compressors
+	s.threshold = c.opts.CompressThreshold
+	return s, nil
 }
 
 func (c *Client) String() string {
@@ -0,0 +1,529 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/haormj/dodo/client"
+	"github.com/haormj/dodo/compressor/gzip"
+	"github.com/haormj/dodo/compressor/snappy"
+	derrors "github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/internal/queue"
+	"github.com/haormj/dodo/invoker"
+	"github.com/haormj/dodo/invoker/receiver"
+	"github.com/haormj/dodo/log"
+	"github.com/haormj/dodo/ratelimit"
+	"github.com/haormj/dodo/server"
+	"github.com/haormj/dodo/server/rpc"
+	"github.com/haormj/dodo/transport"
+	"github.com/haormj/dodo/transport/grpc"
+	"github.com/haormj/dodo/transport/tcp"
+)
+
+type Hello struct{}
+
+func (*Hello) SayHello(ctx context.Context, req string, rsp *string) error {
+	*rsp = req + " dodo"
+	return nil
+}
+
+func (*Hello) SaySleep(ctx context.Context, req time.Duration, rsp *time.Duration) error {
+	time.Sleep(req)
+	*rsp = req
+	return nil
+}
+
+func (*Hello) SayDeadline(ctx context.Context, req string, rsp *string) error {
+	if _, ok := ctx.Deadline(); !ok {
+		return errors.New("no deadline")
+	}
+	return nil
+}
+
+// canceled receive the request canceled by client
+var canceled = make(chan string, 1)
+
+func (*Hello) SayWait(ctx context.Context, req string, rsp *string) error {
+	<-ctx.Done()
+	canceled <- req
+	return ctx.Err()
+}
+
+func (*Hello) SayError(ctx context.Context, req string, rsp *string) error {
+	return errors.New("say error")
+}
+
+func (*Hello) SayCodeError(ctx context.Context, req string, rsp *string) error {
+	return derrors.New(derrors.Unavailable, "say code error").WithDetail("reason", "busy")
+}
+
+// SayStream send n messages to client
+func (*Hello) SayStream(ctx context.Context, n int, stream invoker.Stream) error {
+	for i := 0; i < n; i++ {
+		if err := stream.Send(fmt.Sprintf("hello %d", i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SayEcho send back every message of client
+func (*Hello) SayEcho(ctx context.Context, stream invoker.Stream) error {
+	for {
+		var req string
+		if err := stream.Recv(&req); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if req == "error" {
+			return errors.New("say error")
+		}
+		if err := stream.Send(req + " dodo"); err != nil {
+			return err
+		}
+	}
+}
+
+func newTestServer(t *testing.T, address string, opts ...server.Option) server.Server {
+	log.SetDummyLogger()
+	inv := receiver.NewInvoker(new(Hello))
+	if err := inv.Init(); err != nil {
+		t.Fatal(err)
+	}
+	opts = append([]server.Option{server.Transport(tcp.NewTransport())}, opts...)
+	opts = append(opts, server.Address(address))
+	s := rpc.NewServer(opts...)
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register(inv); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newTestClient(t *testing.T, opts ...client.Option) client.Client {
+	opts = append([]client.Option{client.Transport(tcp.NewTransport())}, opts...)
+	c := NewClient(opts...)
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClient_Call(t *testing.T) {
+	address := "127.0.0.1:27312"
+	s := newTestServer(t, address)
+	defer s.Stop()
+	c := newTestClient(t)
+
+	var rsp string
+	if err := c.Call(context.Background(), address, "Hello", "SayHello", "hello", &rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp != "hello dodo" {
+		t.Errorf("Call() rsp = %v, want %v", rsp, "hello dodo")
+	}
+
+	err := c.Call(context.Background(), address, "Hello", "SayError", "hello", &rsp)
+	if err == nil || err.Error() != "say error" {
+		t.Errorf("Call() err = %v, want %v", err, "say error")
+	}
+}
+
+func TestClient_CallErrorCode(t *testing.T) {
+	address := "127.0.0.1:27318"
+	s := newTestServer(t, address)
+	defer s.Stop()
+	c := newTestClient(t)
+
+	tests := []struct {
+		name        string
+		serviceName string
+		funcName    string
+		opts        []client.CallOption
+		want        derrors.ErrorCode
+	}{
+		{"handler", "Hello", "SayError", nil, derrors.HandlerError},
+		{"coded handler", "Hello", "SayCodeError", nil, derrors.Unavailable},
+		{"service", "World", "SayHello", nil, derrors.ServiceNotFound},
+		{"func", "Hello", "SayWorld", nil, derrors.FuncNotFound},
+		{"codec", "Hello", "SayHello", []client.CallOption{client.WithCodec("unknown")}, derrors.CodecNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rsp string
+			err := c.Call(context.Background(), address, tt.serviceName, tt.funcName, "hello", &rsp, tt.opts...)
+			if got := derrors.Code(err); got != tt.want {
+				t.Errorf("Code() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var rsp string
+	err := c.Call(context.Background(), address, "Hello", "SayCodeError", "hello", &rsp)
+	e, ok := err.(*derrors.Error)
+	if !ok || e.Details["reason"] != "busy" {
+		t.Errorf("Call() err = %#v, want detail reason=busy", err)
+	}
+}
+
+func TestClient_CallRateLimit(t *testing.T) {
+	address := "127.0.0.1:27322"
+	limiter := ratelimit.NewLimiter(ratelimit.Rules{
+		"Hello.SayHello": {Rate: 0.001, Burst: 1},
+	})
+	s := newTestServer(t, address, server.Intercept(limiter.Interceptor()))
+	defer s.Stop()
+	c := newTestClient(t)
+
+	var rsp string
+	if err := c.Call(context.Background(), address, "Hello", "SayHello", "hello", &rsp); err != nil {
+		t.Errorf("Call() err = %v, want %v", err, nil)
+	}
+	err := c.Call(context.Background(), address, "Hello", "SayHello", "hello", &rsp)
+	if got := derrors.Code(err); got != derrors.ResourceExhausted {
+		t.Errorf("Code() = %v, want %v", got, derrors.ResourceExhausted)
+	}
+	// other funcs are not limited
+	var d time.Duration
+	if err := c.Call(context.Background(), address, "Hello", "SaySleep", time.Duration(0), &d); err != nil {
+		t.Errorf("Call() err = %v, want %v", err, nil)
+	}
+}
+
+func TestClient_CallOverloaded(t *testing.T) {
+	address := "127.0.0.1:27323"
+	limiter := ratelimit.NewAdaptiveLimiter(ratelimit.Limits(1, 1, 1))
+	s := newTestServer(t, address, server.Intercept(limiter.Interceptor()))
+	defer s.Stop()
+	c := newTestClient(t)
+
+	result := make(chan error)
+	go func() {
+		var d time.Duration
+		result <- c.Call(context.Background(), address, "Hello", "SaySleep", 200*time.Millisecond, &d)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	var rsp string
+	err := c.Call(context.Background(), address, "Hello", "SayHello", "hello", &rsp)
+	if got := derrors.Code(err); got != derrors.Overloaded {
+		t.Errorf("Code() = %v, want %v", got, derrors.Overloaded)
+	}
+	if err := <-result; err != nil {
+		t.Errorf("Call() err = %v, want %v", err, nil)
+	}
+	if stats := limiter.Stats(); stats.Accepted != 1 || stats.Rejected != 1 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestClient_CallCompress(t *testing.T) {
+	address := "127.0.0.1:27313"
+	s := newTestServer(t, address,
+		server.Compressor(gzip.NewCompressor()),
+		server.CompressThreshold(16),
+	)
+	defer s.Stop()
+	c := newTestClient(t,
+		client.Compressor(gzip.NewCompressor()),
+		client.Compressor(snappy.NewCompressor()),
+		client.CompressThreshold(16),
+	)
+
+	for _, req := range []string{"hello", strings.Repeat("hello", 100)} {
+		var rsp string
+		if err := c.Call(context.Background(), address, "Hello", "SayHello", req, &rsp,
+			client.WithCompressor("gzip")); err != nil {
+			t.Fatal(err)
+		}
+		if rsp != req+" dodo" {
+			t.Errorf("Call() rsp = %v, want %v", rsp, req+" dodo")
+		}
+	}
+
+	// server not support snappy
+	var rsp string
+	req := strings.Repeat("hello", 100)
+	if err := c.Call(context.Background(), address, "Hello", "SayHello", req, &rsp,
+		client.WithCompressor("snappy")); err == nil {
+		t.Error("Call() err = nil, want not find compressor")
+	}
+
+	if err := c.Call(context.Background(), address, "Hello", "SayHello", req, &rsp,
+		client.WithCompressor("zstd")); err == nil {
+		t.Error("Call() err = nil, want not find compressor")
+	}
+}
+
+func TestClient_CallMultiplex(t *testing.T) {
+	tests := []struct {
+		name      string
+		address   string
+		transport func(...transport.Option) transport.Transport
+	}{
+		{
+			name:      "tcp",
+			address:   "127.0.0.1:27314",
+			transport: tcp.NewTransport,
+		},
+		{
+			name:      "grpc",
+			address:   "127.0.0.1:27315",
+			transport: grpc.NewTransport,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address := tt.address
+			s := newTestServer(t, address, server.Transport(tt.transport()))
+			defer s.Stop()
+			c := newTestClient(t, client.Transport(tt.transport()), client.PoolSize(1))
+
+			// slow call will not block others on the same connection
+			start := time.Now()
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					req := time.Duration(i) * 20 * time.Millisecond
+					var rsp time.Duration
+					if err := c.Call(context.Background(), address, "Hello", "SaySleep", req, &rsp); err != nil {
+						t.Error(err)
+						return
+					}
+					if rsp != req {
+						t.Errorf("Call() rsp = %v, want %v", rsp, req)
+					}
+				}(i)
+			}
+			wg.Wait()
+			if d := time.Since(start); d > 500*time.Millisecond {
+				t.Errorf("Call() cost %v, want concurrent", d)
+			}
+
+			cc := c.(*Client)
+			cc.pool.Lock()
+			n := len(cc.pool.conns[address])
+			cc.pool.Unlock()
+			if n != 1 {
+				t.Errorf("pool conns = %d, want 1", n)
+			}
+		})
+	}
+}
+
+func TestClient_CallDeadline(t *testing.T) {
+	address := "127.0.0.1:27316"
+	s := newTestServer(t, address)
+	defer s.Stop()
+	c := newTestClient(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var rsp string
+	if err := c.Call(ctx, address, "Hello", "SayDeadline", "hello", &rsp); err != nil {
+		t.Error(err)
+	}
+
+	// client will not wait for slow server
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	var d time.Duration
+	err := c.Call(ctx, address, "Hello", "SaySleep", time.Second, &d)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Call() err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if cost := time.Since(start); cost > 500*time.Millisecond {
+		t.Errorf("Call() cost %v, want about 50ms", cost)
+	}
+
+	// deadline exceeded before call
+	if err := c.Call(ctx, address, "Hello", "SayHello", "hello", &rsp); err != context.DeadlineExceeded {
+		t.Errorf("Call() err = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestClient_CallCancel(t *testing.T) {
+	address := "127.0.0.1:27317"
+	s := newTestServer(t, address)
+	defer s.Stop()
+	c := newTestClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	var rsp string
+	if err := c.Call(ctx, address, "Hello", "SayWait", "hello", &rsp); err != context.Canceled {
+		t.Errorf("Call() err = %v, want %v", err, context.Canceled)
+	}
+
+	// server is notified
+	select {
+	case req := <-canceled:
+		if req != "hello" {
+			t.Errorf("canceled = %v, want %v", req, "hello")
+		}
+	case <-time.After(time.Second):
+		t.Error("server not canceled")
+	}
+}
+
+func TestClient_Stream(t *testing.T) {
+	tests := []struct {
+		name      string
+		address   string
+		transport func(...transport.Option) transport.Transport
+	}{
+		{
+			name:      "tcp",
+			address:   "127.0.0.1:27319",
+			transport: tcp.NewTransport,
+		},
+		{
+			name:      "grpc",
+			address:   "127.0.0.1:27320",
+			transport: grpc.NewTransport,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address := tt.address
+			s := newTestServer(t, address, server.Transport(tt.transport()))
+			defer s.Stop()
+			c := newTestClient(t, client.Transport(tt.transport()))
+
+			// server streaming
+			st, err := c.Stream(context.Background(), address, "Hello", "SayStream")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := st.Send(3); err != nil {
+				t.Fatal(err)
+			}
+			if err := st.CloseSend(); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for {
+				var rsp string
+				err := st.Recv(&rsp)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, rsp)
+			}
+			want := []string{"hello 0", "hello 1", "hello 2"}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Recv() = %v, want %v", got, want)
+			}
+
+			// bidirectional streaming
+			st, err = c.Stream(context.Background(), address, "Hello", "SayEcho")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, req := range []string{"a", "b"} {
+				if err := st.Send(req); err != nil {
+					t.Fatal(err)
+				}
+				var rsp string
+				if err := st.Recv(&rsp); err != nil {
+					t.Fatal(err)
+				}
+				if rsp != req+" dodo" {
+					t.Errorf("Recv() = %v, want %v", rsp, req+" dodo")
+				}
+			}
+			if err := st.Send("error"); err != nil {
+				t.Fatal(err)
+			}
+			var rsp string
+			err = st.Recv(&rsp)
+			if err == nil || err.Error() != "say error" || !derrors.Is(err, derrors.HandlerError) {
+				t.Errorf("Recv() err = %v, want %v", err, "say error")
+			}
+
+			// streaming function can not be called
+			err = c.Call(context.Background(), address, "Hello", "SayEcho", "hello", &rsp)
+			if !derrors.Is(err, derrors.Unimplemented) {
+				t.Errorf("Call() err = %v, want %v", err, derrors.Unimplemented)
+			}
+		})
+	}
+}
+
+func TestClient_StreamCancel(t *testing.T) {
+	address := "127.0.0.1:27321"
+	s := newTestServer(t, address)
+	defer s.Stop()
+	c := newTestClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	st, err := c.Stream(ctx, address, "Hello", "SayEcho")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	var rsp string
+	if err := st.Recv(&rsp); err != context.Canceled {
+		t.Errorf("Recv() err = %v, want %v", err, context.Canceled)
+	}
+	if err := st.Send("hello"); err != context.Canceled {
+		t.Errorf("Send() err = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestClient_StreamQueue(t *testing.T) {
+	address := "127.0.0.1:27325"
+	s := newTestServer(t, address)
+	defer s.Stop()
+	c := newTestClient(t, client.PoolSize(1))
+
+	// stream is not received, messages of server exceed size of queue
+	st, err := c.Stream(context.Background(), address, "Hello", "SayStream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Send(queue.DefaultSize * 2); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// stalled stream does not block other requests on the connection
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var rsp string
+	if err := c.Call(ctx, address, "Hello", "SayHello", "hello", &rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp != "hello dodo" {
+		t.Errorf("Call() rsp = %v, want %v", rsp, "hello dodo")
+	}
+
+	// only the stalled stream is failed after queued messages
+	for i := 0; ; i++ {
+		if err := st.Recv(&rsp); err != nil {
+			if i != queue.DefaultSize || !derrors.Is(err, derrors.ResourceExhausted) {
+				t.Errorf("Recv() %d err = %v, want %v", i, err, derrors.ResourceExhausted)
+			}
+			break
+		}
+	}
+}
@@ -3,6 +3,7 @@ package rpc
 import (
 	"github.com/haormj/dodo/client"
 	"github.com/haormj/dodo/codec/json"
+	"github.com/haormj/dodo/compressor"
 	"github.com/haormj/dodo/transport/grpc"
 )
 
@@ -11,6 +12,8 @@ func newOptions(opt ...client.Option) client.Options {
 		Transport: grpc.NewTransport(),
 		PoolSize:  client.DefaultPoolSize,
 		PoolTTL:   client.DefaultPoolTTL,
+
+		CompressThreshold: compressor.DefaultThreshold,
 	}
 
 	for _, o := range opt {
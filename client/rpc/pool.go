@@ -1,31 +1,262 @@
 package rpc
 
 import (
+	"context"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/internal/queue"
 	"github.com/haormj/dodo/transport"
 )
 
+var errConnClosed = errors.New(errors.Unavailable, "connection closed")
+
+// pool keeps at most size multiplexed connections for each address,
+// all calls to the same address share these connections by round robin.
+// Connection older than ttl will be retired, it is closed after all
+// in-flight calls finished.
 type pool struct {
 	size int
 	ttl  int64
 
 	sync.Mutex
-	conns map[string][]*poolConn
+	conns   map[string][]*poolConn
+	dialing map[string]*sync.Mutex
+	next    uint64
 }
 
+// poolConn multiplex requests on one transport.Client, each request
+// has an unique ID, and response is dispatched to caller by the ID.
+// Messages of stream are put into its bounded queue without waiting,
+// a slow stream whose queue is full is canceled, so it will not block
+// other requests.
 type poolConn struct {
 	transport.Client
 	created int64
+
+	// guard Send, transport.Client is not safe for concurrent Send
+	sendMu sync.Mutex
+
+	seq     uint64
+	mu      sync.Mutex
+	pending map[string]chan transport.Message
+	streams map[string]*queue.Queue
+	retired bool
+	err     error
+	once    sync.Once
+	closed  chan struct{}
 }
 
 func newPool(size int, ttl time.Duration) *pool {
+	if size <= 0 {
+		size = 1
+	}
 	return &pool{
-		size:  size,
-		ttl:   int64(ttl.Seconds()),
-		conns: make(map[string][]*poolConn),
+		size:    size,
+		ttl:     int64(ttl.Seconds()),
+		conns:   make(map[string][]*poolConn),
+		dialing: make(map[string]*sync.Mutex),
+	}
+}
+
+func newPoolConn(c transport.Client) *poolConn {
+	conn := &poolConn{
+		Client:  c,
+		created: time.Now().Unix(),
+		pending: make(map[string]chan transport.Message),
+		streams: make(map[string]*queue.Queue),
+		closed:  make(chan struct{}),
 	}
+	go conn.recvLoop()
+	return conn
+}
+
+// recvLoop is the only reader of connection, dispatch response by ID
+func (p *poolConn) recvLoop() {
+	for {
+		var m transport.Message
+		if err := p.Client.Recv(&m); err != nil {
+			p.close(err)
+			return
+		}
+		id := m.Header[idHeader]
+		p.mu.Lock()
+		ch, ok := p.pending[id]
+		delete(p.pending, id)
+		q, isStream := p.streams[id]
+		// server will not send message after end of stream
+		if isStream && m.Header["End-Stream"] == "true" {
+			delete(p.streams, id)
+		}
+		idle := p.retired && p.idle()
+		p.mu.Unlock()
+		if ok {
+			ch <- m
+		}
+		if isStream && q.Push(m) == queue.ErrFull {
+			// stop dispatching to the stream and tell server,
+			// send in goroutine as server may wait for reading
+			p.mu.Lock()
+			delete(p.streams, id)
+			idle = p.retired && p.idle()
+			p.mu.Unlock()
+			go p.cancel(id)
+		}
+		if idle {
+			p.close(errConnClosed)
+			return
+		}
+	}
+}
+
+// add register a pending request, return channel to receive response
+func (p *poolConn) add(id string) (chan transport.Message, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+	ch := make(chan transport.Message, 1)
+	p.pending[id] = ch
+	return ch, nil
+}
+
+func (p *poolConn) remove(id string) {
+	p.mu.Lock()
+	delete(p.pending, id)
+	p.mu.Unlock()
+}
+
+// idle report whether there is no in-flight request, p.mu must be held
+func (p *poolConn) idle() bool {
+	return len(p.pending) == 0 && len(p.streams) == 0
+}
+
+// send message, connection is closed if failed
+func (p *poolConn) send(m *transport.Message) error {
+	p.sendMu.Lock()
+	err := p.Client.Send(m)
+	p.sendMu.Unlock()
+	if err != nil {
+		p.close(err)
+	}
+	return err
+}
+
+// stream send the first message of stream, messages from server
+// with the same ID are put into the returned queue
+func (p *poolConn) stream(mi *transport.Message) (string, *queue.Queue, error) {
+	id := strconv.FormatUint(atomic.AddUint64(&p.seq, 1), 10)
+	mi.Header[idHeader] = id
+	q := queue.New(queue.DefaultSize)
+	p.mu.Lock()
+	if p.err != nil {
+		p.mu.Unlock()
+		return "", nil, p.err
+	}
+	p.streams[id] = q
+	p.mu.Unlock()
+
+	if err := p.send(mi); err != nil {
+		p.removeStream(id)
+		return "", nil, err
+	}
+	return id, q, nil
+}
+
+// removeStream stop dispatching messages to stream, retired
+// connection is closed when there is no in-flight request
+func (p *poolConn) removeStream(id string) {
+	p.mu.Lock()
+	delete(p.streams, id)
+	idle := p.retired && p.idle()
+	p.mu.Unlock()
+	if idle {
+		p.close(errConnClosed)
+	}
+}
+
+// call send request and wait response with the same ID,
+// if ctx is done before response, server will be told to cancel
+func (p *poolConn) call(ctx context.Context, mi *transport.Message) (transport.Message, error) {
+	id := strconv.FormatUint(atomic.AddUint64(&p.seq, 1), 10)
+	mi.Header[idHeader] = id
+	ch, err := p.add(id)
+	if err != nil {
+		return transport.Message{}, err
+	}
+
+	if err := p.send(mi); err != nil {
+		p.remove(id)
+		return transport.Message{}, err
+	}
+
+	select {
+	case mo := <-ch:
+		return mo, nil
+	case <-ctx.Done():
+		p.remove(id)
+		go p.cancel(id)
+		return transport.Message{}, ctx.Err()
+	case <-p.closed:
+		// response may arrive just before closed
+		select {
+		case mo := <-ch:
+			return mo, nil
+		default:
+			return transport.Message{}, p.error()
+		}
+	}
+}
+
+// cancel tell server to cancel the request, it is best effort
+func (p *poolConn) cancel(id string) {
+	m := format(protocol{
+		header: header{
+			ID:     id,
+			Cancel: true,
+		},
+	})
+	p.send(&m)
+}
+
+func (p *poolConn) error() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *poolConn) isClosed() bool {
+	select {
+	case <-p.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// retire close the connection when there is no in-flight request
+func (p *poolConn) retire() {
+	p.mu.Lock()
+	p.retired = true
+	idle := p.idle()
+	p.mu.Unlock()
+	if idle {
+		p.close(errConnClosed)
+	}
+}
+
+func (p *poolConn) close(err error) {
+	p.once.Do(func() {
+		p.mu.Lock()
+		p.err = err
+		p.mu.Unlock()
+		close(p.closed)
+		p.Client.Close()
+	})
 }
 
 // NoOp the Close since we manage it
@@ -33,55 +264,65 @@ func (p *poolConn) Close() error {
 	return nil
 }
 
-func (p *pool) getConn(addr string, tr transport.Transport, opts ...transport.DialOption) (*poolConn, error) {
+// pick one of conns when there are enough conns, it also remove
+// closed conns and retire old conns
+func (p *pool) pick(addr string) *poolConn {
 	p.Lock()
-	conns := p.conns[addr]
+	defer p.Unlock()
 	now := time.Now().Unix()
 
-	// while we have conns check age and then return one
-	// otherwise we'll create a new conn
-	for len(conns) > 0 {
-		conn := conns[len(conns)-1]
-		conns = conns[:len(conns)-1]
-		p.conns[addr] = conns
-
-		// if conn is old kill it and move on
+	conns := p.conns[addr][:0]
+	for _, conn := range p.conns[addr] {
+		if conn.isClosed() {
+			continue
+		}
 		if d := now - conn.created; d > p.ttl {
-			conn.Client.Close()
+			conn.retire()
 			continue
 		}
+		conns = append(conns, conn)
+	}
+	p.conns[addr] = conns
 
-		// we got a good conn, lets unlock and return it
-		p.Unlock()
+	if len(conns) < p.size {
+		return nil
+	}
+	conn := conns[p.next%uint64(len(conns))]
+	p.next++
+	return conn
+}
 
+func (p *pool) getConn(addr string, tr transport.Transport, opts ...transport.DialOption) (*poolConn, error) {
+	// we have enough conns, share one of them
+	if conn := p.pick(addr); conn != nil {
 		return conn, nil
 	}
 
+	// only one dial for the same address at a time
+	p.Lock()
+	mu, ok := p.dialing[addr]
+	if !ok {
+		mu = new(sync.Mutex)
+		p.dialing[addr] = mu
+	}
 	p.Unlock()
+	mu.Lock()
+	defer mu.Unlock()
+
+	// conn may be created by others when waiting
+	if conn := p.pick(addr); conn != nil {
+		return conn, nil
+	}
 
 	// create new conn
 	c, err := tr.Dial(addr, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return &poolConn{c, time.Now().Unix()}, nil
-}
+	conn := newPoolConn(c)
 
-func (p *pool) release(addr string, conn *poolConn, err error) {
-	// don't store the conn if it has errored
-	if err != nil {
-		conn.Client.Close()
-		return
-	}
-
-	// otherwise put it back for reuse
 	p.Lock()
-	conns := p.conns[addr]
-	if len(conns) >= p.size {
-		p.Unlock()
-		conn.Client.Close()
-		return
-	}
-	p.conns[addr] = append(conns, conn)
+	p.conns[addr] = append(p.conns[addr], conn)
 	p.Unlock()
+	return conn, nil
 }
@@ -1,22 +1,48 @@
 package rpc
 
 import (
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/haormj/dodo/errors"
 	"github.com/haormj/dodo/transport"
 )
 
+const (
+	idHeader          = "Id"
+	errorCodeHeader   = "Error-Code"
+	errorDetailPrefix = "Error-Detail-"
+)
+
 type protocol struct {
 	header header
 	Body   []byte
 }
 
 type header struct {
+	// ID of request, response has the same ID as request,
+	// it is used to multiplex requests on one connection
+	ID          string
 	ServiceName string
 	FuncName    string
 	Codec       string
-	Error       string
+	Error       *errors.Error
 	Metadata    map[string]string
+	// Compress is the compressor of body, empty means not compressed
+	Compress string
+	// AcceptCompress is the compressor which can be used by response
+	AcceptCompress string
+	// Timeout is the remaining time of caller, zero means no deadline
+	Timeout time.Duration
+	// Cancel tell server to cancel the request with the same ID
+	Cancel bool
+	// Stream mark message of streaming call, the first message
+	// open the stream, the others carry one message in body
+	Stream bool
+	// EndStream mark the last message of one side, message of
+	// server with EndStream carry the error of streaming call
+	EndStream bool
 }
 
 func parse(m transport.Message) protocol {
@@ -28,33 +54,105 @@ func parse(m transport.Message) protocol {
 	}
 	for k, v := range m.Header {
 		switch k {
+		case idHeader:
+			p.header.ID = v
 		case "ServiceName":
 			p.header.ServiceName = v
 		case "FuncName":
 			p.header.FuncName = v
 		case "Codec":
 			p.header.Codec = v
-		case "Error":
-			p.header.Error = v
+		case "Error", errorCodeHeader:
+			// handled below
+		case "Compress":
+			p.header.Compress = v
+		case "Accept-Compress":
+			p.header.AcceptCompress = v
+		case "Timeout":
+			p.header.Timeout, _ = time.ParseDuration(v)
+		case "Cancel":
+			p.header.Cancel = v == "true"
+		case "Stream":
+			p.header.Stream = v == "true"
+		case "End-Stream":
+			p.header.EndStream = v == "true"
 		default:
+			if strings.HasPrefix(k, errorDetailPrefix) {
+				continue
+			}
 			k = strings.TrimPrefix(k, "Meta-")
 			p.header.Metadata[k] = v
 		}
 	}
+	p.header.Error = parseError(m.Header)
 	return p
 }
 
+// parseError get error from Error, Error-Code and Error-Detail- headers,
+// Error without code is HandlerError, which is sent by old version
+func parseError(h map[string]string) *errors.Error {
+	msg := h["Error"]
+	c, hasCode := h[errorCodeHeader]
+	if len(msg) == 0 && !hasCode {
+		return nil
+	}
+	e := errors.New(errors.HandlerError, msg)
+	if hasCode {
+		code, err := strconv.Atoi(c)
+		if err != nil {
+			e.Code = errors.Unknown
+		} else {
+			e.Code = errors.ErrorCode(code)
+		}
+	}
+	for k, v := range h {
+		if strings.HasPrefix(k, errorDetailPrefix) {
+			e.WithDetail(strings.TrimPrefix(k, errorDetailPrefix), v)
+		}
+	}
+	return e
+}
+
 func format(p protocol) transport.Message {
 	m := transport.Message{
 		Header: map[string]string{
+			idHeader:      p.header.ID,
 			"ServiceName": p.header.ServiceName,
 			"FuncName":    p.header.FuncName,
 			"Codec":       p.header.Codec,
-			"Error":       p.header.Error,
+			"Error":       "",
 		},
 		Body: p.Body,
 	}
 
+	if p.header.Error != nil {
+		m.Header["Error"] = p.header.Error.Message
+		m.Header[errorCodeHeader] = strconv.Itoa(int(p.header.Error.Code))
+		for k, v := range p.header.Error.Details {
+			m.Header[errorDetailPrefix+k] = v
+		}
+	}
+
+	// optional header, not send if empty
+	if len(p.header.Compress) != 0 {
+		m.Header["Compress"] = p.header.Compress
+	}
+	if len(p.header.AcceptCompress) != 0 {
+		m.Header["Accept-Compress"] = p.header.AcceptCompress
+	}
+	if p.header.Timeout > 0 {
+		m.Header["Timeout"] = p.header.Timeout.String()
+	}
+	if p.header.Cancel {
+		m.Header["Cancel"] = "true"
+	}
+	if p.header.Stream {
+		m.Header["Stream"] = "true"
+	}
+	if p.header.EndStream {
+		m.Header["End-Stream"] = "true"
+	}
+
 	for k, v := range p.header.Metadata {
 		k = "Meta-" + k
 		m.Header[k] = v
@@ -0,0 +1,194 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/haormj/dodo/codec"
+	"github.com/haormj/dodo/compressor"
+	"github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/internal/queue"
+)
+
+// stream implement client.Stream on a multiplexed connection,
+// every message is sent with the ID of stream
+type stream struct {
+	ctx    context.Context
+	conn   *poolConn
+	id     string
+	q      *queue.Queue
+	header header
+
+	codec codec.Codec
+	// compressor of request, nil means not compress
+	compressor  compressor.Compressor
+	compressors map[string]compressor.Compressor
+	threshold   int
+
+	once sync.Once
+	done chan struct{}
+	// err is returned by Recv after stream is finished
+	mu  sync.Mutex
+	err error
+}
+
+func newStream(ctx context.Context, conn *poolConn, id string, q *queue.Queue, h header) *stream {
+	s := &stream{
+		ctx:    ctx,
+		conn:   conn,
+		id:     id,
+		q:      q,
+		header: h,
+		done:   make(chan struct{}),
+	}
+	// stream is closed when caller give up
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.finish(ctx.Err(), true)
+		case <-s.done:
+		}
+	}()
+	return s
+}
+
+func (s *stream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *stream) Send(v interface{}) error {
+	select {
+	case <-s.done:
+		return s.error()
+	default:
+	}
+
+	b, err := s.codec.Marshal(v)
+	if err != nil {
+		return errors.New(errors.EncodeError, err.Error())
+	}
+	p := protocol{
+		header: header{
+			ID:     s.id,
+			Codec:  s.header.Codec,
+			Stream: true,
+		},
+		Body: b,
+	}
+	if s.compressor != nil && len(b) >= s.threshold {
+		cb, err := s.compressor.Compress(b)
+		if err != nil {
+			return errors.New(errors.EncodeError, err.Error())
+		}
+		p.Body = cb
+		p.header.Compress = s.compressor.String()
+	}
+	m := format(p)
+	if err := s.conn.send(&m); err != nil {
+		return errors.FromError(err, errors.Unavailable)
+	}
+	return nil
+}
+
+func (s *stream) CloseSend() error {
+	select {
+	case <-s.done:
+		return s.error()
+	default:
+	}
+
+	m := format(protocol{
+		header: header{
+			ID:        s.id,
+			Stream:    true,
+			EndStream: true,
+		},
+	})
+	if err := s.conn.send(&m); err != nil {
+		return errors.FromError(err, errors.Unavailable)
+	}
+	return nil
+}
+
+func (s *stream) Recv(v interface{}) error {
+	select {
+	case <-s.done:
+		return s.error()
+	default:
+	}
+
+	m, err := s.q.Pop(s.ctx, s.conn.closed)
+	if err != nil {
+		if err == s.ctx.Err() {
+			s.finish(err, true)
+			return err
+		}
+		// server is canceled when queue is full
+		if err == queue.ErrFull {
+			s.finish(err, false)
+			return err
+		}
+		err = errors.FromError(s.conn.error(), errors.Unavailable)
+		s.finish(err, false)
+		return err
+	}
+
+	p := parse(m)
+	// server finished the stream, error is nil means success
+	if p.header.EndStream {
+		var err error = io.EOF
+		if p.header.Error != nil {
+			err = p.header.Error
+			// same as the deadline exceeded of client
+			if p.header.Error.Code == errors.DeadlineExceeded {
+				err = context.DeadlineExceeded
+			}
+		}
+		s.finish(err, false)
+		return err
+	}
+
+	if len(p.header.Compress) != 0 {
+		cps, ok := s.compressors[p.header.Compress]
+		if !ok {
+			return errors.New(errors.CompressorNotFound, "not find compressor "+p.header.Compress)
+		}
+		b, err := cps.Decompress(p.Body)
+		if err != nil {
+			return errors.New(errors.DecodeError, err.Error())
+		}
+		p.Body = b
+	}
+	if err := s.codec.Unmarshal(p.Body, v); err != nil {
+		return errors.New(errors.DecodeError, err.Error())
+	}
+	return nil
+}
+
+// Close tell server to cancel the stream if it is not finished
+func (s *stream) Close() error {
+	s.finish(errors.New(errors.Canceled, "stream closed"), true)
+	return nil
+}
+
+// finish the stream once, cancel tell server to cancel the stream
+func (s *stream) finish(err error, cancel bool) {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		close(s.done)
+		s.q.Close()
+		s.conn.removeStream(s.id)
+		if cancel {
+			s.conn.cancel(s.id)
+		}
+	})
+}
+
+func (s *stream) error() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
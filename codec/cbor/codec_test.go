@@ -0,0 +1,101 @@
+package cbor
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// tagged is request type with json tags, which are used by the codec
+type tagged struct {
+	Name string   `json:"name"`
+	Age  int      `json:"age,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+	Skip string   `json:"-"`
+}
+
+func TestCodec(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		// out is decoded from wire, it is in if nil
+		out  interface{}
+		wire string
+	}{
+		// major type 3, text string of length 5
+		{"string", "Hello", nil, "6548656c6c6f"},
+		// major type 0 and 1, small integer in the initial byte
+		{"int", 1, nil, "01"},
+		{"negative int", -1, nil, "20"},
+		// major type 2, byte string
+		{"bytes", []byte{1, 2}, nil, "420102"},
+		// major type 7, simple value and double
+		{"bool", true, nil, "f5"},
+		{"float", 1.5, nil, "fb3ff8000000000000"},
+		// struct is map keyed by json tag name, omitempty and - are skipped
+		{"struct", tagged{Name: "dodo", Skip: "skip"}, tagged{Name: "dodo"}, "a1646e616d6564646f646f"},
+	}
+	c := NewCodec()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := c.Marshal(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(b); got != tt.wire {
+				t.Errorf("Marshal() = %v, want %v", got, tt.wire)
+			}
+			want := tt.out
+			if want == nil {
+				want = tt.in
+			}
+			out := reflect.New(reflect.TypeOf(want))
+			if err := c.Unmarshal(b, out.Interface()); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(out.Elem().Interface(), want) {
+				t.Errorf("Unmarshal() = %v, want %v", out.Elem().Interface(), want)
+			}
+		})
+	}
+
+	// server decode request into pointer of pointer
+	var pout *string
+	if err := c.Unmarshal([]byte{0x61, 'a'}, &pout); err != nil {
+		t.Fatal(err)
+	}
+	if pout == nil || *pout != "a" {
+		t.Errorf("Unmarshal() = %v, want %v", pout, "a")
+	}
+}
+
+// request and response of Hello.SayHello in examples/helloworld
+func TestCodec_HelloWorld(t *testing.T) {
+	c := NewCodec()
+	// consumer encode request, provider decode it as receiver invoker
+	b, err := c.Marshal("Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var in string
+	if err := c.Unmarshal(b, &in); err != nil {
+		t.Fatal(err)
+	}
+	if in != "Hello" {
+		t.Errorf("Unmarshal() = %v, want %v", in, "Hello")
+	}
+
+	// provider encode response, consumer decode it into rsp
+	out := in + " dodo Hello"
+	b, err = c.Marshal(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rsp string
+	if err := c.Unmarshal(b, &rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp != "Hello dodo Hello" {
+		t.Errorf("Unmarshal() = %v, want %v", rsp, "Hello dodo Hello")
+	}
+}
@@ -0,0 +1,42 @@
+package msgpack
+
+import (
+	"github.com/haormj/dodo/codec"
+
+	ugorji "github.com/ugorji/go/codec"
+)
+
+var handle = newHandle()
+
+func newHandle() *ugorji.MsgpackHandle {
+	h := &ugorji.MsgpackHandle{}
+	// use json tag, so the struct used by json codec work unchanged
+	h.TypeInfos = ugorji.NewTypeInfos([]string{"json"})
+	// use str8 and bin format of new spec
+	h.WriteExt = true
+	h.RawToString = true
+	return h
+}
+
+// Codec implement by msgpack
+type Codec struct{}
+
+func NewCodec() codec.Codec {
+	return Codec{}
+}
+
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	var b []byte
+	if err := ugorji.NewEncoderBytes(&b, handle).Encode(v); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	return ugorji.NewDecoderBytes(data, handle).Decode(v)
+}
+
+func (Codec) String() string {
+	return "msgpack"
+}
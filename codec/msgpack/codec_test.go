@@ -0,0 +1,113 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tagged is request type with json tags, which are used by the codec
+type tagged struct {
+	Name string   `json:"name"`
+	Age  int      `json:"age,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+	Skip string   `json:"-"`
+}
+
+func TestCodec_Wire(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		wire string
+	}{
+		// fixstr
+		{"fixstr", "Hello", "a548656c6c6f"},
+		// str8 of new spec, old spec has only raw16 for 32 bytes
+		{"str8", strings.Repeat("a", 32), "d920" + strings.Repeat("61", 32)},
+		// bin8 of new spec instead of raw
+		{"bin8", []byte{1, 2}, "c4020102"},
+		// positive and negative fixint
+		{"fixint", 1, "01"},
+		{"negative fixint", -1, "ff"},
+		{"float64", 1.5, "cb3ff8000000000000"},
+		// fixmap keyed by json tag name, omitempty and - are skipped
+		{"struct", tagged{Name: "dodo", Skip: "skip"}, "81a46e616d65a4646f646f"},
+	}
+	c := NewCodec()
+	for _, tt := range tests {
+		b, err := c.Marshal(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(b); got != tt.wire {
+			t.Errorf("Marshal(%s) = %v, want %v", tt.name, got, tt.wire)
+		}
+	}
+}
+
+func TestCodec_Unmarshal(t *testing.T) {
+	c := NewCodec()
+	hin := tagged{Name: "dodo", Age: 1, Tags: []string{"a", "b"}}
+	b, err := c.Marshal(hin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hout tagged
+	if err := c.Unmarshal(b, &hout); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hout, hin) {
+		t.Errorf("Unmarshal() = %v, want %v", hout, hin)
+	}
+
+	// raw is decoded as string not []byte into interface
+	var v interface{}
+	if err := c.Unmarshal([]byte{0xa2, 'h', 'i'}, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v != "hi" {
+		t.Errorf("Unmarshal() = %#v, want %#v", v, "hi")
+	}
+	// message of old spec without str8 and bin is still decoded
+	var s string
+	old := append([]byte{0xda, 0x00, 0x20}, bytes.Repeat([]byte{'a'}, 32)...)
+	if err := c.Unmarshal(old, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s != strings.Repeat("a", 32) {
+		t.Errorf("Unmarshal() = %v, want %v", s, strings.Repeat("a", 32))
+	}
+}
+
+// request and response of Hello.SayHello in examples/helloworld
+func TestCodec_HelloWorld(t *testing.T) {
+	c := NewCodec()
+	// consumer encode request, provider decode it as receiver invoker
+	b, err := c.Marshal("Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var in string
+	if err := c.Unmarshal(b, &in); err != nil {
+		t.Fatal(err)
+	}
+	if in != "Hello" {
+		t.Errorf("Unmarshal() = %v, want %v", in, "Hello")
+	}
+
+	// provider encode response, consumer decode it into rsp
+	out := in + " dodo Hello"
+	b, err = c.Marshal(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rsp string
+	if err := c.Unmarshal(b, &rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp != "Hello dodo Hello" {
+		t.Errorf("Unmarshal() = %v, want %v", rsp, "Hello dodo Hello")
+	}
+}
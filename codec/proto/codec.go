@@ -0,0 +1,59 @@
+package proto
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/haormj/dodo/codec"
+)
+
+// ErrNotProtoMessage value passed to codec is not proto.Message
+var ErrNotProtoMessage = errors.New("not proto message")
+
+// Codec implement by protobuf
+type Codec struct{}
+
+func NewCodec() codec.Codec {
+	return Codec{}
+}
+
+// message get proto.Message from v, pointer to proto.Message is also
+// accepted, and the nil pointer will be allocated, this is the case of
+// server which decode request into **T
+func message(v interface{}) (proto.Message, error) {
+	if m, ok := v.(proto.Message); ok {
+		return m, nil
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		if rv.Elem().Kind() == reflect.Ptr && rv.Elem().IsNil() {
+			rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+		}
+		rv = rv.Elem()
+		if m, ok := rv.Interface().(proto.Message); ok {
+			return m, nil
+		}
+	}
+	return nil, ErrNotProtoMessage
+}
+
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	m, err := message(v)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(m)
+}
+
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	m, err := message(v)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(data, m)
+}
+
+func (Codec) String() string {
+	return "proto"
+}
@@ -0,0 +1,45 @@
+package proto
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/haormj/dodo/transport/grpc/pb"
+)
+
+func TestCodec(t *testing.T) {
+	c := NewCodec()
+	in := &pb.Message{
+		Header: map[string]string{"ServiceName": "Hello"},
+		Body:   []byte("hello"),
+	}
+	b, err := c.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(pb.Message)
+	if err := c.Unmarshal(b, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in.Header, out.Header) || !reflect.DeepEqual(in.Body, out.Body) {
+		t.Errorf("Unmarshal() = %v, want %v", out, in)
+	}
+
+	// server decode request into pointer of pointer
+	var pout *pb.Message
+	if err := c.Unmarshal(b, &pout); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in.Body, pout.Body) {
+		t.Errorf("Unmarshal() = %v, want %v", pout, in)
+	}
+
+	if _, err := c.Marshal("hello"); err != ErrNotProtoMessage {
+		t.Errorf("Marshal() err = %v, want %v", err, ErrNotProtoMessage)
+	}
+	var s string
+	if err := c.Unmarshal(b, &s); err != ErrNotProtoMessage {
+		t.Errorf("Unmarshal() err = %v, want %v", err, ErrNotProtoMessage)
+	}
+}
@@ -0,0 +1,24 @@
+// Package compressor is an interface for message body compression
+package compressor
+
+import "errors"
+
+// Compressor interface
+type Compressor interface {
+	Compress([]byte) ([]byte, error)
+	Decompress([]byte) ([]byte, error)
+	String() string
+}
+
+var (
+	// DefaultThreshold body smaller than it will not be compressed
+	DefaultThreshold = 1024
+)
+
+var (
+	// MaxSize is the max size of decompressed data, Decompress return
+	// ErrTooLarge rather than exhausting memory by malicious data
+	MaxSize = 64 << 20
+	// ErrTooLarge is returned by Decompress if data exceed MaxSize
+	ErrTooLarge = errors.New("decompressed data exceed max size")
+)
@@ -0,0 +1,68 @@
+package compressor_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/haormj/dodo/compressor"
+	"github.com/haormj/dodo/compressor/gzip"
+	"github.com/haormj/dodo/compressor/snappy"
+	"github.com/haormj/dodo/compressor/zstd"
+)
+
+func TestCompressor(t *testing.T) {
+	data := bytes.Repeat([]byte("hello dodo "), 1024)
+	for _, c := range []compressor.Compressor{
+		gzip.NewCompressor(),
+		snappy.NewCompressor(),
+		zstd.NewCompressor(),
+	} {
+		t.Run(c.String(), func(t *testing.T) {
+			b, err := c.Compress(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b) >= len(data) {
+				t.Errorf("Compress() len = %d, want less than %d", len(b), len(data))
+			}
+			got, err := c.Decompress(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("Decompress() = %s, want %s", got, data)
+			}
+			if _, err := c.Decompress([]byte("invalid")); err == nil {
+				t.Error("Decompress() err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestCompressor_MaxSize(t *testing.T) {
+	defer func(n int) {
+		compressor.MaxSize = n
+	}(compressor.MaxSize)
+
+	data := bytes.Repeat([]byte("hello dodo "), 1024)
+	for _, c := range []compressor.Compressor{
+		gzip.NewCompressor(),
+		snappy.NewCompressor(),
+		zstd.NewCompressor(),
+	} {
+		t.Run(c.String(), func(t *testing.T) {
+			b, err := c.Compress(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compressor.MaxSize = len(data)
+			if _, err := c.Decompress(b); err != nil {
+				t.Errorf("Decompress() err = %v, want nil", err)
+			}
+			compressor.MaxSize = len(data) - 1
+			if _, err := c.Decompress(b); err != compressor.ErrTooLarge {
+				t.Errorf("Decompress() err = %v, want %v", err, compressor.ErrTooLarge)
+			}
+		})
+	}
+}
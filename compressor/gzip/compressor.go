@@ -0,0 +1,59 @@
+package gzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/haormj/dodo/compressor"
+)
+
+var writerPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// Compressor implement by gzip
+type Compressor struct{}
+
+func NewCompressor() compressor.Compressor {
+	return Compressor{}
+}
+
+func (Compressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := writerPool.Get().(*gzip.Writer)
+	defer writerPool.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (Compressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	// read one more byte to know whether data exceed max size
+	b, err := ioutil.ReadAll(io.LimitReader(r, int64(compressor.MaxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > compressor.MaxSize {
+		return nil, compressor.ErrTooLarge
+	}
+	return b, nil
+}
+
+func (Compressor) String() string {
+	return "gzip"
+}
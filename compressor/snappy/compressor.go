@@ -0,0 +1,33 @@
+package snappy
+
+import (
+	"github.com/golang/snappy"
+	"github.com/haormj/dodo/compressor"
+)
+
+// Compressor implement by snappy block format
+type Compressor struct{}
+
+func NewCompressor() compressor.Compressor {
+	return Compressor{}
+}
+
+func (Compressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (Compressor) Decompress(data []byte) ([]byte, error) {
+	// length of decoded data is in the header
+	n, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+	if n > compressor.MaxSize {
+		return nil, compressor.ErrTooLarge
+	}
+	return snappy.Decode(nil, data)
+}
+
+func (Compressor) String() string {
+	return "snappy"
+}
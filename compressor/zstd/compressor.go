@@ -0,0 +1,76 @@
+package zstd
+
+import (
+	"sync"
+
+	"github.com/haormj/dodo/compressor"
+	"github.com/klauspost/compress/zstd"
+)
+
+// encoder and decoder is safe for concurrent use by EncodeAll and
+// DecodeAll, they are created by the first use
+var (
+	once    sync.Once
+	encoder *zstd.Encoder
+	initErr error
+
+	// decoders limit decompressed data by the max size, one decoder
+	// is created for each max size as limit can not be changed
+	mu       sync.Mutex
+	decoders = make(map[int]*zstd.Decoder)
+)
+
+// getEncoder create encoder once, error is kept and returned by all calls
+func getEncoder() (*zstd.Encoder, error) {
+	once.Do(func() {
+		encoder, initErr = zstd.NewWriter(nil)
+	})
+	return encoder, initErr
+}
+
+// getDecoder get decoder of max size
+func getDecoder(size int) (*zstd.Decoder, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if dec, ok := decoders[size]; ok {
+		return dec, nil
+	}
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(size)))
+	if err != nil {
+		return nil, err
+	}
+	decoders[size] = dec
+	return dec, nil
+}
+
+// Compressor implement by zstd
+type Compressor struct{}
+
+func NewCompressor() compressor.Compressor {
+	return Compressor{}
+}
+
+func (Compressor) Compress(data []byte) ([]byte, error) {
+	enc, err := getEncoder()
+	if err != nil {
+		return nil, err
+	}
+	return enc.EncodeAll(data, nil), nil
+}
+
+func (Compressor) Decompress(data []byte) ([]byte, error) {
+	dec, err := getDecoder(compressor.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+	b, err := dec.DecodeAll(data, nil)
+	switch err {
+	case zstd.ErrDecoderSizeExceeded, zstd.ErrFrameSizeExceeded, zstd.ErrWindowSizeExceeded:
+		return nil, compressor.ErrTooLarge
+	}
+	return b, err
+}
+
+func (Compressor) String() string {
+	return "zstd"
+}
@@ -0,0 +1,295 @@
+package consumer
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/log"
+	"github.com/haormj/dodo/metadata"
+	"github.com/haormj/dodo/registry"
+)
+
+// ClusterMode decide how to call services and handle failure
+type ClusterMode string
+
+const (
+	// Failover retry other services on failure by RetryPolicy
+	Failover ClusterMode = "failover"
+	// Failfast call once, error is returned immediately
+	Failfast ClusterMode = "failfast"
+	// Failsafe call once, error is logged and ignored
+	Failsafe ClusterMode = "failsafe"
+	// Failback call once, error is logged and ignored, failure is retried
+	// in background every FailbackInterval, at most MaxAttempts of RetryPolicy
+	Failback ClusterMode = "failback"
+	// Forking call Forks services in parallel, the first success wins
+	Forking ClusterMode = "forking"
+	// Broadcast call all services, error is returned if any failed
+	Broadcast ClusterMode = "broadcast"
+	// Hedging send request to another service if no response is got
+	// by the delay of HedgePolicy, the first success wins
+	Hedging ClusterMode = "hedging"
+)
+
+// FailbackInterval is the interval of retrying failed call in failback
+var FailbackInterval = 5 * time.Second
+
+// canRetry judge whether the call of funcName can be retried after the
+// nth attempt failed with err, func not advertised as idempotent by
+// provider is never retried, and retry is limited by budget
+func (c *Consumer) canRetry(ctx context.Context, service registry.Service, funcName string,
+	err error, n int, policy RetryPolicy) bool {
+	if n >= policy.MaxAttempts || !policy.retryable(err) || ctx.Err() != nil {
+		return false
+	}
+	if !registry.IsIdempotent(service, funcName) {
+		return false
+	}
+	return c.opts.RetryBudget.withdraw()
+}
+
+// newValue create a new value with the same type as out,
+// so parallel calls will not write the same out
+func newValue(out interface{}) interface{} {
+	t := reflect.TypeOf(out)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return out
+	}
+	return reflect.New(t.Elem()).Interface()
+}
+
+// setValue copy v created by newValue to out
+func setValue(out interface{}, v interface{}) {
+	if out == v {
+		return
+	}
+	reflect.ValueOf(out).Elem().Set(reflect.ValueOf(v).Elem())
+}
+
+// copyValue deep copy v by encoding it with the codec used to call
+// service and decoding to a new value
+func (c *Consumer) copyValue(service registry.Service, v interface{}, callOpts CallOptions) (interface{}, error) {
+	cli, ok := c.clients[service.Protocol]
+	if !ok {
+		return nil, errors.New(errors.Unimplemented, "not find client of protocol "+service.Protocol)
+	}
+	cdc, err := selectCodec(cli, service, callOpts)
+	if err != nil {
+		return nil, err
+	}
+	b, err := cdc.Marshal(v)
+	if err != nil {
+		return nil, errors.New(errors.EncodeError, err.Error())
+	}
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return v, nil
+	}
+	if t.Kind() == reflect.Ptr {
+		cp := reflect.New(t.Elem()).Interface()
+		if err := cdc.Unmarshal(b, cp); err != nil {
+			return nil, errors.New(errors.DecodeError, err.Error())
+		}
+		return cp, nil
+	}
+	cp := reflect.New(t)
+	if err := cdc.Unmarshal(b, cp.Interface()); err != nil {
+		return nil, errors.New(errors.DecodeError, err.Error())
+	}
+	return cp.Elem().Interface(), nil
+}
+
+// cluster call services of serviceName by cluster mode
+func (c *Consumer) cluster(ctx context.Context, serviceName string, funcName string,
+	in interface{}, out interface{}, callOpts CallOptions) error {
+	c.opts.RetryBudget.deposit()
+	switch callOpts.Cluster {
+	case Failover:
+		return c.failover(ctx, serviceName, funcName, in, out, callOpts)
+	case Failsafe:
+		if err := c.failfast(ctx, serviceName, funcName, in, out, callOpts); err != nil {
+			log.Error("failsafe ignore error of ", serviceName, ".", funcName, ": ", err)
+		}
+		return nil
+	case Failback:
+		return c.failback(ctx, serviceName, funcName, in, out, callOpts)
+	case Forking:
+		return c.forking(ctx, serviceName, funcName, in, out, callOpts)
+	case Broadcast:
+		return c.broadcast(ctx, serviceName, funcName, in, out, callOpts)
+	case Hedging:
+		return c.hedging(ctx, serviceName, funcName, in, out, callOpts)
+	default:
+		return c.failfast(ctx, serviceName, funcName, in, out, callOpts)
+	}
+}
+
+func (c *Consumer) failfast(ctx context.Context, serviceName string, funcName string,
+	in interface{}, out interface{}, callOpts CallOptions) error {
+	service, err := c.selectService(ctx, serviceName, callOpts, nil)
+	if err != nil {
+		return err
+	}
+	return c.call(ctx, service, funcName, in, out, callOpts)
+}
+
+func (c *Consumer) failover(ctx context.Context, serviceName string, funcName string,
+	in interface{}, out interface{}, callOpts CallOptions) error {
+	var excludes []string
+	var err error
+	for n := 1; ; n++ {
+		service, serr := c.selectService(ctx, serviceName, callOpts, excludes)
+		// all services are tried, select from all again
+		if serr != nil && len(excludes) != 0 {
+			excludes = nil
+			service, serr = c.selectService(ctx, serviceName, callOpts, nil)
+		}
+		if serr != nil {
+			if err != nil {
+				return err
+			}
+			return serr
+		}
+		err = c.call(ctx, service, funcName, in, out, callOpts)
+		if err == nil || !c.canRetry(ctx, service, funcName, err, n, callOpts.Retry) {
+			return err
+		}
+		excludes = append(excludes, service.Address)
+
+		select {
+		case <-time.After(callOpts.Retry.backoff(n)):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+func (c *Consumer) failback(ctx context.Context, serviceName string, funcName string,
+	in interface{}, out interface{}, callOpts CallOptions) error {
+	service, err := c.selectService(ctx, serviceName, callOpts, nil)
+	if err == nil {
+		err = c.call(ctx, service, funcName, in, out, callOpts)
+	}
+	if err == nil {
+		return nil
+	}
+	log.Error("failback ignore error of ", serviceName, ".", funcName, ": ", err)
+	if !c.canRetry(ctx, service, funcName, err, 1, callOpts.Retry) {
+		return nil
+	}
+
+	// caller may have returned and changed in, retry with a copy of it
+	in, err = c.copyValue(service, in, callOpts)
+	if err != nil {
+		log.Error("failback can not copy request of ", serviceName, ".", funcName, ": ", err)
+		return nil
+	}
+	// caller may have returned, only metadata is kept
+	md, _ := metadata.FromContext(ctx)
+	ctx = metadata.NewContext(context.Background(), md)
+	rsp := newValue(out)
+	go func() {
+		for n := 2; ; n++ {
+			select {
+			case <-time.After(FailbackInterval):
+			case <-c.exit:
+				return
+			}
+			err := c.failfast(ctx, serviceName, funcName, in, rsp, callOpts)
+			if err == nil || !c.canRetry(ctx, service, funcName, err, n, callOpts.Retry) {
+				return
+			}
+			log.Error("failback retry ", serviceName, ".", funcName, ": ", err)
+		}
+	}()
+	return nil
+}
+
+// services select at most n different services, n <= 0 means all
+func (c *Consumer) services(ctx context.Context, serviceName string,
+	callOpts CallOptions, n int) ([]registry.Service, error) {
+	var services []registry.Service
+	var excludes []string
+	for n <= 0 || len(services) < n {
+		service, err := c.selectService(ctx, serviceName, callOpts, excludes)
+		if err != nil {
+			if len(services) == 0 {
+				return nil, err
+			}
+			break
+		}
+		// given address can be selected only once
+		if registry.Contains(services, service) {
+			break
+		}
+		services = append(services, service)
+		excludes = append(excludes, service.Address)
+	}
+	return services, nil
+}
+
+type result struct {
+	out interface{}
+	err error
+}
+
+func (c *Consumer) forking(ctx context.Context, serviceName string, funcName string,
+	in interface{}, out interface{}, callOpts CallOptions) error {
+	services, err := c.services(ctx, serviceName, callOpts, callOpts.Forks)
+	if err != nil {
+		return err
+	}
+
+	// cancel the others when one succeeded
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch := make(chan result, len(services))
+	for _, service := range services {
+		go func(service registry.Service) {
+			rsp := newValue(out)
+			err := c.call(ctx, service, funcName, in, rsp, callOpts)
+			ch <- result{out: rsp, err: err}
+		}(service)
+	}
+	for range services {
+		r := <-ch
+		if r.err == nil {
+			setValue(out, r.out)
+			return nil
+		}
+		err = r.err
+	}
+	return err
+}
+
+func (c *Consumer) broadcast(ctx context.Context, serviceName string, funcName string,
+	in interface{}, out interface{}, callOpts CallOptions) error {
+	services, err := c.services(ctx, serviceName, callOpts, 0)
+	if err != nil {
+		return err
+	}
+
+	results := make([]result, len(services))
+	done := make(chan struct{})
+	for i, service := range services {
+		go func(i int, service registry.Service) {
+			rsp := newValue(out)
+			err := c.call(ctx, service, funcName, in, rsp, callOpts)
+			results[i] = result{out: rsp, err: err}
+			done <- struct{}{}
+		}(i, service)
+	}
+	for range services {
+		<-done
+	}
+	// the first error, or the result of the first service
+	for _, r := range results {
+		if r.err != nil {
+			return r.err
+		}
+	}
+	setValue(out, results[0].out)
+	return nil
+}
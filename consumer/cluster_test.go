@@ -0,0 +1,239 @@
+package consumer
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/haormj/dodo/client"
+	"github.com/haormj/dodo/codec"
+	"github.com/haormj/dodo/codec/json"
+	"github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/log"
+	"github.com/haormj/dodo/ratelimit"
+	"github.com/haormj/dodo/registry"
+	"github.com/haormj/dodo/selector"
+)
+
+// testClient call handler of address
+type testClient struct {
+	sync.Mutex
+	handlers map[string]func(n int) (string, error)
+	calls    map[string]int
+	// reqs of all calls
+	reqs []interface{}
+}
+
+func (c *testClient) Init(...client.Option) error {
+	return nil
+}
+
+func (c *testClient) Options() client.Options {
+	return client.Options{
+		Codecs: []codec.Codec{json.NewCodec()},
+	}
+}
+
+func (c *testClient) Call(ctx context.Context, address string, serviceName string, funcName string,
+	req interface{}, rsp interface{}, opts ...client.CallOption) error {
+	c.Lock()
+	c.calls[address]++
+	n := c.calls[address]
+	c.reqs = append(c.reqs, req)
+	c.Unlock()
+	s, err := c.handlers[address](n)
+	if err != nil {
+		return err
+	}
+	*rsp.(*string) = s
+	return nil
+}
+
+func (c *testClient) Stream(ctx context.Context, address string, serviceName string, funcName string,
+	opts ...client.CallOption) (client.Stream, error) {
+	return nil, errors.New(errors.Unimplemented, "not supported")
+}
+
+func (c *testClient) String() string {
+	return "test"
+}
+
+func (c *testClient) total() int {
+	c.Lock()
+	defer c.Unlock()
+	n := 0
+	for _, v := range c.calls {
+		n += v
+	}
+	return n
+}
+
+// testSelector select from static services
+type testSelector struct {
+	services []registry.Service
+}
+
+func (s *testSelector) Init(...selector.Option) error {
+	return nil
+}
+
+func (s *testSelector) Options() selector.Options {
+	return selector.Options{}
+}
+
+func (s *testSelector) Select(service string, opts ...selector.SelectOption) (registry.Service, error) {
+	sopts := selector.SelectOptions{
+		Strategy: selector.Random,
+	}
+	for _, o := range opts {
+		o(&sopts)
+	}
+	services := s.services
+	for _, filter := range sopts.Filters {
+		services = filter(services)
+	}
+	return sopts.Strategy(services)
+}
+
+func (s *testSelector) Mark(string, string, error) {}
+
+func (s *testSelector) Reset(string) {}
+
+func (s *testSelector) Close() error {
+	return nil
+}
+
+func (s *testSelector) String() string {
+	return "test"
+}
+
+func newTestConsumer(handlers map[string]func(n int) (string, error)) (*Consumer, *testClient) {
+	log.SetDummyLogger()
+	cli := &testClient{
+		handlers: handlers,
+		calls:    make(map[string]int),
+	}
+	var services []registry.Service
+	for addr := range handlers {
+		services = append(services, registry.Service{
+			Protocol: "test",
+			Address:  addr,
+			Name:     "Hello",
+			Codecs:   []string{"json"},
+			// only SayHello can be retried
+			Idempotent: []string{"SayHello"},
+		})
+	}
+	c := NewConsumer(
+		Client(cli),
+		Selector(&testSelector{services: services}),
+		Registry(nil),
+	)
+	c.clients[cli.String()] = cli
+	return c, cli
+}
+
+func success(s string) func(int) (string, error) {
+	return func(int) (string, error) {
+		return s, nil
+	}
+}
+
+func failure(code errors.ErrorCode) func(int) (string, error) {
+	return func(int) (string, error) {
+		return "", errors.New(code, code.String())
+	}
+}
+
+func TestConsumer_Cluster(t *testing.T) {
+	unavailable := failure(errors.Unavailable)
+	tests := []struct {
+		name     string
+		mode     ClusterMode
+		handlers map[string]func(int) (string, error)
+		want     string
+		wantErr  errors.ErrorCode
+		calls    int
+	}{
+		{"failfast", Failfast, map[string]func(int) (string, error){"a": unavailable}, "", errors.Unavailable, 1},
+		{"failover", Failover, map[string]func(int) (string, error){"a": unavailable, "b": unavailable, "c": success("c")}, "c", errors.OK, 0},
+		{"failover retries", Failover, map[string]func(int) (string, error){"a": unavailable, "b": unavailable, "c": unavailable, "d": unavailable}, "", errors.Unavailable, 3},
+		{"failover handler error", Failover, map[string]func(int) (string, error){"a": failure(errors.HandlerError), "b": failure(errors.HandlerError)}, "", errors.HandlerError, 1},
+		{"failsafe", Failsafe, map[string]func(int) (string, error){"a": unavailable}, "", errors.OK, 1},
+		{"forking", Forking, map[string]func(int) (string, error){"a": unavailable, "b": success("b")}, "b", errors.OK, 0},
+		{"broadcast", Broadcast, map[string]func(int) (string, error){"a": success("a"), "b": success("a"), "c": success("a")}, "a", errors.OK, 3},
+		{"broadcast error", Broadcast, map[string]func(int) (string, error){"a": success("a"), "b": unavailable, "c": success("a")}, "", errors.Unavailable, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, cli := newTestConsumer(tt.handlers)
+			defer c.Close()
+			var rsp string
+			err := c.Call(context.Background(), "Hello", "SayHello", "hello", &rsp, WithCluster(tt.mode))
+			if got := errors.Code(err); got != tt.wantErr {
+				t.Errorf("Call() err = %v, want %v", err, tt.wantErr)
+			}
+			if rsp != tt.want {
+				t.Errorf("Call() rsp = %v, want %v", rsp, tt.want)
+			}
+			if tt.calls != 0 && cli.total() != tt.calls {
+				t.Errorf("Call() calls = %v, want %v", cli.total(), tt.calls)
+			}
+		})
+	}
+}
+
+func TestConsumer_ClusterFailback(t *testing.T) {
+	defer func(d time.Duration) {
+		FailbackInterval = d
+	}(FailbackInterval)
+	FailbackInterval = 10 * time.Millisecond
+
+	c, cli := newTestConsumer(map[string]func(int) (string, error){
+		"a": func(n int) (string, error) {
+			if n < 2 {
+				return "", errors.New(errors.Unavailable, "unavailable")
+			}
+			return "a", nil
+		},
+	})
+	defer c.Close()
+	var rsp string
+	req := "hello"
+	if err := c.Call(context.Background(), "Hello", "SayHello", &req, &rsp, WithCluster(Failback)); err != nil {
+		t.Errorf("Call() err = %v, want %v", err, nil)
+	}
+	// request is reused by caller after returned
+	req = "changed"
+	time.Sleep(100 * time.Millisecond)
+	if got := cli.total(); got != 2 {
+		t.Errorf("Call() calls = %v, want %v", got, 2)
+	}
+	cli.Lock()
+	defer cli.Unlock()
+	if got := *cli.reqs[1].(*string); got != "hello" {
+		t.Errorf("retry req = %v, want %v", got, "hello")
+	}
+}
+
+func TestConsumer_RateLimit(t *testing.T) {
+	c, cli := newTestConsumer(map[string]func(int) (string, error){"a": success("a")})
+	defer c.Close()
+	limiter := ratelimit.NewLimiter(ratelimit.Rules{"Hello.SayHello": {Rate: 0.001, Burst: 2}})
+	Intercept(limiter.Interceptor())(&c.opts)
+	var codes []errors.ErrorCode
+	for i := 0; i < 3; i++ {
+		var rsp string
+		err := c.Call(context.Background(), "Hello", "SayHello", "hello", &rsp)
+		codes = append(codes, errors.Code(err))
+	}
+	want := []errors.ErrorCode{errors.OK, errors.OK, errors.ResourceExhausted}
+	if !reflect.DeepEqual(codes, want) {
+		t.Errorf("Call() codes = %v, want %v", codes, want)
+	}
+	if got := cli.total(); got != 2 {
+		t.Errorf("Call() calls = %v, want %v", got, 2)
+	}
+}
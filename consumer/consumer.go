@@ -3,19 +3,32 @@ package consumer
 import (
 	"context"
 	"crypto/tls"
-	"errors"
+	"sync"
+	"time"
 
 	"github.com/haormj/dodo/client"
+	"github.com/haormj/dodo/codec"
+	"github.com/haormj/dodo/errors"
 	"github.com/haormj/dodo/invoker"
+	"github.com/haormj/dodo/metadata"
 	"github.com/haormj/dodo/registry"
 	"github.com/haormj/dodo/selector"
 	"github.com/haormj/dodo/util"
 )
 
+// insecureTLSConfig is used when service enable TLS and caller does not
+// set config, it is shared so http client of config can be reused
+var insecureTLSConfig = &tls.Config{InsecureSkipVerify: true}
+
 type Consumer struct {
 	opts           Options
 	invokerManager *InvokerManager
 	clients        map[string]client.Client
+	// recent latencies of funcs, used by hedging
+	latencies *latencies
+
+	once sync.Once
+	exit chan struct{}
 }
 
 func NewConsumer(opts ...Option) *Consumer {
@@ -24,6 +37,8 @@ func NewConsumer(opts ...Option) *Consumer {
 		opts:           options,
 		invokerManager: NewInvokerManager(),
 		clients:        make(map[string]client.Client),
+		latencies:      newLatencies(),
+		exit:           make(chan struct{}),
 	}
 	return c
 }
@@ -59,45 +74,18 @@ func (c *Consumer) Call(ctx context.Context, serviceName string, funcName string
 		callOpts.Filters = append(callOpts.Filters, selector.FilterTLS())
 	}
 	// codec filter
-	callOpts.Filters = append(callOpts.Filters, selector.FilterClient(c.opts.Clients))
-
-	var service registry.Service
-	if len(callOpts.Address) != 0 {
-		service.Address = callOpts.Address
-		service.Name = serviceName
-	} else {
-		var err error
-		service, err = c.opts.Selector.Select(serviceName, selector.WithFilter(callOpts.Filters...))
-		if err != nil {
-			return err
-		}
-	}
-
-	// get client by protocol
-	cli, _ := c.clients[service.Protocol]
-	// TODO this is a shit
-	t := make([]string, 0)
-	for _, cdc := range cli.Options().Codecs {
-		t = append(t, cdc.String())
+	if len(callOpts.Codec) != 0 {
+		callOpts.Filters = append(callOpts.Filters, selector.FilterCodec(callOpts.Codec))
 	}
+	callOpts.Filters = append(callOpts.Filters, selector.FilterClient(c.opts.Clients))
 
+	// services are selected and called by cluster mode
 	var fn = func(invoker.InvokeFunc) invoker.InvokeFunc {
 		return func(ctx context.Context, mi invoker.Message,
 			opts ...invoker.InvokeOption) (invoker.Message, error) {
 			mo := invoker.NewMessage()
 			params := mi.Parameters()
-			var copts []client.CallOption
-			copts = append(copts, client.WithCodec(util.ArrayIntersectString(t, service.Codecs)[0]))
-			if service.TLS {
-				if callOpts.TLSConfig != nil {
-					copts = append(copts, client.WithTLSConfig(callOpts.TLSConfig))
-				} else {
-					copts = append(copts, client.WithTLSConfig(&tls.Config{InsecureSkipVerify: true}))
-				}
-			}
-			err := cli.Call(ctx, service.Address, serviceName, funcName,
-				params[1], params[2], copts...)
-
+			err := c.cluster(ctx, serviceName, funcName, params[1], params[2], callOpts)
 			mo.SetParameters([]interface{}{err})
 			return mo, nil
 		}
@@ -107,6 +95,7 @@ func (c *Consumer) Call(ctx context.Context, serviceName string, funcName string
 	mi := invoker.NewMessage()
 	mi.SetFuncName(funcName)
 	mi.SetParameters([]interface{}{ctx, in, out})
+	mi.SetAttachment(invoker.ServiceNameAttachment, serviceName)
 
 	var i []invoker.Interceptor
 	i = append(i, callOpts.Interceptors...)
@@ -120,7 +109,7 @@ func (c *Consumer) Call(ctx context.Context, serviceName string, funcName string
 	if mo.Parameters()[0] != nil {
 		err, ok := mo.Parameters()[0].(error)
 		if !ok {
-			return errors.New("message out parameter is not error")
+			return errors.New(errors.Internal, "message out parameter is not error")
 		}
 		return err
 	}
@@ -128,6 +117,117 @@ func (c *Consumer) Call(ctx context.Context, serviceName string, funcName string
 	return nil
 }
 
+// selectService select one service, services with address in
+// excludes are not selected, Address of CallOptions is used if given
+func (c *Consumer) selectService(ctx context.Context, serviceName string,
+	callOpts CallOptions, excludes []string) (registry.Service, error) {
+	var service registry.Service
+	// service is not discovered, call it by the first client
+	// with any codec of the client
+	if len(callOpts.Address) != 0 {
+		cli := c.opts.Clients[0]
+		service.Address = callOpts.Address
+		service.Name = serviceName
+		service.Protocol = cli.String()
+		for _, cdc := range cli.Options().Codecs {
+			service.Codecs = append(service.Codecs, cdc.String())
+		}
+		service.TLS = callOpts.TLSConfig != nil
+		return service, nil
+	}
+
+	filters := callOpts.Filters
+	if len(excludes) != 0 {
+		filters = append(filters[:len(filters):len(filters)], selector.FilterExclude(excludes...))
+	}
+	sopts := []selector.SelectOption{selector.WithFilter(filters...)}
+	if callOpts.Strategy != nil {
+		sopts = append(sopts, selector.WithStrategy(callOpts.Strategy))
+	}
+	// consistent hash by key or metadata
+	key := callOpts.HashKey
+	if len(key) == 0 && len(callOpts.HashMetadata) != 0 {
+		md, _ := metadata.FromContext(ctx)
+		key = md[callOpts.HashMetadata]
+	}
+	if len(key) != 0 {
+		sopts = append(sopts, selector.WithStrategy(selector.ConsistentHash(key)))
+	}
+	return c.opts.Selector.Select(serviceName, sopts...)
+}
+
+// selectCodec get the first codec of client supported by service, it
+// must be callOpts.Codec if it is set
+func selectCodec(cli client.Client, service registry.Service, callOpts CallOptions) (codec.Codec, error) {
+	for _, cdc := range cli.Options().Codecs {
+		if len(callOpts.Codec) != 0 && cdc.String() != callOpts.Codec {
+			continue
+		}
+		if util.ArrayContainsString(service.Codecs, cdc.String()) {
+			return cdc, nil
+		}
+	}
+	return nil, errors.New(errors.CodecNotFound, "not find codec supported by both client and "+service.Address)
+}
+
+// call one service by the client of its protocol
+func (c *Consumer) call(ctx context.Context, service registry.Service, funcName string,
+	in interface{}, out interface{}, callOpts CallOptions) error {
+	// get client by protocol
+	cli, ok := c.clients[service.Protocol]
+	if !ok {
+		return errors.New(errors.Unimplemented, "not find client of protocol "+service.Protocol)
+	}
+	cdc, err := selectCodec(cli, service, callOpts)
+	if err != nil {
+		return err
+	}
+	// compressor is optional, use the first one supported by both side
+	var compressors []string
+	for _, cps := range cli.Options().Compressors {
+		compressors = append(compressors, cps.String())
+	}
+	compressors = util.ArrayIntersectString(compressors, service.Compressors)
+
+	var copts []client.CallOption
+	copts = append(copts, client.WithCodec(cdc.String()))
+	if len(compressors) != 0 {
+		copts = append(copts, client.WithCompressor(compressors[0]))
+	}
+	if service.TLS {
+		if callOpts.TLSConfig != nil {
+			copts = append(copts, client.WithTLSConfig(callOpts.TLSConfig))
+		} else {
+			copts = append(copts, client.WithTLSConfig(insecureTLSConfig))
+		}
+	}
+	// in-flight calls are used by strategies, e.g. LeastActive
+	selector.BeginCall(service)
+	start := time.Now()
+	err = cli.Call(ctx, service.Address, service.Name, funcName, in, out, copts...)
+	d := time.Since(start)
+	// canceled by caller, e.g. the others are canceled when one
+	// of forking succeeded, whatever error client returned
+	if err != nil && ctx.Err() == context.Canceled {
+		selector.EndCall(service, d, ctx.Err())
+	} else {
+		selector.EndCall(service, d, err)
+	}
+	// latency of success is used by delay of hedging
+	if err == nil {
+		c.latencies.observe(service.Name+"."+funcName, d)
+	}
+	// report result, unhealthy node will be ejected
+	if len(callOpts.Address) == 0 {
+		c.opts.Selector.Mark(service.Name, service.Address, err)
+	}
+	return err
+}
+
+// Close stop retrying failed calls of failback
 func (c *Consumer) Close() error {
+	c.once.Do(func() {
+		close(c.exit)
+	})
 	return nil
 }
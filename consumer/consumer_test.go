@@ -0,0 +1,111 @@
+package consumer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/haormj/dodo/client"
+	"github.com/haormj/dodo/client/rpc"
+	"github.com/haormj/dodo/invoker/receiver"
+	"github.com/haormj/dodo/log"
+	"github.com/haormj/dodo/registry"
+	"github.com/haormj/dodo/registry/memory"
+	"github.com/haormj/dodo/selector/cache"
+	"github.com/haormj/dodo/server"
+	srpc "github.com/haormj/dodo/server/rpc"
+	"github.com/haormj/dodo/transport/tcp"
+)
+
+type Hello struct{}
+
+func (*Hello) SayHello(ctx context.Context, req string, rsp *string) error {
+	*rsp = "hello " + req
+	return nil
+}
+
+func TestConsumer_MemoryRegistry(t *testing.T) {
+	log.SetDummyLogger()
+	address := "127.0.0.1:27324"
+	inv := receiver.NewInvoker(new(Hello))
+	if err := inv.Init(); err != nil {
+		t.Fatal(err)
+	}
+	s := srpc.NewServer(server.Transport(tcp.NewTransport()), server.Address(address))
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register(inv); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	r := memory.NewRegistry()
+	service := registry.Service{
+		Protocol:  "rpc",
+		Address:   address,
+		Name:      "Hello",
+		Version:   "0.1.0",
+		Funcs:     []string{"SayHello"},
+		Codecs:    []string{"json"},
+		Transport: "tcp",
+		Side:      "provider",
+		Timestamp: time.Now().Unix(),
+	}
+	if err := r.Register(service); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "dodo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := NewConsumer(
+		Registry(r),
+		Selector(cache.NewSelector(cache.ConfigDir(dir+"/config"), cache.CacheDir(dir+"/cache"))),
+		Client(rpc.NewClient(client.Transport(tcp.NewTransport()))),
+	)
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var rsp string
+	if err := c.Call(context.Background(), "Hello", "SayHello", "dodo", &rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp != "hello dodo" {
+		t.Errorf("Call() rsp = %v, want %v", rsp, "hello dodo")
+	}
+
+	// deregistered service is removed from selector by watcher
+	if err := r.Deregister(service); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		err := c.Call(context.Background(), "Hello", "SayHello", "dodo", &rsp)
+		if err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Call() succeeded after service is deregistered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// service not in registry is called by address
+	rsp = ""
+	if err := c.Call(context.Background(), "Hello", "SayHello", "dodo", &rsp, WithAddress(address)); err != nil {
+		t.Fatal(err)
+	}
+	if rsp != "hello dodo" {
+		t.Errorf("Call() rsp = %v, want %v", rsp, "hello dodo")
+	}
+}
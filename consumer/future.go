@@ -0,0 +1,90 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+)
+
+// Future is the result of CallAsync, out is filled when it is done
+type Future struct {
+	out    interface{}
+	cancel context.CancelFunc
+
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func newFuture(out interface{}, cancel context.CancelFunc) *Future {
+	return &Future{
+		out:    out,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// complete the future once, it release resources of call, v created
+// by newValue is copied to out if call succeeded, so out is not written
+// after the future is canceled
+func (f *Future) complete(v interface{}, err error) {
+	f.once.Do(func() {
+		if err == nil && v != nil {
+			setValue(f.out, v)
+		}
+		f.err = err
+		f.cancel()
+		close(f.done)
+	})
+}
+
+// Done is closed when call is finished
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result wait for call finished, return out and error of call
+func (f *Future) Result() (interface{}, error) {
+	<-f.done
+	return f.out, f.err
+}
+
+// Cancel the call, Result return context.Canceled
+// if call is not finished
+func (f *Future) Cancel() {
+	f.complete(nil, context.Canceled)
+}
+
+// CallAsync call in a new goroutine through the same interceptors as Call,
+// response is decoded into a new value, and copied to out when succeeded
+func (c *Consumer) CallAsync(ctx context.Context, serviceName string, funcName string,
+	in interface{}, out interface{}, opts ...CallOption) *Future {
+	ctx, cancel := context.WithCancel(ctx)
+	f := newFuture(out, cancel)
+	go func() {
+		v := newValue(out)
+		f.complete(v, c.Call(ctx, serviceName, funcName, in, v, opts...))
+	}()
+	return f
+}
+
+// AwaitAll wait for all futures until ctx is done, unfinished futures are
+// canceled when ctx is done and ctx.Err() is returned, otherwise return
+// the first error of futures, error of each future is got by Result
+func AwaitAll(ctx context.Context, fs ...*Future) error {
+	for _, f := range fs {
+		select {
+		case <-f.Done():
+		case <-ctx.Done():
+			for _, f := range fs {
+				f.Cancel()
+			}
+			return ctx.Err()
+		}
+	}
+	for _, f := range fs {
+		if _, err := f.Result(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/haormj/dodo/invoker"
+)
+
+func TestFuture(t *testing.T) {
+	_, cancel := context.WithCancel(context.Background())
+	out := new(string)
+	f := newFuture(out, cancel)
+	go func() {
+		v := new(string)
+		*v = "hello dodo"
+		f.complete(v, nil)
+	}()
+	<-f.Done()
+	got, err := f.Result()
+	if err != nil || *got.(*string) != "hello dodo" {
+		t.Errorf("Result() = %v, %v, want %v, %v", got, err, "hello dodo", nil)
+	}
+
+	// cancel finished future take no effect
+	f.Cancel()
+	if _, err := f.Result(); err != nil {
+		t.Errorf("Result() err = %v, want %v", err, nil)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f = newFuture(nil, cancel)
+	f.Cancel()
+	if _, err := f.Result(); err != context.Canceled {
+		t.Errorf("Result() err = %v, want %v", err, context.Canceled)
+	}
+	if ctx.Err() != context.Canceled {
+		t.Errorf("ctx.Err() = %v, want %v", ctx.Err(), context.Canceled)
+	}
+}
+
+func TestAwaitAll(t *testing.T) {
+	newTestFuture := func(d time.Duration, err error) *Future {
+		_, cancel := context.WithCancel(context.Background())
+		f := newFuture(nil, cancel)
+		time.AfterFunc(d, func() {
+			f.complete(nil, err)
+		})
+		return f
+	}
+	errSay := errors.New("say error")
+
+	tests := []struct {
+		name    string
+		futures []*Future
+		timeout time.Duration
+		want    error
+	}{
+		{
+			name:    "success",
+			futures: []*Future{newTestFuture(0, nil), newTestFuture(10*time.Millisecond, nil)},
+			timeout: time.Second,
+			want:    nil,
+		},
+		{
+			name:    "error",
+			futures: []*Future{newTestFuture(0, nil), newTestFuture(10*time.Millisecond, errSay)},
+			timeout: time.Second,
+			want:    errSay,
+		},
+		{
+			name:    "deadline",
+			futures: []*Future{newTestFuture(0, nil), newTestFuture(time.Second, nil)},
+			timeout: 10 * time.Millisecond,
+			want:    context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			if err := AwaitAll(ctx, tt.futures...); err != tt.want {
+				t.Errorf("AwaitAll() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsumer_CallAsync(t *testing.T) {
+	release := make(chan struct{})
+	c, cli := newTestConsumer(map[string]func(int) (string, error){
+		"a": func(n int) (string, error) {
+			if n > 1 {
+				<-release
+			}
+			return "hello dodo", nil
+		},
+	})
+	defer c.Close()
+	var intercepted int32
+	count := func(fn invoker.InvokeFunc) invoker.InvokeFunc {
+		return func(ctx context.Context, mi invoker.Message,
+			opts ...invoker.InvokeOption) (invoker.Message, error) {
+			atomic.AddInt32(&intercepted, 1)
+			return fn(ctx, mi, opts...)
+		}
+	}
+	Intercept(count)(&c.opts)
+
+	var rsp string
+	f := c.CallAsync(context.Background(), "Hello", "SayHello", "dodo", &rsp, WithInterceptor(count))
+	out, err := f.Result()
+	if err != nil || *out.(*string) != "hello dodo" || rsp != "hello dodo" {
+		t.Errorf("Result() = %v, %v, want %v, %v", rsp, err, "hello dodo", nil)
+	}
+	if n := atomic.LoadInt32(&intercepted); n != 2 {
+		t.Errorf("intercepted = %v, want %v", n, 2)
+	}
+
+	// canceled call does not write out after Result
+	var canceled string
+	f = c.CallAsync(context.Background(), "Hello", "SayHello", "dodo", &canceled)
+	for cli.total() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	f.Cancel()
+	if _, err := f.Result(); err != context.Canceled {
+		t.Errorf("Result() err = %v, want %v", err, context.Canceled)
+	}
+	close(release)
+	deadline := time.Now().Add(20 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		if canceled != "" {
+			t.Fatalf("out = %v after Cancel, want empty", canceled)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package consumer
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/haormj/dodo/registry"
+	"github.com/haormj/dodo/util"
+)
+
+// HedgePolicy decide when hedged request is sent, it is used by hedging
+type HedgePolicy struct {
+	// MaxAttempts include the first request, less than 2 means no hedging
+	MaxAttempts int
+	// Delay after which the next request is sent to another service
+	Delay time.Duration
+	// Percentile of recent latencies of the func is used as delay
+	// instead of Delay when it is in (0, 1) and there are at
+	// least MinSamples samples, e.g. 0.95
+	Percentile float64
+	MinSamples int
+}
+
+// DefaultHedgePolicy send the second request after p95 latency
+var DefaultHedgePolicy = HedgePolicy{
+	MaxAttempts: 2,
+	Delay:       100 * time.Millisecond,
+	Percentile:  0.95,
+	MinSamples:  20,
+}
+
+// LatencySamples is the number of recent latencies kept for each func
+var LatencySamples = 128
+
+// latencyRing keep recent latencies of one func
+type latencyRing struct {
+	samples []time.Duration
+	next    int
+}
+
+// latencies of funcs, key is service.funcName
+type latencies struct {
+	sync.Mutex
+	m map[string]*latencyRing
+}
+
+func newLatencies() *latencies {
+	return &latencies{
+		m: make(map[string]*latencyRing),
+	}
+}
+
+func (l *latencies) observe(name string, d time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	r, ok := l.m[name]
+	if !ok {
+		r = new(latencyRing)
+		l.m[name] = r
+	}
+	if len(r.samples) < LatencySamples {
+		r.samples = append(r.samples, d)
+		return
+	}
+	r.samples[r.next] = d
+	r.next = (r.next + 1) % len(r.samples)
+}
+
+// percentile get the p percentile of latencies, false if
+// there are less than min samples
+func (l *latencies) percentile(name string, p float64, min int) (time.Duration, bool) {
+	l.Lock()
+	r, ok := l.m[name]
+	var samples []time.Duration
+	if ok {
+		samples = append(samples, r.samples...)
+	}
+	l.Unlock()
+	if len(samples) == 0 || len(samples) < min {
+		return 0, false
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	i := int(p * float64(len(samples)))
+	if i >= len(samples) {
+		i = len(samples) - 1
+	}
+	return samples[i], true
+}
+
+// delay get the delay before the next hedged request of funcName
+func (c *Consumer) delay(serviceName string, funcName string, policy HedgePolicy) time.Duration {
+	if policy.Percentile > 0 && policy.Percentile < 1 {
+		d, ok := c.latencies.percentile(serviceName+"."+funcName, policy.Percentile, policy.MinSamples)
+		if ok {
+			return d
+		}
+	}
+	return policy.Delay
+}
+
+// hedging send request to another service if no response is got after
+// delay, or immediately if the request failed with retryable error, the
+// first success wins and the others are canceled, func not advertised
+// as idempotent by provider is called only once
+func (c *Consumer) hedging(ctx context.Context, serviceName string, funcName string,
+	in interface{}, out interface{}, callOpts CallOptions) error {
+	service, err := c.selectService(ctx, serviceName, callOpts, nil)
+	if err != nil {
+		return err
+	}
+	policy := callOpts.Hedge
+	if policy.MaxAttempts < 2 || !registry.IsIdempotent(service, funcName) {
+		return c.call(ctx, service, funcName, in, out, callOpts)
+	}
+
+	// cancel the others when one succeeded
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch := make(chan result, policy.MaxAttempts)
+	var excludes []string
+	pending := 0
+	send := func(service registry.Service) {
+		excludes = append(excludes, service.Address)
+		pending++
+		go func() {
+			rsp := newValue(out)
+			err := c.call(ctx, service, funcName, in, rsp, callOpts)
+			ch <- result{out: rsp, err: err}
+		}()
+	}
+	// next send request to another service, false if there is none
+	next := func() bool {
+		if len(excludes) >= policy.MaxAttempts {
+			return false
+		}
+		service, serr := c.selectService(ctx, serviceName, callOpts, excludes)
+		if serr != nil || util.ArrayContainsString(excludes, service.Address) {
+			return false
+		}
+		send(service)
+		return true
+	}
+
+	d := c.delay(serviceName, funcName, policy)
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	send(service)
+	for {
+		select {
+		case r := <-ch:
+			pending--
+			if r.err == nil {
+				setValue(out, r.out)
+				return nil
+			}
+			err = r.err
+			// failed before delay, no need to wait
+			if callOpts.Retry.retryable(err) && ctx.Err() == nil && next() {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(d)
+				continue
+			}
+			if pending == 0 {
+				return err
+			}
+		case <-timer.C:
+			if next() {
+				timer.Reset(d)
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package consumer
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/haormj/dodo/errors"
+)
+
+func TestLatencies_percentile(t *testing.T) {
+	l := newLatencies()
+	if _, ok := l.percentile("Hello.SayHello", 0.9, 1); ok {
+		t.Errorf("percentile() ok = %v, want %v", ok, false)
+	}
+	for i := 1; i <= 100; i++ {
+		l.observe("Hello.SayHello", time.Duration(i)*time.Millisecond)
+	}
+	tests := []struct {
+		p    float64
+		min  int
+		want time.Duration
+		ok   bool
+	}{
+		{0.5, 10, 51 * time.Millisecond, true},
+		{0.95, 10, 96 * time.Millisecond, true},
+		{0.99, 200, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := l.percentile("Hello.SayHello", tt.p, tt.min)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("percentile(%v) = %v %v, want %v %v", tt.p, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestConsumer_Hedging(t *testing.T) {
+	policy := HedgePolicy{MaxAttempts: 2, Delay: 20 * time.Millisecond}
+	tests := []struct {
+		name     string
+		funcName string
+		want     string
+		calls    int
+	}{
+		{"hedged", "SayHello", "fast", 2},
+		{"not idempotent", "SayBye", "slow", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the first request is slow, the others are fast
+			var n int32
+			handler := func(int) (string, error) {
+				if atomic.AddInt32(&n, 1) == 1 {
+					time.Sleep(200 * time.Millisecond)
+					return "slow", nil
+				}
+				return "fast", nil
+			}
+			c, cli := newTestConsumer(map[string]func(int) (string, error){"a": handler, "b": handler})
+			defer c.Close()
+			var rsp string
+			err := c.Call(context.Background(), "Hello", tt.funcName, "hello", &rsp,
+				WithCluster(Hedging), WithHedge(policy))
+			if err != nil {
+				t.Errorf("Call() err = %v, want %v", err, nil)
+			}
+			if rsp != tt.want {
+				t.Errorf("Call() rsp = %v, want %v", rsp, tt.want)
+			}
+			if got := cli.total(); got != tt.calls {
+				t.Errorf("Call() calls = %v, want %v", got, tt.calls)
+			}
+		})
+	}
+}
+
+func TestConsumer_HedgingFailure(t *testing.T) {
+	// the first request fails fast, the next one is sent without delay
+	var n int32
+	handler := func(int) (string, error) {
+		if atomic.AddInt32(&n, 1) == 1 {
+			return "", errors.New(errors.Unavailable, "unavailable")
+		}
+		return "ok", nil
+	}
+	c, cli := newTestConsumer(map[string]func(int) (string, error){"a": handler, "b": handler})
+	defer c.Close()
+	policy := HedgePolicy{MaxAttempts: 2, Delay: time.Second}
+	start := time.Now()
+	var rsp string
+	if err := c.Call(context.Background(), "Hello", "SayHello", "hello", &rsp,
+		WithCluster(Hedging), WithHedge(policy)); err != nil {
+		t.Errorf("Call() err = %v, want %v", err, nil)
+	}
+	if rsp != "ok" {
+		t.Errorf("Call() rsp = %v, want %v", rsp, "ok")
+	}
+	if d := time.Since(start); d >= policy.Delay {
+		t.Errorf("Call() took %v, want less than %v", d, policy.Delay)
+	}
+	if got := cli.total(); got != 2 {
+		t.Errorf("Call() calls = %v, want %v", got, 2)
+	}
+
+	// handler error is returned without hedging
+	handler = func(int) (string, error) {
+		return "", errors.New(errors.HandlerError, "say error")
+	}
+	c, cli = newTestConsumer(map[string]func(int) (string, error){"a": handler, "b": handler})
+	defer c.Close()
+	err := c.Call(context.Background(), "Hello", "SayHello", "hello", &rsp,
+		WithCluster(Hedging), WithHedge(policy))
+	if !errors.Is(err, errors.HandlerError) {
+		t.Errorf("Call() err = %v, want %v", err, errors.HandlerError)
+	}
+	if got := cli.total(); got != 1 {
+		t.Errorf("Call() calls = %v, want %v", got, 1)
+	}
+}
+
+func TestConsumer_Latency(t *testing.T) {
+	// latencies of calls of all cluster modes are recorded
+	c, _ := newTestConsumer(map[string]func(int) (string, error){"a": success("a")})
+	defer c.Close()
+	for i := 0; i < 3; i++ {
+		var rsp string
+		if err := c.Call(context.Background(), "Hello", "SayBye", "hello", &rsp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := c.latencies.percentile("Hello.SayBye", 0.5, 3); !ok {
+		t.Errorf("percentile() ok = %v, want %v", ok, true)
+	}
+}
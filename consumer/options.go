@@ -20,19 +20,45 @@ type Options struct {
 	Clients      []client.Client
 	Selector     selector.Selector
 	Interceptors []invoker.Interceptor
+	// RetryBudget is shared by all calls
+	RetryBudget *RetryBudget
 
 	CallOptions CallOptions
 }
 
 type Option func(*Options)
 
+var (
+	// DefaultRetryRatio is the ratio of retries to calls of retry budget
+	DefaultRetryRatio = 0.2
+	// DefaultRetryBurst is the max retries without new calls
+	DefaultRetryBurst = 10
+)
+
 type CallOptions struct {
 	// Address of remote host
 	Address   string
 	TLSConfig *tls.Config
+	// Codec used to call, it must be supported by client and provider
+	Codec string
 	// Middleware for low level call func
 	Interceptors []invoker.Interceptor
 	Filters      []selector.Filter
+	// Strategy used to select service rather than the
+	// default strategy of selector, e.g selector.LeastActive
+	Strategy selector.Strategy
+	// HashKey select service by consistent hash, requests with the
+	// same key are sent to the same service, HashMetadata is the
+	// name of metadata entry used as key if HashKey is empty
+	HashKey      string
+	HashMetadata string
+	// Cluster mode decide how to call services and handle failure,
+	// Retry is used by failover and failback, Forks is used by forking,
+	// Hedge is used by hedging
+	Cluster ClusterMode
+	Retry   RetryPolicy
+	Forks   int
+	Hedge   HedgePolicy
 }
 
 type CallOption func(*CallOptions)
@@ -41,6 +67,12 @@ func newOptions(opts ...Option) Options {
 	options := Options{
 		Registry: etcd.NewRegistry(),
 		Selector: cache.NewSelector(),
+		CallOptions: CallOptions{
+			Cluster: Failfast,
+			Retry:   DefaultRetryPolicy,
+			Forks:   2,
+			Hedge:   DefaultHedgePolicy,
+		},
 	}
 
 	for _, o := range opts {
@@ -51,6 +83,10 @@ func newOptions(opts ...Option) Options {
 		options.Clients = append(options.Clients, rpc.NewClient())
 	}
 
+	if options.RetryBudget == nil {
+		options.RetryBudget = NewRetryBudget(DefaultRetryRatio, DefaultRetryBurst)
+	}
+
 	if len(options.Codecs) == 0 {
 		options.Codecs = append(options.Codecs, json.NewCodec())
 	}
@@ -88,6 +124,34 @@ func Intercept(i ...invoker.Interceptor) Option {
 	}
 }
 
+// Cluster sets the default cluster mode
+func Cluster(m ClusterMode) Option {
+	return func(o *Options) {
+		o.CallOptions.Cluster = m
+	}
+}
+
+// Retry sets the default retry policy of failover and failback
+func Retry(p RetryPolicy) Option {
+	return func(o *Options) {
+		o.CallOptions.Retry = p
+	}
+}
+
+// Budget sets the retry budget shared by all calls
+func Budget(b *RetryBudget) Option {
+	return func(o *Options) {
+		o.RetryBudget = b
+	}
+}
+
+// Forks sets the default number of parallel calls of forking
+func Forks(n int) Option {
+	return func(o *Options) {
+		o.CallOptions.Forks = n
+	}
+}
+
 // WithAddress sets the remote address to use rather than using service discovery
 func WithAddress(a string) CallOption {
 	return func(o *CallOptions) {
@@ -95,6 +159,14 @@ func WithAddress(a string) CallOption {
 	}
 }
 
+// WithCodec sets the codec to use rather than the first codec
+// supported by both client and provider, e.g proto
+func WithCodec(c string) CallOption {
+	return func(o *CallOptions) {
+		o.Codec = c
+	}
+}
+
 func WithTLSConfig(t *tls.Config) CallOption {
 	return func(o *CallOptions) {
 		o.TLSConfig = t
@@ -119,3 +191,60 @@ func FilterVersion(version string) CallOption {
 		o.Filters = append(o.Filters, selector.FilterVersion(version))
 	}
 }
+
+// WithStrategy sets the strategy used to select service
+func WithStrategy(fn selector.Strategy) CallOption {
+	return func(o *CallOptions) {
+		o.Strategy = fn
+	}
+}
+
+// WithHashKey sets the key of consistent hash strategy
+func WithHashKey(key string) CallOption {
+	return func(o *CallOptions) {
+		o.HashKey = key
+	}
+}
+
+// WithHashMetadata sets the metadata entry used as
+// the key of consistent hash strategy
+func WithHashMetadata(name string) CallOption {
+	return func(o *CallOptions) {
+		o.HashMetadata = name
+	}
+}
+
+// WithCluster sets the cluster mode of call
+func WithCluster(m ClusterMode) CallOption {
+	return func(o *CallOptions) {
+		o.Cluster = m
+	}
+}
+
+// WithRetry sets the retry policy of failover and failback
+func WithRetry(p RetryPolicy) CallOption {
+	return func(o *CallOptions) {
+		o.Retry = p
+	}
+}
+
+// WithForks sets the number of parallel calls of forking
+func WithForks(n int) CallOption {
+	return func(o *CallOptions) {
+		o.Forks = n
+	}
+}
+
+// Hedge sets the default hedge policy of hedging
+func Hedge(p HedgePolicy) Option {
+	return func(o *Options) {
+		o.CallOptions.Hedge = p
+	}
+}
+
+// WithHedge sets the hedge policy of hedging
+func WithHedge(p HedgePolicy) CallOption {
+	return func(o *CallOptions) {
+		o.Hedge = p
+	}
+}
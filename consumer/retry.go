@@ -0,0 +1,111 @@
+package consumer
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/haormj/dodo/errors"
+)
+
+// RetryPolicy decide whether and when a failed call is retried,
+// it is used by failover and failback, only idempotent funcs
+// advertised by provider are retried
+type RetryPolicy struct {
+	// MaxAttempts include the first call, less than 2 means no retry
+	MaxAttempts int
+	// backoff of the nth retry is InitialBackoff*Multiplier^(n-1),
+	// no more than MaxBackoff, and randomized by ±Jitter of it
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+	// RetryableCodes are codes of error which can be retried, error
+	// returned by handler should not be retried
+	RetryableCodes []errors.ErrorCode
+}
+
+// DefaultRetryPolicy retry transport errors at most twice
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+	RetryableCodes: []errors.ErrorCode{
+		errors.Unavailable,
+		errors.ServiceNotFound,
+		errors.Overloaded,
+	},
+}
+
+// retryable judge whether err can be retried
+func (p RetryPolicy) retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	code := errors.Code(err)
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff get the backoff before the nth retry, n start from 1
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < n && d < float64(p.MaxBackoff); i++ {
+		d *= p.Multiplier
+	}
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(d)
+}
+
+// RetryBudget limit retries to a ratio of calls, so retries will not
+// overload providers, every call deposit ratio token, every retry
+// withdraw one token, tokens are no more than max
+type RetryBudget struct {
+	ratio float64
+	max   float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+// NewRetryBudget create budget with ratio of retries to calls,
+// at most max retries can be made without new calls
+func NewRetryBudget(ratio float64, max int) *RetryBudget {
+	return &RetryBudget{
+		ratio:  ratio,
+		max:    float64(max),
+		tokens: float64(max),
+	}
+}
+
+// deposit is called for every call
+func (b *RetryBudget) deposit() {
+	b.mu.Lock()
+	b.tokens += b.ratio
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+	b.mu.Unlock()
+}
+
+// withdraw is called before retry, false means budget is exhausted
+func (b *RetryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,113 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/haormj/dodo/errors"
+)
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     100 * time.Millisecond,
+		Multiplier:     2,
+	}
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{1, 10 * time.Millisecond},
+		{2, 20 * time.Millisecond},
+		{3, 40 * time.Millisecond},
+		{5, 100 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := p.backoff(tt.n); got != tt.want {
+			t.Errorf("backoff(%v) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+
+	p.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(2); got < 16*time.Millisecond || got > 24*time.Millisecond {
+			t.Errorf("backoff(2) = %v, want in [16ms, 24ms]", got)
+		}
+	}
+}
+
+func TestRetryPolicy_retryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"unavailable", errors.New(errors.Unavailable, "unavailable"), true},
+		{"unknown", errors.New(errors.Unknown, "unknown"), false},
+		{"handler", errors.New(errors.HandlerError, "handler"), false},
+		{"deadline", errors.New(errors.DeadlineExceeded, "deadline"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultRetryPolicy.retryable(tt.err); got != tt.want {
+				t.Errorf("retryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := NewRetryBudget(0.5, 2)
+	for i, want := range []bool{true, true, false} {
+		if got := b.withdraw(); got != want {
+			t.Errorf("withdraw() %v = %v, want %v", i, got, want)
+		}
+	}
+	b.deposit()
+	if b.withdraw() {
+		t.Errorf("withdraw() = true after half token, want false")
+	}
+	b.deposit()
+	b.deposit()
+	if !b.withdraw() {
+		t.Errorf("withdraw() = false after one token, want true")
+	}
+}
+
+func TestConsumer_Retry(t *testing.T) {
+	unavailable := failure(errors.Unavailable)
+	handlers := map[string]func(int) (string, error){"a": unavailable, "b": unavailable, "c": unavailable}
+	policy := DefaultRetryPolicy
+	policy.InitialBackoff = time.Millisecond
+	tests := []struct {
+		name     string
+		funcName string
+		opts     []Option
+		calls    int
+	}{
+		{"idempotent", "SayHello", nil, 3},
+		{"not idempotent", "SayBye", nil, 1},
+		{"budget exhausted", "SayHello", []Option{Budget(NewRetryBudget(0.1, 1))}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, cli := newTestConsumer(handlers)
+			defer c.Close()
+			for _, o := range tt.opts {
+				o(&c.opts)
+			}
+			var rsp string
+			err := c.Call(context.Background(), "Hello", tt.funcName, "hello", &rsp,
+				WithCluster(Failover), WithRetry(policy))
+			if !errors.Is(err, errors.Unavailable) {
+				t.Errorf("Call() err = %v, want %v", err, errors.Unavailable)
+			}
+			if got := cli.total(); got != tt.calls {
+				t.Errorf("Call() calls = %v, want %v", got, tt.calls)
+			}
+		})
+	}
+}
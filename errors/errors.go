@@ -0,0 +1,156 @@
+// Package errors provides error with code, which can be transferred
+// between consumer and provider, so caller can distinguish the failure
+// path of framework from the error returned by handler.
+package errors
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// ErrorCode of error
+type ErrorCode int
+
+const (
+	// OK is not an error
+	OK ErrorCode = iota
+	// Unknown error, e.g. error not created by this package
+	Unknown
+	// ServiceNotFound service is not registered in server
+	ServiceNotFound
+	// FuncNotFound function is not found in service
+	FuncNotFound
+	// CodecNotFound codec is not supported by server or client
+	CodecNotFound
+	// CompressorNotFound compressor is not supported by server or client
+	CompressorNotFound
+	// DecodeError request or response can not be decoded
+	DecodeError
+	// EncodeError request or response can not be encoded
+	EncodeError
+	// HandlerError error returned by handler
+	HandlerError
+	// Internal panic or other unexpected error of server
+	Internal
+	// Unavailable connection can not be established or is broken
+	Unavailable
+	// DeadlineExceeded remaining time of caller is exhausted
+	DeadlineExceeded
+	// Canceled request is canceled by caller
+	Canceled
+	// Unimplemented call type is not supported, e.g. call streaming
+	// function by Call, or stream by client without streaming support
+	Unimplemented
+	// CircuitOpen call is rejected by circuit breaker of caller
+	CircuitOpen
+	// ResourceExhausted call is rejected by rate limit
+	ResourceExhausted
+	// Overloaded call is shed by server because of overload, it is not
+	// executed, so it can be retried on other provider
+	Overloaded
+)
+
+var codeNames = map[ErrorCode]string{
+	OK:                 "OK",
+	Unknown:            "Unknown",
+	ServiceNotFound:    "ServiceNotFound",
+	FuncNotFound:       "FuncNotFound",
+	CodecNotFound:      "CodecNotFound",
+	CompressorNotFound: "CompressorNotFound",
+	DecodeError:        "DecodeError",
+	EncodeError:        "EncodeError",
+	HandlerError:       "HandlerError",
+	Internal:           "Internal",
+	Unavailable:        "Unavailable",
+	DeadlineExceeded:   "DeadlineExceeded",
+	Canceled:           "Canceled",
+	Unimplemented:      "Unimplemented",
+	CircuitOpen:        "CircuitOpen",
+	ResourceExhausted:  "ResourceExhausted",
+	Overloaded:         "Overloaded",
+}
+
+func (c ErrorCode) String() string {
+	if s, ok := codeNames[c]; ok {
+		return s
+	}
+	return "ErrorCode(" + strconv.Itoa(int(c)) + ")"
+}
+
+// Error with code, message and details
+type Error struct {
+	Code    ErrorCode         `json:"code"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// New error with code and message
+func New(code ErrorCode, msg string) *Error {
+	return &Error{
+		Code:    code,
+		Message: msg,
+	}
+}
+
+// Newf error with code and formatted message
+func Newf(code ErrorCode, format string, a ...interface{}) *Error {
+	return New(code, fmt.Sprintf(format, a...))
+}
+
+// Error return message only, so it is same as the error returned by handler
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// WithDetail set detail of error, and return itself
+func (e *Error) WithDetail(k, v string) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]string)
+	}
+	e.Details[k] = v
+	return e
+}
+
+// FromError convert err to *Error, the code of err not created
+// by this package is decided by def
+func FromError(err error, def ErrorCode) *Error {
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+	switch err {
+	case context.DeadlineExceeded:
+		return New(DeadlineExceeded, err.Error())
+	case context.Canceled:
+		return New(Canceled, err.Error())
+	}
+	return New(def, err.Error())
+}
+
+// Code get code of err, nil is OK, context errors have their own code,
+// and Unknown is returned for other errors not created by this package
+func Code(err error) ErrorCode {
+	if err == nil {
+		return OK
+	}
+	return FromError(err, Unknown).Code
+}
+
+// Is judge whether the code of err is code
+func Is(err error, code ErrorCode) bool {
+	return Code(err) == code
+}
+
+// IsFailure judge whether err means the provider is unhealthy, errors
+// of transport and server are failures, errors returned by handler or
+// caused by caller are not
+func IsFailure(err error) bool {
+	switch Code(err) {
+	case Unknown, Unavailable, DeadlineExceeded, Internal, ServiceNotFound:
+		return true
+	}
+	return false
+}
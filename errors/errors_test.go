@@ -0,0 +1,50 @@
+package errors
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCode
+	}{
+		{"nil", nil, OK},
+		{"typed", New(FuncNotFound, "not find func"), FuncNotFound},
+		{"deadline", context.DeadlineExceeded, DeadlineExceeded},
+		{"canceled", context.Canceled, Canceled},
+		{"other", errors.New("other"), Unknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Code(tt.err); got != tt.want {
+				t.Errorf("Code() = %v, want %v", got, tt.want)
+			}
+			if got := Is(tt.err, tt.want); !got {
+				t.Errorf("Is() = %v, want %v", got, true)
+			}
+		})
+	}
+}
+
+func TestFromError(t *testing.T) {
+	if got := FromError(nil, Internal); got != nil {
+		t.Errorf("FromError() = %v, want %v", got, nil)
+	}
+	e := FromError(errors.New("say error"), HandlerError)
+	if e.Code != HandlerError || e.Error() != "say error" {
+		t.Errorf("FromError() = %#v, want code %v and message %v", e, HandlerError, "say error")
+	}
+}
+
+func TestErrorCode_String(t *testing.T) {
+	if got := ServiceNotFound.String(); got != "ServiceNotFound" {
+		t.Errorf("String() = %v, want %v", got, "ServiceNotFound")
+	}
+	if got := ErrorCode(100).String(); got != "ErrorCode(100)" {
+		t.Errorf("String() = %v, want %v", got, "ErrorCode(100)")
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/haormj/dodo/client/rest"
+)
+
+func main() {
+	c := rest.NewClient()
+	if err := c.Init(); err != nil {
+		log.Fatalln(err)
+	}
+	req := "hello"
+	rsp := ""
+	if err := c.Call(context.Background(), "127.0.0.1:17313", "Hello", "SayHello",
+		&req, &rsp); err != nil {
+		log.Fatalln(err)
+	}
+	log.Println(rsp)
+}
@@ -0,0 +1,107 @@
+// Package queue provides the bounded queue of stream messages shared by
+// rpc client and server. Push never block the reader of connection, the
+// stream whose queue is full is failed with ErrFull, so one slow stream
+// will not block other requests on the same connection.
+package queue
+
+import (
+	"context"
+	"sync"
+
+	"github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/transport"
+)
+
+// DefaultSize is the max number of messages not received in one stream
+var DefaultSize = 256
+
+var (
+	// ErrClosed is returned by Pop after queue or connection is closed
+	ErrClosed = errors.New(errors.Canceled, "stream closed")
+	// ErrFull is returned by Push and Pop after messages not received
+	// exceed the size of queue
+	ErrFull = errors.New(errors.ResourceExhausted, "too many messages not received in stream")
+)
+
+// Queue of messages of one stream
+type Queue struct {
+	msgs chan transport.Message
+	once sync.Once
+	done chan struct{}
+	// err is the reason of close
+	err error
+}
+
+// New create queue which can hold size messages
+func New(size int) *Queue {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	return &Queue{
+		msgs: make(chan transport.Message, size),
+		done: make(chan struct{}),
+	}
+}
+
+// Push put m into queue without waiting, queue is closed with ErrFull
+// if it is full, m is dropped if queue is closed
+func (q *Queue) Push(m transport.Message) error {
+	select {
+	case <-q.done:
+		return q.err
+	default:
+	}
+	select {
+	case q.msgs <- m:
+		return nil
+	default:
+		q.close(ErrFull)
+		return ErrFull
+	}
+}
+
+// Pop wait for message until ctx is done, or queue or closed is closed,
+// messages pushed before closed are still got
+func (q *Queue) Pop(ctx context.Context, closed <-chan struct{}) (transport.Message, error) {
+	select {
+	case m := <-q.msgs:
+		return m, nil
+	default:
+	}
+	select {
+	case m := <-q.msgs:
+		return m, nil
+	case <-ctx.Done():
+		return transport.Message{}, ctx.Err()
+	case <-q.done:
+	case <-closed:
+	}
+	select {
+	case m := <-q.msgs:
+		return m, nil
+	default:
+		return transport.Message{}, q.Err()
+	}
+}
+
+// Err get the reason of close, ErrClosed if it is not closed by Push
+func (q *Queue) Err() error {
+	select {
+	case <-q.done:
+		return q.err
+	default:
+		return ErrClosed
+	}
+}
+
+// Close wake up Pop, it can be called more than once
+func (q *Queue) Close() {
+	q.close(ErrClosed)
+}
+
+func (q *Queue) close(err error) {
+	q.once.Do(func() {
+		q.err = err
+		close(q.done)
+	})
+}
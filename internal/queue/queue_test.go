@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/haormj/dodo/transport"
+)
+
+func message(id string) transport.Message {
+	return transport.Message{Header: map[string]string{"Id": id}}
+}
+
+func TestQueue(t *testing.T) {
+	q := New(2)
+	for _, id := range []string{"1", "2"} {
+		if err := q.Push(message(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"1", "2"} {
+		m, err := q.Pop(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.Header["Id"]; got != want {
+			t.Errorf("Pop() = %v, want %v", got, want)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := q.Pop(ctx, nil); err != context.Canceled {
+		t.Errorf("Pop() err = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestQueue_Full(t *testing.T) {
+	q := New(1)
+	q.Push(message("1"))
+	// push to full queue is not blocked, the queue is failed
+	if err := q.Push(message("2")); err != ErrFull {
+		t.Errorf("Push() err = %v, want %v", err, ErrFull)
+	}
+	if err := q.Push(message("3")); err != ErrFull {
+		t.Errorf("Push() err = %v, want %v", err, ErrFull)
+	}
+	// message pushed before failed is still got
+	if m, err := q.Pop(context.Background(), nil); err != nil || m.Header["Id"] != "1" {
+		t.Errorf("Pop() = %v, %v, want %v", m, err, "1")
+	}
+	if _, err := q.Pop(context.Background(), nil); err != ErrFull {
+		t.Errorf("Pop() err = %v, want %v", err, ErrFull)
+	}
+	// close after failed keep the error
+	q.Close()
+	if err := q.Err(); err != ErrFull {
+		t.Errorf("Err() = %v, want %v", err, ErrFull)
+	}
+}
+
+func TestQueue_Close(t *testing.T) {
+	q := New(1)
+	q.Close()
+	q.Close()
+	if err := q.Push(message("1")); err != ErrClosed {
+		t.Errorf("Push() err = %v, want %v", err, ErrClosed)
+	}
+	if _, err := q.Pop(context.Background(), nil); err != ErrClosed {
+		t.Errorf("Pop() err = %v, want %v", err, ErrClosed)
+	}
+
+	closed := make(chan struct{})
+	close(closed)
+	if _, err := New(1).Pop(context.Background(), closed); err != ErrClosed {
+		t.Errorf("Pop() err = %v, want %v", err, ErrClosed)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -29,6 +30,8 @@ type funcType struct {
 	CtxType    reflect.Type
 	InputType  reflect.Type
 	OutputType reflect.Type
+	// StreamType is not nil for streaming function
+	StreamType reflect.Type
 	ErrType    reflect.Type
 }
 
@@ -36,8 +39,16 @@ func (f funcType) FuncName() string {
 	return f.funcName
 }
 
+// In is ctx, input, output for unary function,
+// ctx, [input,] stream for streaming function
 func (f funcType) In() []reflect.Type {
-	return []reflect.Type{f.CtxType, f.InputType, f.OutputType}
+	if f.StreamType == nil {
+		return []reflect.Type{f.CtxType, f.InputType, f.OutputType}
+	}
+	if f.InputType == nil {
+		return []reflect.Type{f.CtxType, f.StreamType}
+	}
+	return []reflect.Type{f.CtxType, f.InputType, f.StreamType}
 }
 
 func (f funcType) Out() []reflect.Type {
@@ -55,9 +66,10 @@ func suitableFunc(typ reflect.Type, name string) (funcType, error) {
 	mtype := typ
 	mname := name
 	var ft funcType
-	// Method needs four ins: receiver, ctx, input, output
-	if mtype.NumIn() != 3 {
-		s := "method " + mname + " has wrong number of ins:" + string(mtype.NumIn())
+	// Function needs three ins: ctx, input, output,
+	// streaming function needs ctx, [input,] stream
+	if mtype.NumIn() != 2 && mtype.NumIn() != 3 {
+		s := "method " + mname + " has wrong number of ins:" + strconv.Itoa(mtype.NumIn())
 		log.Error(s)
 		return ft, errors.New(s)
 	}
@@ -68,29 +80,41 @@ func suitableFunc(typ reflect.Type, name string) (funcType, error) {
 		log.Error(s)
 		return ft, errors.New(s)
 	}
-	// Second arg need not be a pointer.
-	inputType := mtype.In(1)
-	if !isExportedOrBuiltinType(inputType) {
-		s := mname + "argument type not exported:" + inputType.String()
+	var inputType, outputType, streamType reflect.Type
+	if last := mtype.In(mtype.NumIn() - 1); last == invoker.TypeOfStream {
+		streamType = last
+	} else if mtype.NumIn() != 3 {
+		s := "method " + mname + " has wrong number of ins:" + strconv.Itoa(mtype.NumIn())
 		log.Error(s)
 		return ft, errors.New(s)
 	}
-	// Output type must be exported.
-	outputType := mtype.In(2)
-	if outputType.Kind() != reflect.Ptr {
-		s := "method " + mname + " reply type not a pointer:" + outputType.String()
-		log.Error(s)
-		return ft, errors.New(s)
+	// Second arg need not be a pointer.
+	if mtype.NumIn() == 3 {
+		inputType = mtype.In(1)
+		if !isExportedOrBuiltinType(inputType) {
+			s := mname + "argument type not exported:" + inputType.String()
+			log.Error(s)
+			return ft, errors.New(s)
+		}
 	}
-	// Output type must be exported.
-	if !isExportedOrBuiltinType(outputType) {
-		s := "method " + mname + " reply type not exported:" + outputType.String()
-		log.Error(s)
-		return ft, errors.New(s)
+	if streamType == nil {
+		// Output type must be exported.
+		outputType = mtype.In(2)
+		if outputType.Kind() != reflect.Ptr {
+			s := "method " + mname + " reply type not a pointer:" + outputType.String()
+			log.Error(s)
+			return ft, errors.New(s)
+		}
+		// Output type must be exported.
+		if !isExportedOrBuiltinType(outputType) {
+			s := "method " + mname + " reply type not exported:" + outputType.String()
+			log.Error(s)
+			return ft, errors.New(s)
+		}
 	}
 	// Method needs one out.
 	if mtype.NumOut() != 1 {
-		s := "method " + mname + " has wrong number of outs:" + string(mtype.NumOut())
+		s := "method " + mname + " has wrong number of outs:" + strconv.Itoa(mtype.NumOut())
 		log.Error(s)
 		return ft, errors.New(s)
 	}
@@ -107,6 +131,7 @@ func suitableFunc(typ reflect.Type, name string) (funcType, error) {
 		CtxType:    ctxType,
 		InputType:  inputType,
 		OutputType: outputType,
+		StreamType: streamType,
 		ErrType:    errType,
 	}
 	return ft, nil
@@ -187,8 +212,8 @@ func (f *Invoker) invoke(c context.Context, mi invoker.Message,
 		return mo, errors.New(s)
 	}
 	params := mi.Parameters()
-	if len(params) != 3 {
-		s := fmt.Sprintf("parameters must be 3, now %d", len(params))
+	if n := len(f.ft.In()); len(params) != n {
+		s := fmt.Sprintf("parameters must be %d, now %d", n, len(params))
 		log.Error(s)
 		return mo, errors.New(s)
 	}
@@ -31,6 +31,29 @@ type Function interface {
 	Out() []reflect.Type
 }
 
+// Stream is used by streaming function to send and receive messages,
+// streaming function is func(ctx, Stream) error for bidirectional
+// streaming or func(ctx, req, Stream) error for server streaming.
+// Recv return io.EOF when the other side has no more message.
+type Stream interface {
+	Context() context.Context
+	Send(interface{}) error
+	Recv(interface{}) error
+}
+
+// TypeOfStream is the reflect type of Stream
+var TypeOfStream = reflect.TypeOf((*Stream)(nil)).Elem()
+
+// IsStream report whether f is a streaming function
+func IsStream(f Function) bool {
+	in := f.In()
+	return len(in) > 0 && in[len(in)-1] == TypeOfStream
+}
+
+// ServiceNameAttachment is the attachment of message holding the name
+// of called service, so interceptors can tell services apart
+const ServiceNameAttachment = "dodo-service-name"
+
 type InvokeFunc func(context.Context, Message, ...InvokeOption) (Message, error)
 
 type Interceptor func(InvokeFunc) InvokeFunc
@@ -31,6 +31,8 @@ type methodType struct {
 	CtxType    reflect.Type
 	InputType  reflect.Type
 	OutputType reflect.Type
+	// StreamType is not nil for streaming method
+	StreamType reflect.Type
 	ErrType    reflect.Type
 }
 
@@ -38,8 +40,16 @@ func (m *methodType) FuncName() string {
 	return m.method.Name
 }
 
+// In is ctx, input, output for unary method,
+// ctx, [input,] stream for streaming method
 func (m *methodType) In() []reflect.Type {
-	return []reflect.Type{m.CtxType, m.InputType, m.OutputType}
+	if m.StreamType == nil {
+		return []reflect.Type{m.CtxType, m.InputType, m.OutputType}
+	}
+	if m.InputType == nil {
+		return []reflect.Type{m.CtxType, m.StreamType}
+	}
+	return []reflect.Type{m.CtxType, m.InputType, m.StreamType}
 }
 
 func (m *methodType) Out() []reflect.Type {
@@ -119,8 +129,9 @@ func suitableMethods(typ reflect.Type, reportErr bool) map[string]*methodType {
 		if method.PkgPath != "" {
 			continue
 		}
-		// Method needs four ins: receiver, ctx, input, output
-		if mtype.NumIn() != 4 {
+		// Method needs four ins: receiver, ctx, input, output,
+		// streaming method needs receiver, ctx, [input,] stream
+		if mtype.NumIn() != 3 && mtype.NumIn() != 4 {
 			if reportErr {
 				log.Warn("method ", mname, " has wrong number of ins:", mtype.NumIn())
 			}
@@ -131,28 +142,41 @@ func suitableMethods(typ reflect.Type, reportErr bool) map[string]*methodType {
 		if ctxType != typeOfContext {
 			continue
 		}
-		// Second arg need not be a pointer.
-		inputType := mtype.In(2)
-		if !isExportedOrBuiltinType(inputType) {
+		var inputType, outputType, streamType reflect.Type
+		if last := mtype.In(mtype.NumIn() - 1); last == invoker.TypeOfStream {
+			streamType = last
+		} else if mtype.NumIn() != 4 {
 			if reportErr {
-				log.Warn(mname, "argument type not exported:", inputType)
+				log.Warn("method ", mname, " has wrong number of ins:", mtype.NumIn())
 			}
 			continue
 		}
-		// Output type must be exported.
-		outputType := mtype.In(3)
-		if outputType.Kind() != reflect.Ptr {
-			if reportErr {
-				log.Warn("method ", mname, " reply type not a pointer:", outputType)
+		// Second arg need not be a pointer.
+		if mtype.NumIn() == 4 {
+			inputType = mtype.In(2)
+			if !isExportedOrBuiltinType(inputType) {
+				if reportErr {
+					log.Warn(mname, "argument type not exported:", inputType)
+				}
+				continue
 			}
-			continue
 		}
-		// Output type must be exported.
-		if !isExportedOrBuiltinType(outputType) {
-			if reportErr {
-				log.Warn("method ", mname, " reply type not exported:", outputType)
+		if streamType == nil {
+			// Output type must be exported.
+			outputType = mtype.In(3)
+			if outputType.Kind() != reflect.Ptr {
+				if reportErr {
+					log.Warn("method ", mname, " reply type not a pointer:", outputType)
+				}
+				continue
+			}
+			// Output type must be exported.
+			if !isExportedOrBuiltinType(outputType) {
+				if reportErr {
+					log.Warn("method ", mname, " reply type not exported:", outputType)
+				}
+				continue
 			}
-			continue
 		}
 		// Method needs one out.
 		if mtype.NumOut() != 1 {
@@ -174,6 +198,7 @@ func suitableMethods(typ reflect.Type, reportErr bool) map[string]*methodType {
 			CtxType:    ctxType,
 			InputType:  inputType,
 			OutputType: outputType,
+			StreamType: streamType,
 			ErrType:    errType,
 		}
 	}
@@ -225,8 +250,8 @@ func (r *ReceiverInvoker) invoke(c context.Context, mi invoker.Message,
 		return mo, errors.New(s)
 	}
 	params := mi.Parameters()
-	if len(params) != 3 {
-		s := fmt.Sprintf("parameters must be 3, now %d", len(params))
+	if n := len(mtype.In()); len(params) != n {
+		s := fmt.Sprintf("parameters must be %d, now %d", n, len(params))
 		log.Error(s)
 		return mo, errors.New(s)
 	}
@@ -10,9 +10,11 @@ import (
 )
 
 type Options struct {
-	Name             string
-	Version          string
-	Labels           map[string]string
+	Name    string
+	Version string
+	Labels  map[string]string
+	// Idempotent funcs can be retried by consumer automatically
+	Idempotent       []string
 	Servers          []server.Server
 	Registries       []registry.Registry
 	RegisterTTL      time.Duration
@@ -93,3 +95,10 @@ func Label(k, v string) Option {
 		o.Labels[k] = v
 	}
 }
+
+// Idempotent marks funcs which can be retried by consumer automatically
+func Idempotent(funcs ...string) Option {
+	return func(o *Options) {
+		o.Idempotent = append(o.Idempotent, funcs...)
+	}
+}
@@ -49,6 +49,12 @@ func (p *Provider) getServices() []registry.Service {
 		Timestamp: time.Now().Unix(),
 		Side:      "provider",
 	}
+	// only funcs of service can be idempotent
+	for _, f := range p.opts.Idempotent {
+		if util.ArrayContainsString(funcNames, f) {
+			service.Idempotent = append(service.Idempotent, f)
+		}
+	}
 	for _, s := range p.opts.Servers {
 		svc := service
 		sopts := s.Options()
@@ -65,6 +71,15 @@ func (p *Provider) getServices() []registry.Service {
 			}
 		}
 		svc.Codecs = codecs
+		compressors := make([]string, 0)
+		for _, c := range sopts.Compressors {
+			if !util.ArrayContainsString(compressors, c.String()) {
+				compressors = append(compressors, c.String())
+			}
+		}
+		if len(compressors) != 0 {
+			svc.Compressors = compressors
+		}
 		services = append(services, svc)
 	}
 	return services
@@ -0,0 +1,191 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/invoker"
+)
+
+// Stats of AdaptiveLimiter
+type Stats struct {
+	// Limit is the current max in-flight calls
+	Limit    int
+	InFlight int
+	// MinRTT is the min latency since last probe, it is taken as the
+	// latency without queueing
+	MinRTT time.Duration
+	// Accepted, Rejected and Dropped are counters of calls since the
+	// limiter is created
+	Accepted uint64
+	Rejected uint64
+	Dropped  uint64
+}
+
+// AdaptiveLimiter limit in-flight calls of all services, the limit is
+// adjusted by latency in the way of TCP Vegas: the queue size is
+// estimated as limit * (1 - minRTT/rtt), limit is increased when the
+// queue is short and decreased when the queue is long, and multiplied
+// by Backoff when call is dropped
+type AdaptiveLimiter struct {
+	opts Options
+	now  func() time.Time
+
+	sync.Mutex
+	limit    float64
+	inflight int
+	minRTT   time.Duration
+	probedAt time.Time
+	accepted uint64
+	rejected uint64
+	dropped  uint64
+}
+
+// NewAdaptiveLimiter create adaptive limiter with options
+func NewAdaptiveLimiter(opts ...Option) *AdaptiveLimiter {
+	l := &AdaptiveLimiter{
+		opts: newOptions(opts...),
+		now:  time.Now,
+	}
+	l.limit = l.clamp(float64(l.opts.InitialLimit))
+	return l
+}
+
+// clamp limit in [MinLimit, MaxLimit]
+func (l *AdaptiveLimiter) clamp(limit float64) float64 {
+	return math.Max(float64(l.opts.MinLimit), math.Min(float64(l.opts.MaxLimit), limit))
+}
+
+// Allow judge whether a call is allowed, error with code Overloaded is
+// returned if not, otherwise done must be called with the result of
+// call when the call is finished
+func (l *AdaptiveLimiter) Allow() (func(error), error) {
+	done, err := l.allow()
+	if err != nil {
+		return nil, err
+	}
+	return func(err error) {
+		done(l.opts.IsDropped(err))
+	}, nil
+}
+
+// allow is Allow whose done is called with whether call is dropped
+func (l *AdaptiveLimiter) allow() (func(bool), error) {
+	start := l.now()
+	l.Lock()
+	defer l.Unlock()
+	if l.inflight >= int(l.limit) {
+		l.rejected++
+		return nil, errors.Newf(errors.Overloaded, "server is overloaded, limit is %d", int(l.limit))
+	}
+	l.inflight++
+	l.accepted++
+	inflight := l.inflight
+
+	var once sync.Once
+	return func(dropped bool) {
+		once.Do(func() {
+			rtt := l.now().Sub(start)
+			l.Lock()
+			defer l.Unlock()
+			l.inflight--
+			l.sample(rtt, inflight, dropped)
+		})
+	}, nil
+}
+
+// sample update limit by latency of call and in-flight calls when
+// it started
+func (l *AdaptiveLimiter) sample(rtt time.Duration, inflight int, dropped bool) {
+	now := l.now()
+	if dropped {
+		l.dropped++
+		l.setLimit(l.limit * l.opts.Backoff)
+		return
+	}
+	if rtt <= 0 {
+		return
+	}
+	if l.opts.ProbeInterval > 0 && now.Sub(l.probedAt) >= l.opts.ProbeInterval {
+		l.minRTT = 0
+		l.probedAt = now
+	}
+	if l.minRTT == 0 || rtt < l.minRTT {
+		l.minRTT = rtt
+		return
+	}
+	// the limit is not reached, latency says nothing about it
+	if inflight*2 < int(l.limit) {
+		return
+	}
+
+	threshold := math.Max(1, math.Log10(l.limit))
+	alpha, beta := 3*threshold, 6*threshold
+	queue := math.Ceil(l.limit * (1 - float64(l.minRTT)/float64(rtt)))
+	limit := l.limit
+	switch {
+	case queue <= threshold:
+		limit += beta
+	case queue < alpha:
+		limit += threshold
+	case queue > beta:
+		limit -= threshold
+	default:
+		return
+	}
+	l.setLimit((1-l.opts.Smoothing)*l.limit + l.opts.Smoothing*limit)
+}
+
+// setLimit change limit and notify OnLimitChange
+func (l *AdaptiveLimiter) setLimit(limit float64) {
+	from := int(l.limit)
+	l.limit = l.clamp(limit)
+	if to := int(l.limit); to != from && l.opts.OnLimitChange != nil {
+		l.opts.OnLimitChange(from, to)
+	}
+}
+
+// Stats get limit and counters
+func (l *AdaptiveLimiter) Stats() Stats {
+	l.Lock()
+	defer l.Unlock()
+	return Stats{
+		Limit:    int(l.limit),
+		InFlight: l.inflight,
+		MinRTT:   l.minRTT,
+		Accepted: l.accepted,
+		Rejected: l.rejected,
+		Dropped:  l.dropped,
+	}
+}
+
+// Interceptor reject call with Overloaded when limit is reached, it is
+// shared by all invokers, so it is usually set by server.Intercept,
+// panic of call is recorded as dropped and panic again
+func (l *AdaptiveLimiter) Interceptor() invoker.Interceptor {
+	return func(fn invoker.InvokeFunc) invoker.InvokeFunc {
+		return func(ctx context.Context, mi invoker.Message,
+			opts ...invoker.InvokeOption) (mo invoker.Message, err error) {
+			done, err := l.allow()
+			if err != nil {
+				return nil, err
+			}
+			defer func() {
+				if p := recover(); p != nil {
+					done(true)
+					panic(p)
+				}
+				// handler may ignore the deadline, the call is still dropped
+				if err == nil {
+					done(l.opts.IsDropped(ctx.Err()))
+				} else {
+					done(l.opts.IsDropped(err))
+				}
+			}()
+			return fn(ctx, mi, opts...)
+		}
+	}
+}
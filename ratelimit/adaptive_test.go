@@ -0,0 +1,155 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/invoker"
+)
+
+func newTestAdaptiveLimiter(opts ...Option) (*AdaptiveLimiter, *time.Time) {
+	t := time.Unix(1000, 0)
+	l := NewAdaptiveLimiter(opts...)
+	l.now = func() time.Time {
+		return t
+	}
+	return l, &t
+}
+
+// run n concurrent calls which take rtt, and return errors of Allow
+func runCalls(l *AdaptiveLimiter, now *time.Time, n int, rtt time.Duration, err error) []error {
+	var dones []func(error)
+	var errs []error
+	for i := 0; i < n; i++ {
+		done, e := l.Allow()
+		if e != nil {
+			errs = append(errs, e)
+			continue
+		}
+		dones = append(dones, done)
+	}
+	*now = now.Add(rtt)
+	for _, done := range dones {
+		done(err)
+	}
+	return errs
+}
+
+func TestAdaptiveLimiter_Reject(t *testing.T) {
+	l, now := newTestAdaptiveLimiter(Limits(2, 1, 10))
+	errs := runCalls(l, now, 3, 0, nil)
+	if len(errs) != 1 || !errors.Is(errs[0], errors.Overloaded) {
+		t.Fatalf("Allow() errs = %v, want one %v", errs, errors.Overloaded)
+	}
+	stats := l.Stats()
+	if stats.Accepted != 2 || stats.Rejected != 1 || stats.InFlight != 0 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestAdaptiveLimiter_Latency(t *testing.T) {
+	var changes int
+	l, now := newTestAdaptiveLimiter(Limits(10, 1, 100),
+		OnLimitChange(func(from, to int) {
+			changes++
+		}))
+	// measure latency without load
+	runCalls(l, now, 1, 10*time.Millisecond, nil)
+	if got := l.Stats().MinRTT; got != 10*time.Millisecond {
+		t.Fatalf("MinRTT = %v, want %v", got, 10*time.Millisecond)
+	}
+
+	// no queueing at full load, limit increases
+	runCalls(l, now, 10, 10*time.Millisecond, nil)
+	grown := l.Stats().Limit
+	if grown <= 10 {
+		t.Fatalf("Limit = %d, want > %d", grown, 10)
+	}
+
+	// latency is doubled by queueing, limit decreases
+	for i := 0; i < 5; i++ {
+		runCalls(l, now, l.Stats().Limit, 20*time.Millisecond, nil)
+	}
+	if got := l.Stats().Limit; got >= grown {
+		t.Errorf("Limit = %d, want < %d", got, grown)
+	}
+	if changes == 0 {
+		t.Errorf("OnLimitChange is not called")
+	}
+}
+
+func TestAdaptiveLimiter_AppLimited(t *testing.T) {
+	l, now := newTestAdaptiveLimiter(Limits(10, 1, 100))
+	runCalls(l, now, 1, 10*time.Millisecond, nil)
+	for i := 0; i < 5; i++ {
+		runCalls(l, now, 2, 100*time.Millisecond, nil)
+	}
+	if got := l.Stats().Limit; got != 10 {
+		t.Errorf("Limit = %d, want %d", got, 10)
+	}
+}
+
+func TestAdaptiveLimiter_Dropped(t *testing.T) {
+	l, now := newTestAdaptiveLimiter(Limits(10, 5, 100), Backoff(0.5))
+	runCalls(l, now, 1, time.Millisecond, errors.New(errors.DeadlineExceeded, "timeout"))
+	runCalls(l, now, 1, time.Millisecond, errors.New(errors.HandlerError, "failed"))
+	stats := l.Stats()
+	if stats.Limit != 5 || stats.Dropped != 1 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+	runCalls(l, now, 1, time.Millisecond, context.DeadlineExceeded)
+	if got := l.Stats().Limit; got != 5 {
+		t.Errorf("Limit = %d, want %d", got, 5)
+	}
+}
+
+func TestAdaptiveLimiter_Interceptor(t *testing.T) {
+	l := NewAdaptiveLimiter(Limits(1, 1, 1))
+	block := make(chan struct{})
+	started := make(chan struct{})
+	fn := l.Interceptor()(func(ctx context.Context, mi invoker.Message,
+		opts ...invoker.InvokeOption) (invoker.Message, error) {
+		close(started)
+		<-block
+		return nil, nil
+	})
+	result := make(chan error)
+	go func() {
+		_, err := fn(context.Background(), invoker.NewMessage())
+		result <- err
+	}()
+	<-started
+	if _, err := fn(context.Background(), invoker.NewMessage()); !errors.Is(err, errors.Overloaded) {
+		t.Errorf("Invoke() err = %v, want %v", err, errors.Overloaded)
+	}
+	close(block)
+	if err := <-result; err != nil {
+		t.Errorf("Invoke() err = %v", err)
+	}
+	if got := l.Stats().InFlight; got != 0 {
+		t.Errorf("InFlight = %d, want %d", got, 0)
+	}
+}
+
+func TestAdaptiveLimiter_InterceptorPanic(t *testing.T) {
+	l := NewAdaptiveLimiter(Limits(1, 1, 1))
+	fn := l.Interceptor()(func(ctx context.Context, mi invoker.Message,
+		opts ...invoker.InvokeOption) (invoker.Message, error) {
+		panic("boom")
+	})
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("recover() = %v, want %v", p, "boom")
+			}
+		}()
+		fn(context.Background(), invoker.NewMessage())
+	}()
+	// slot of the panicked call is released
+	stats := l.Stats()
+	if stats.InFlight != 0 || stats.Dropped != 1 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/haormj/dodo/registry"
+
+	"gopkg.in/yaml.v2"
+)
+
+// LabelPrefix is the prefix of labels of limits, e.g.
+// ratelimit.rate=100 limit service, and ratelimit.SayHello.rate=10
+// limit function SayHello, keys are rate, burst and concurrency
+const LabelPrefix = "ratelimit."
+
+// ParseLabels get rules of service from labels
+func ParseLabels(service string, labels map[string]string) (Rules, error) {
+	rules := make(Rules)
+	for k, v := range labels {
+		if !strings.HasPrefix(k, LabelPrefix) {
+			continue
+		}
+		name := service
+		field := strings.TrimPrefix(k, LabelPrefix)
+		if i := strings.LastIndex(field, "."); i != -1 {
+			name = service + "." + field[:i]
+			field = field[i+1:]
+		}
+		limit := rules[name]
+		var err error
+		switch field {
+		case "rate":
+			limit.Rate, err = strconv.ParseFloat(v, 64)
+		case "burst":
+			limit.Burst, err = strconv.Atoi(v)
+		case "concurrency":
+			limit.Concurrency, err = strconv.Atoi(v)
+		default:
+			err = fmt.Errorf("unknown field %s", field)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid label %s=%s: %v", k, v, err)
+		}
+		rules[name] = limit
+	}
+	return rules, nil
+}
+
+// Labels format rules of service as labels, it is the reverse of
+// ParseLabels, so provider can advertise its limits to consumer
+func Labels(service string, rules Rules) map[string]string {
+	labels := make(map[string]string)
+	for k, limit := range rules {
+		var prefix string
+		switch {
+		case k == service:
+			prefix = LabelPrefix
+		case strings.HasPrefix(k, service+"."):
+			prefix = LabelPrefix + strings.TrimPrefix(k, service+".") + "."
+		default:
+			continue
+		}
+		if limit.Rate > 0 {
+			labels[prefix+"rate"] = strconv.FormatFloat(limit.Rate, 'f', -1, 64)
+		}
+		if limit.Burst > 0 {
+			labels[prefix+"burst"] = strconv.Itoa(limit.Burst)
+		}
+		if limit.Concurrency > 0 {
+			labels[prefix+"concurrency"] = strconv.Itoa(limit.Concurrency)
+		}
+	}
+	return labels
+}
+
+// LoadFile get rules from yaml or json file, e.g.
+//
+//	Hello:
+//	  rate: 100
+//	Hello.SayHello:
+//	  concurrency: 10
+func LoadFile(path string) (Rules, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules := make(Rules)
+	if err := yaml.Unmarshal(b, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// FromRegistry get rules of service from labels of its providers,
+// the labels of the first provider is used
+func FromRegistry(r registry.Registry, service string) (Rules, error) {
+	svcs, err := r.GetService(service)
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range svcs {
+		if svc.Side == "provider" {
+			return ParseLabels(service, svc.Labels)
+		}
+	}
+	return make(Rules), nil
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/haormj/dodo/errors"
+)
+
+// Options of AdaptiveLimiter
+type Options struct {
+	// InitialLimit is the max in-flight calls before any sample,
+	// limit is always kept in [MinLimit, MaxLimit]
+	InitialLimit int
+	MinLimit     int
+	MaxLimit     int
+	// Smoothing is the weight of new limit in each update, in (0, 1]
+	Smoothing float64
+	// Backoff is the ratio the limit is multiplied by when call is
+	// dropped, e.g. deadline of caller is exceeded
+	Backoff float64
+	// ProbeInterval is the interval of forgetting the min latency, so
+	// the latency without load is measured again after it changed
+	ProbeInterval time.Duration
+	// IsDropped judge whether error of call means it is dropped because
+	// of overload, DeadlineExceeded is dropped by default
+	IsDropped func(error) bool
+	// OnLimitChange is called when limit changed, it is called with
+	// lock held, so it should be fast
+	OnLimitChange func(from, to int)
+}
+
+// Option of AdaptiveLimiter
+type Option func(*Options)
+
+func newOptions(opts ...Option) Options {
+	options := Options{
+		InitialLimit:  20,
+		MinLimit:      1,
+		MaxLimit:      1000,
+		Smoothing:     1,
+		Backoff:       0.9,
+		ProbeInterval: time.Minute,
+		IsDropped:     IsDropped,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.MinLimit <= 0 {
+		options.MinLimit = 1
+	}
+	if options.MaxLimit < options.MinLimit {
+		options.MaxLimit = options.MinLimit
+	}
+	if options.Smoothing <= 0 || options.Smoothing > 1 {
+		options.Smoothing = 1
+	}
+	if options.Backoff <= 0 || options.Backoff >= 1 {
+		options.Backoff = 0.9
+	}
+	return options
+}
+
+// IsDropped is the default judgement of dropped call, call whose
+// deadline is exceeded waited too long in server
+func IsDropped(err error) bool {
+	return errors.Code(err) == errors.DeadlineExceeded
+}
+
+// Limits sets the initial, min and max limit
+func Limits(initial, min, max int) Option {
+	return func(o *Options) {
+		o.InitialLimit = initial
+		o.MinLimit = min
+		o.MaxLimit = max
+	}
+}
+
+// Smoothing sets the weight of new limit in each update
+func Smoothing(s float64) Option {
+	return func(o *Options) {
+		o.Smoothing = s
+	}
+}
+
+// Backoff sets the ratio of limit when call is dropped
+func Backoff(b float64) Option {
+	return func(o *Options) {
+		o.Backoff = b
+	}
+}
+
+// ProbeInterval sets the interval of forgetting the min latency
+func ProbeInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.ProbeInterval = d
+	}
+}
+
+// Dropped sets the judgement of dropped call
+func Dropped(f func(error) bool) Option {
+	return func(o *Options) {
+		o.IsDropped = f
+	}
+}
+
+// OnLimitChange sets the callback of limit change, e.g. for metrics
+func OnLimitChange(f func(from, to int)) Option {
+	return func(o *Options) {
+		o.OnLimitChange = f
+	}
+}
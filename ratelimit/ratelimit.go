@@ -0,0 +1,207 @@
+// Package ratelimit provides token bucket and concurrency limit as
+// invoker.Interceptor, it can be used by both server and consumer,
+// limits are configured for each service and each function.
+package ratelimit
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/invoker"
+)
+
+// Limit of calls, zero means no limit
+type Limit struct {
+	// Rate is the number of calls per second, at most Burst calls can
+	// be made at once, Burst is the ceil of Rate if it is zero
+	Rate  float64 `json:"rate,omitempty" yaml:"rate,omitempty"`
+	Burst int     `json:"burst,omitempty" yaml:"burst,omitempty"`
+	// Concurrency is the max number of in-flight calls
+	Concurrency int `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+}
+
+// Rules of limits, key is service name or service.funcName, both
+// limit of service and limit of function apply to call of function,
+// calls of all functions share the limit of service
+type Rules map[string]Limit
+
+// bucket is token bucket of one key
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter of one key
+type limiter struct {
+	limit  Limit
+	bucket bucket
+	active int
+}
+
+// take token and concurrency, false if any is exhausted
+func (l *limiter) take(now time.Time) bool {
+	if l.limit.Concurrency > 0 && l.active >= l.limit.Concurrency {
+		return false
+	}
+	if l.limit.Rate > 0 {
+		burst := float64(l.limit.Burst)
+		if burst <= 0 {
+			burst = float64(int(l.limit.Rate + 0.999999))
+		}
+		if l.bucket.last.IsZero() {
+			l.bucket.tokens = burst
+		} else if d := now.Sub(l.bucket.last); d > 0 {
+			l.bucket.tokens += d.Seconds() * l.limit.Rate
+		}
+		if l.bucket.tokens > burst {
+			l.bucket.tokens = burst
+		}
+		l.bucket.last = now
+		if l.bucket.tokens < 1 {
+			return false
+		}
+		l.bucket.tokens--
+	}
+	l.active++
+	return true
+}
+
+// put back token and concurrency got by take
+func (l *limiter) put() {
+	if l.limit.Rate > 0 {
+		l.bucket.tokens++
+	}
+	l.active--
+}
+
+// Limiter limit calls by rules
+type Limiter struct {
+	now func() time.Time
+
+	sync.Mutex
+	rules    Rules
+	limiters map[string]*limiter
+}
+
+// NewLimiter create limiter with rules
+func NewLimiter(rules Rules) *Limiter {
+	l := &Limiter{
+		now:      time.Now,
+		limiters: make(map[string]*limiter),
+	}
+	l.SetRules(rules)
+	return l
+}
+
+// SetRules replace all rules, status of unchanged limits is kept
+func (l *Limiter) SetRules(rules Rules) {
+	l.Lock()
+	defer l.Unlock()
+	l.rules = make(Rules, len(rules))
+	for k, v := range rules {
+		l.rules[k] = v
+	}
+	l.reset()
+}
+
+// Update replace rules of service, rules of other services are kept
+func (l *Limiter) Update(service string, rules Rules) {
+	l.Lock()
+	defer l.Unlock()
+	for k := range l.rules {
+		if k == service || strings.HasPrefix(k, service+".") {
+			delete(l.rules, k)
+		}
+	}
+	for k, v := range rules {
+		l.rules[k] = v
+	}
+	l.reset()
+}
+
+// Rules get a copy of rules
+func (l *Limiter) Rules() Rules {
+	l.Lock()
+	defer l.Unlock()
+	rules := make(Rules, len(l.rules))
+	for k, v := range l.rules {
+		rules[k] = v
+	}
+	return rules
+}
+
+// reset drop limiters whose limit is changed or removed
+func (l *Limiter) reset() {
+	for k, lim := range l.limiters {
+		if limit, ok := l.rules[k]; !ok || limit != lim.limit {
+			delete(l.limiters, k)
+		}
+	}
+}
+
+func (l *Limiter) limiter(k string) *limiter {
+	limit, ok := l.rules[k]
+	if !ok {
+		return nil
+	}
+	lim, ok := l.limiters[k]
+	if !ok {
+		lim = &limiter{limit: limit}
+		l.limiters[k] = lim
+	}
+	return lim
+}
+
+// Allow judge whether call of funcName of service is allowed, error
+// with code ResourceExhausted is returned if not, otherwise release
+// must be called when the call is finished
+func (l *Limiter) Allow(service string, funcName string) (func(), error) {
+	now := l.now()
+	l.Lock()
+	defer l.Unlock()
+	var taken []*limiter
+	for _, k := range []string{service + "." + funcName, service} {
+		lim := l.limiter(k)
+		if lim == nil {
+			continue
+		}
+		if !lim.take(now) {
+			for _, t := range taken {
+				t.put()
+			}
+			return nil, errors.Newf(errors.ResourceExhausted, "rate limit of %s is exceeded", k)
+		}
+		taken = append(taken, lim)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.Lock()
+			for _, t := range taken {
+				t.active--
+			}
+			l.Unlock()
+		})
+	}, nil
+}
+
+// Interceptor reject call with ResourceExhausted when limit is
+// exceeded, name of service is got from invoker.ServiceNameAttachment
+func (l *Limiter) Interceptor() invoker.Interceptor {
+	return func(fn invoker.InvokeFunc) invoker.InvokeFunc {
+		return func(ctx context.Context, mi invoker.Message,
+			opts ...invoker.InvokeOption) (invoker.Message, error) {
+			service, _ := mi.Attachment(invoker.ServiceNameAttachment)
+			release, err := l.Allow(service, mi.FuncName())
+			if err != nil {
+				return nil, err
+			}
+			defer release()
+			return fn(ctx, mi, opts...)
+		}
+	}
+}
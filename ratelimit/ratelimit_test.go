@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/invoker"
+)
+
+func newTestLimiter(rules Rules) (*Limiter, *time.Time) {
+	t := time.Unix(1000, 0)
+	l := NewLimiter(rules)
+	l.now = func() time.Time {
+		return t
+	}
+	return l, &t
+}
+
+func allow(l *Limiter, funcName string) bool {
+	release, err := l.Allow("Hello", funcName)
+	if err != nil {
+		if !errors.Is(err, errors.ResourceExhausted) {
+			panic(err)
+		}
+		return false
+	}
+	release()
+	return true
+}
+
+func TestLimiter_Rate(t *testing.T) {
+	l, now := newTestLimiter(Rules{"Hello.SayHello": {Rate: 2, Burst: 3}})
+	var got []bool
+	for i := 0; i < 4; i++ {
+		got = append(got, allow(l, "SayHello"))
+	}
+	// refill one token per 500ms
+	*now = now.Add(500 * time.Millisecond)
+	got = append(got, allow(l, "SayHello"), allow(l, "SayHello"))
+	want := []bool{true, true, true, false, true, false}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Allow() = %v, want %v", got, want)
+	}
+	if !allow(l, "SayWorld") {
+		t.Errorf("Allow() = %v, want %v", false, true)
+	}
+}
+
+func TestLimiter_Concurrency(t *testing.T) {
+	l, _ := newTestLimiter(Rules{
+		"Hello":          {Concurrency: 2},
+		"Hello.SayHello": {Concurrency: 1},
+	})
+	release1, err := l.Allow("Hello", "SayHello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Allow("Hello", "SayHello"); !errors.Is(err, errors.ResourceExhausted) {
+		t.Errorf("Allow() err = %v, want %v", err, errors.ResourceExhausted)
+	}
+	release2, err := l.Allow("Hello", "SayWorld")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// limit of service is shared by funcs
+	if _, err := l.Allow("Hello", "SayWorld"); !errors.Is(err, errors.ResourceExhausted) {
+		t.Errorf("Allow() err = %v, want %v", err, errors.ResourceExhausted)
+	}
+	release1()
+	release1()
+	release2()
+	if !allow(l, "SayHello") || !allow(l, "SayWorld") {
+		t.Errorf("Allow() = %v, want %v", false, true)
+	}
+}
+
+func TestLimiter_Update(t *testing.T) {
+	l, _ := newTestLimiter(Rules{"Hello": {Concurrency: 1}, "World": {Concurrency: 1}})
+	l.Update("Hello", Rules{"Hello.SayHello": {Rate: 1}})
+	want := Rules{"Hello.SayHello": {Rate: 1}, "World": {Concurrency: 1}}
+	if got := l.Rules(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Rules() = %v, want %v", got, want)
+	}
+}
+
+func TestLimiter_Interceptor(t *testing.T) {
+	l, _ := newTestLimiter(Rules{"Hello": {Rate: 1}})
+	var calls int
+	fn := l.Interceptor()(func(ctx context.Context, mi invoker.Message,
+		opts ...invoker.InvokeOption) (invoker.Message, error) {
+		calls++
+		return invoker.NewMessage(), nil
+	})
+	mi := invoker.NewMessage()
+	mi.SetFuncName("SayHello")
+	mi.SetAttachment(invoker.ServiceNameAttachment, "Hello")
+	fn(context.Background(), mi)
+	if _, err := fn(context.Background(), mi); !errors.Is(err, errors.ResourceExhausted) {
+		t.Errorf("Invoke() err = %v, want %v", err, errors.ResourceExhausted)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %v, want %v", calls, 1)
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels := map[string]string{
+		"ratelimit.rate":                 "100",
+		"ratelimit.concurrency":          "10",
+		"ratelimit.SayHello.rate":        "1.5",
+		"ratelimit.SayHello.burst":       "3",
+		"ratelimit.SayWorld.concurrency": "2",
+		"zone":                           "sh",
+	}
+	want := Rules{
+		"Hello":          {Rate: 100, Concurrency: 10},
+		"Hello.SayHello": {Rate: 1.5, Burst: 3},
+		"Hello.SayWorld": {Concurrency: 2},
+	}
+	got, err := ParseLabels("Hello", labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseLabels() = %v, want %v", got, want)
+	}
+	delete(labels, "zone")
+	if got := Labels("Hello", want); !reflect.DeepEqual(got, labels) {
+		t.Errorf("Labels() = %v, want %v", got, labels)
+	}
+
+	if _, err := ParseLabels("Hello", map[string]string{"ratelimit.rate": "x"}); err == nil {
+		t.Errorf("ParseLabels() err = %v, want error", err)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ratelimit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"rules.yaml", "Hello:\n  rate: 100\nHello.SayHello:\n  concurrency: 10\n"},
+		{"rules.json", `{"Hello": {"rate": 100}, "Hello.SayHello": {"concurrency": 10}}`},
+	}
+	want := Rules{
+		"Hello":          {Rate: 100},
+		"Hello.SayHello": {Concurrency: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := filepath.Join(dir, tt.name)
+			if err := ioutil.WriteFile(p, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadFile(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("LoadFile() = %v, want %v", got, want)
+			}
+		})
+	}
+}
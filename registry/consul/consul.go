@@ -0,0 +1,451 @@
+// Package consul provides a consul registry through the http api of
+// consul agent. Each registration is a consul service with a ttl or
+// tcp check, fields of registry.Service are stored in meta, labels are
+// stored in tags as key=value, only passing services are discovered.
+package consul
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haormj/dodo/log"
+	"github.com/haormj/dodo/registry"
+)
+
+var (
+	// DefaultTimeout of each request to consul, except blocking query
+	DefaultTimeout = 5 * time.Second
+	// DefaultWaitTime is the max wait of blocking query
+	DefaultWaitTime = 30 * time.Second
+	// DefaultDeregisterCriticalAfter is the time after which service
+	// with critical check is deregistered by consul
+	DefaultDeregisterCriticalAfter = time.Minute
+)
+
+// agentService is the service of consul
+type agentService struct {
+	ID      string            `json:"ID"`
+	Service string            `json:"Service,omitempty"`
+	Name    string            `json:"Name,omitempty"`
+	Tags    []string          `json:"Tags,omitempty"`
+	Address string            `json:"Address"`
+	Port    int               `json:"Port"`
+	Meta    map[string]string `json:"Meta,omitempty"`
+	Check   *agentCheck       `json:"Check,omitempty"`
+}
+
+type agentCheck struct {
+	TTL                            string `json:"TTL,omitempty"`
+	TCP                            string `json:"TCP,omitempty"`
+	Interval                       string `json:"Interval,omitempty"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter,omitempty"`
+}
+
+// serviceEntry is the item of health service api
+type serviceEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service agentService `json:"Service"`
+}
+
+type consulRegistry struct {
+	client  *http.Client
+	address string
+	options registry.Options
+
+	sync.Mutex
+	// registered services and their ttl, service which is not changed
+	// only pass its ttl check when it is registered again
+	registered map[string]string
+}
+
+func NewRegistry(opts ...registry.Option) registry.Registry {
+	c := &consulRegistry{
+		options:    registry.Options{},
+		registered: make(map[string]string),
+	}
+	configure(c, opts...)
+	return c
+}
+
+func configure(c *consulRegistry, opts ...registry.Option) error {
+	for _, o := range opts {
+		o(&c.options)
+	}
+
+	if c.options.Timeout == 0 {
+		c.options.Timeout = DefaultTimeout
+	}
+
+	scheme := "http"
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+	}
+	if c.options.Secure || c.options.TLSConfig != nil {
+		scheme = "https"
+		tlsConfig := c.options.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{
+				InsecureSkipVerify: true,
+			}
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	address := "127.0.0.1:8500"
+	for _, addr := range c.options.Addrs {
+		if len(addr) != 0 {
+			address = addr
+			break
+		}
+	}
+	if !strings.Contains(address, "://") {
+		address = scheme + "://" + address
+	}
+
+	c.Lock()
+	c.address = strings.TrimSuffix(address, "/")
+	c.client = &http.Client{Transport: transport}
+	c.Unlock()
+	return nil
+}
+
+func (c *consulRegistry) Init(opts ...registry.Option) error {
+	return configure(c, opts...)
+}
+
+func (c *consulRegistry) Options() registry.Options {
+	return c.options
+}
+
+func (c *consulRegistry) value(k interface{}) interface{} {
+	if c.options.Context == nil {
+		return nil
+	}
+	return c.options.Context.Value(k)
+}
+
+func (c *consulRegistry) waitTime() time.Duration {
+	if v, ok := c.value(waitTimeKey{}).(time.Duration); ok {
+		return v
+	}
+	return DefaultWaitTime
+}
+
+// do request consul api, out is decoded from json body if it is not
+// nil, the index of blocking query is returned
+func (c *consulRegistry) do(ctx context.Context, method, path string, query url.Values,
+	in interface{}, out interface{}) (uint64, error) {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return 0, err
+		}
+	}
+	u := c.address + path
+	if len(query) != 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, &body)
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	if token, ok := c.value(tokenKey{}).(string); ok {
+		req.Header.Set("X-Consul-Token", token)
+	}
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("consul %s %s: %s %s", method, path, rsp.Status, strings.TrimSpace(string(b)))
+	}
+	var index uint64
+	if v := rsp.Header.Get("X-Consul-Index"); len(v) != 0 {
+		index, _ = strconv.ParseUint(v, 10, 64)
+	}
+	if out != nil {
+		if err := json.Unmarshal(b, out); err != nil {
+			return 0, err
+		}
+	}
+	return index, nil
+}
+
+// serviceID identify the registration of service in consul
+func serviceID(s registry.Service) string {
+	return s.Name + "-" + s.Side + "-" + s.Protocol + "-" + s.Address
+}
+
+// encode service to consul service
+func encode(s registry.Service) (agentService, error) {
+	host, p, err := net.SplitHostPort(s.Address)
+	if err != nil {
+		return agentService{}, err
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return agentService{}, err
+	}
+	meta := map[string]string{
+		"protocol":  s.Protocol,
+		"version":   s.Version,
+		"funcs":     strings.Join(s.Funcs, ","),
+		"codecs":    strings.Join(s.Codecs, ","),
+		"transport": s.Transport,
+		"side":      s.Side,
+		"tls":       strconv.FormatBool(s.TLS),
+		"timestamp": strconv.FormatInt(s.Timestamp, 10),
+	}
+	if len(s.Compressors) != 0 {
+		meta["compressors"] = strings.Join(s.Compressors, ",")
+	}
+	if len(s.Idempotent) != 0 {
+		meta["idempotent"] = strings.Join(s.Idempotent, ",")
+	}
+	var tags []string
+	for k, v := range s.Labels {
+		tags = append(tags, k+"="+v)
+	}
+	sort.Strings(tags)
+	return agentService{
+		ID:      serviceID(s),
+		Name:    s.Name,
+		Tags:    tags,
+		Address: host,
+		Port:    port,
+		Meta:    meta,
+	}, nil
+}
+
+// decode consul service to service, false if it is not registered
+// by dodo
+func decode(e serviceEntry) (registry.Service, bool) {
+	as := e.Service
+	meta := as.Meta
+	if len(meta["protocol"]) == 0 || len(meta["side"]) == 0 {
+		return registry.Service{}, false
+	}
+	host := as.Address
+	if len(host) == 0 {
+		host = e.Node.Address
+	}
+	s := registry.Service{
+		Protocol:  meta["protocol"],
+		Address:   net.JoinHostPort(host, strconv.Itoa(as.Port)),
+		Name:      as.Service,
+		Version:   meta["version"],
+		Transport: meta["transport"],
+		Side:      meta["side"],
+		Labels:    make(map[string]string),
+	}
+	split := func(v string) []string {
+		if len(v) == 0 {
+			return nil
+		}
+		return strings.Split(v, ",")
+	}
+	s.Funcs = split(meta["funcs"])
+	s.Codecs = split(meta["codecs"])
+	s.Compressors = split(meta["compressors"])
+	s.Idempotent = split(meta["idempotent"])
+	s.TLS, _ = strconv.ParseBool(meta["tls"])
+	s.Timestamp, _ = strconv.ParseInt(meta["timestamp"], 10, 64)
+	for _, tag := range as.Tags {
+		if i := strings.Index(tag, "="); i > 0 {
+			s.Labels[tag[:i]] = tag[i+1:]
+		}
+	}
+	return s, true
+}
+
+// check get health check of service, nil if there is no check
+func (c *consulRegistry) check(as agentService, ttl time.Duration) *agentCheck {
+	deregisterAfter := DefaultDeregisterCriticalAfter
+	if v, ok := c.value(deregisterAfterKey{}).(time.Duration); ok {
+		deregisterAfter = v
+	}
+	if interval, ok := c.value(tcpCheckKey{}).(time.Duration); ok {
+		return &agentCheck{
+			TCP:                            net.JoinHostPort(as.Address, strconv.Itoa(as.Port)),
+			Interval:                       interval.String(),
+			DeregisterCriticalServiceAfter: deregisterAfter.String(),
+		}
+	}
+	if ttl > 0 {
+		return &agentCheck{
+			TTL:                            ttl.String(),
+			DeregisterCriticalServiceAfter: deregisterAfter.String(),
+		}
+	}
+	return nil
+}
+
+func (c *consulRegistry) Register(s registry.Service, opts ...registry.RegisterOption) error {
+	var options registry.RegisterOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	as, err := encode(s)
+	if err != nil {
+		return err
+	}
+	as.Check = c.check(as, options.TTL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.Timeout)
+	defer cancel()
+
+	c.Lock()
+	defer c.Unlock()
+
+	// register again only if service is changed, consul agent may lose
+	// it after restarted, so it is also registered when passing failed
+	key := registry.Format(s) + options.TTL.String()
+	if c.registered[as.ID] == key && as.Check != nil && len(as.Check.TTL) != 0 {
+		if err := c.pass(ctx, as.ID); err == nil {
+			return nil
+		}
+	}
+	if _, err := c.do(ctx, http.MethodPut, "/v1/agent/service/register", nil, as, nil); err != nil {
+		return err
+	}
+	if as.Check != nil && len(as.Check.TTL) != 0 {
+		if err := c.pass(ctx, as.ID); err != nil {
+			return err
+		}
+	}
+	c.registered[as.ID] = key
+	return nil
+}
+
+// pass ttl check of service
+func (c *consulRegistry) pass(ctx context.Context, id string) error {
+	_, err := c.do(ctx, http.MethodPut, "/v1/agent/check/pass/"+url.PathEscape("service:"+id), nil, nil, nil)
+	return err
+}
+
+func (c *consulRegistry) Deregister(s registry.Service) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.Timeout)
+	defer cancel()
+
+	c.Lock()
+	defer c.Unlock()
+
+	id := serviceID(s)
+	if _, err := c.do(ctx, http.MethodPut, "/v1/agent/service/deregister/"+url.PathEscape(id), nil, nil, nil); err != nil {
+		return err
+	}
+	delete(c.registered, id)
+	return nil
+}
+
+// health get passing services of name, index > 0 is blocking query
+func (c *consulRegistry) health(ctx context.Context, name string, index uint64) ([]registry.Service, uint64, error) {
+	query := url.Values{"passing": {"true"}}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", c.waitTime().String())
+	}
+	var entries []serviceEntry
+	index, err := c.do(ctx, http.MethodGet, "/v1/health/service/"+url.PathEscape(name), query, nil, &entries)
+	if err != nil {
+		return nil, 0, err
+	}
+	services := make([]registry.Service, 0, len(entries))
+	for _, e := range entries {
+		s, ok := decode(e)
+		if !ok {
+			continue
+		}
+		services = append(services, s)
+	}
+	return services, index, nil
+}
+
+// catalog get names of all services, index > 0 is blocking query
+func (c *consulRegistry) catalog(ctx context.Context, index uint64) ([]string, uint64, error) {
+	query := url.Values{}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", c.waitTime().String())
+	}
+	var m map[string][]string
+	index, err := c.do(ctx, http.MethodGet, "/v1/catalog/services", query, nil, &m)
+	if err != nil {
+		return nil, 0, err
+	}
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, index, nil
+}
+
+// GetService get passing providers of service, no error if there is
+// no provider
+func (c *consulRegistry) GetService(name string) ([]registry.Service, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.Timeout)
+	defer cancel()
+
+	all, _, err := c.health(ctx, name, 0)
+	if err != nil {
+		return nil, err
+	}
+	services := make([]registry.Service, 0, len(all))
+	for _, s := range all {
+		if s.Side == "provider" {
+			services = append(services, s)
+		}
+	}
+	return services, nil
+}
+
+// ListServices get passing providers and consumers of all services
+func (c *consulRegistry) ListServices() ([]registry.Service, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.Timeout)
+	defer cancel()
+
+	names, _, err := c.catalog(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	services := make([]registry.Service, 0)
+	for _, name := range names {
+		svcs, _, err := c.health(ctx, name, 0)
+		if err != nil {
+			log.Errorf("service:%v,err:%v", name, err)
+			continue
+		}
+		services = append(services, svcs...)
+	}
+	return services, nil
+}
+
+func (c *consulRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	return newConsulWatcher(c, opts...)
+}
+
+func (c *consulRegistry) String() string {
+	return "consul"
+}
@@ -0,0 +1,302 @@
+package consul
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/haormj/dodo/log"
+	"github.com/haormj/dodo/registry"
+	"github.com/haormj/dodo/registry/registrytest"
+)
+
+// fakeConsul implement agent and catalog api used by registry
+type fakeConsul struct {
+	sync.Mutex
+	index     uint64
+	services  map[string]agentService
+	passing   map[string]bool
+	registers int
+	tokens    []string
+	// changed is closed when index is increased
+	changed chan struct{}
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{
+		index:    1,
+		services: make(map[string]agentService),
+		passing:  make(map[string]bool),
+		changed:  make(chan struct{}),
+	}
+}
+
+// change increase index and wake up blocking queries, lock is held
+func (f *fakeConsul) change() {
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// fail make check of service critical
+func (f *fakeConsul) fail(id string) {
+	f.Lock()
+	defer f.Unlock()
+	f.passing[id] = false
+	f.change()
+}
+
+// block wait until index is greater than index of query or wait passed
+func (f *fakeConsul) block(r *http.Request) {
+	index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	wait, _ := time.ParseDuration(r.URL.Query().Get("wait"))
+	f.Lock()
+	if index == 0 || f.index > index {
+		f.Unlock()
+		return
+	}
+	changed := f.changed
+	f.Unlock()
+	select {
+	case <-changed:
+	case <-time.After(wait):
+	case <-r.Context().Done():
+	}
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	f.tokens = append(f.tokens, r.Header.Get("X-Consul-Token"))
+	f.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case r.Method == http.MethodPut && path == "/v1/agent/service/register":
+		var as agentService
+		if err := json.NewDecoder(r.Body).Decode(&as); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.Lock()
+		f.services[as.ID] = as
+		// ttl check is critical until it is passed
+		f.passing[as.ID] = as.Check == nil || len(as.Check.TTL) == 0
+		f.registers++
+		f.change()
+		f.Unlock()
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "/v1/agent/service/deregister/"):
+		id := strings.TrimPrefix(path, "/v1/agent/service/deregister/")
+		f.Lock()
+		defer f.Unlock()
+		if _, ok := f.services[id]; !ok {
+			http.Error(w, "Unknown service ID", http.StatusNotFound)
+			return
+		}
+		delete(f.services, id)
+		delete(f.passing, id)
+		f.change()
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "/v1/agent/check/pass/service:"):
+		id := strings.TrimPrefix(path, "/v1/agent/check/pass/service:")
+		f.Lock()
+		defer f.Unlock()
+		if _, ok := f.services[id]; !ok {
+			http.Error(w, "Unknown check ID", http.StatusNotFound)
+			return
+		}
+		if !f.passing[id] {
+			f.passing[id] = true
+			f.change()
+		}
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/v1/health/service/"):
+		f.block(r)
+		name := strings.TrimPrefix(path, "/v1/health/service/")
+		f.Lock()
+		entries := make([]serviceEntry, 0)
+		for id, as := range f.services {
+			if as.Name != name || (r.URL.Query().Get("passing") == "true" && !f.passing[id]) {
+				continue
+			}
+			var e serviceEntry
+			e.Node.Address = "10.0.0.1"
+			e.Service = as
+			e.Service.Service = as.Name
+			e.Service.Name = ""
+			e.Service.Check = nil
+			entries = append(entries, e)
+		}
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+		f.Unlock()
+		json.NewEncoder(w).Encode(entries)
+	case r.Method == http.MethodGet && path == "/v1/catalog/services":
+		f.block(r)
+		f.Lock()
+		m := make(map[string][]string)
+		for _, as := range f.services {
+			m[as.Name] = append(m[as.Name], as.Tags...)
+		}
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+		f.Unlock()
+		json.NewEncoder(w).Encode(m)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestRegistry(t *testing.T, opts ...registry.Option) (registry.Registry, *fakeConsul, func()) {
+	log.SetDummyLogger()
+	f := newFakeConsul()
+	s := httptest.NewServer(f)
+	opts = append([]registry.Option{registry.Addrs(s.URL), WaitTime(time.Second)}, opts...)
+	return NewRegistry(opts...), f, s.Close
+}
+
+func TestRegistry(t *testing.T) {
+	r, _, stop := newTestRegistry(t)
+	defer stop()
+	registrytest.TestRegistry(t, r)
+}
+
+func TestRegistry_Watch(t *testing.T) {
+	r, _, stop := newTestRegistry(t)
+	defer stop()
+	registrytest.TestWatch(t, r)
+}
+
+func TestRegistry_Check(t *testing.T) {
+	r, f, stop := newTestRegistry(t, Token("secret"))
+	defer stop()
+
+	p := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	c := registrytest.NewService("Hello", "127.0.0.1:0", "consumer")
+	for _, s := range []registry.Service{p, c} {
+		if err := r.Register(s, registry.RegisterTTL(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Lock()
+	as := f.services[serviceID(p)]
+	f.Unlock()
+	wantTags := []string{"ratelimit.SayHello.rate=10"}
+	if !reflect.DeepEqual(as.Tags, wantTags) {
+		t.Errorf("Tags = %v, want %v", as.Tags, wantTags)
+	}
+	if as.Meta["funcs"] != "SayHello,SayWorld" || as.Address != "127.0.0.1" || as.Port != 17312 {
+		t.Errorf("service = %+v", as)
+	}
+	if as.Check == nil || as.Check.TTL != "1m0s" {
+		t.Errorf("Check = %+v, want ttl check", as.Check)
+	}
+
+	// unchanged service only pass its ttl check
+	if err := r.Register(p, registry.RegisterTTL(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	f.Lock()
+	registers := f.registers
+	f.Unlock()
+	if registers != 2 {
+		t.Errorf("registers = %d, want %d", registers, 2)
+	}
+
+	services, err := r.GetService("Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || !reflect.DeepEqual(services[0], p) {
+		t.Errorf("GetService() = %v, want %v", services, []registry.Service{p})
+	}
+	services, err = r.ListServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 2 {
+		t.Errorf("ListServices() = %v", services)
+	}
+
+	// service with critical check is not discovered
+	f.fail(serviceID(p))
+	if services, _ := r.GetService("Hello"); len(services) != 0 {
+		t.Errorf("GetService() = %v, want no service", services)
+	}
+	// register again after check failed
+	if err := r.Register(p, registry.RegisterTTL(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if services, _ := r.GetService("Hello"); len(services) != 1 {
+		t.Errorf("GetService() = %v, want 1 service", services)
+	}
+
+	if err := r.Deregister(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Deregister(p); err == nil {
+		t.Errorf("Deregister() err = %v, want not nil", err)
+	}
+	if services, _ := r.GetService("Hello"); len(services) != 0 {
+		t.Errorf("GetService() = %v, want no service", services)
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	for _, token := range f.tokens {
+		if token != "secret" {
+			t.Errorf("X-Consul-Token = %v, want %v", token, "secret")
+		}
+	}
+}
+
+func TestRegistry_TCPCheck(t *testing.T) {
+	r, f, stop := newTestRegistry(t, TCPCheck(10*time.Second))
+	defer stop()
+
+	p := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	if err := r.Register(p, registry.RegisterTTL(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	f.Lock()
+	check := f.services[serviceID(p)].Check
+	f.Unlock()
+	want := &agentCheck{
+		TCP:                            "127.0.0.1:17312",
+		Interval:                       "10s",
+		DeregisterCriticalServiceAfter: "1m0s",
+	}
+	if !reflect.DeepEqual(check, want) {
+		t.Errorf("Check = %+v, want %+v", check, want)
+	}
+}
+
+func TestRegistry_WatchCheck(t *testing.T) {
+	r, f, stop := newTestRegistry(t)
+	defer stop()
+
+	p := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	if err := r.Register(p); err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Watch(registry.WatchService("Hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// labels are not part of service id, so change of them is update
+	p.Labels["weight"] = "10"
+	if err := r.Register(p); err != nil {
+		t.Fatal(err)
+	}
+	if result := registrytest.Next(t, w); result.Action != "update" || !registry.Equal(result.Service, p) {
+		t.Errorf("Next() = %v, want update %v", result, p)
+	}
+	// service with critical check is deleted
+	f.fail(serviceID(p))
+	if result := registrytest.Next(t, w); result.Action != "delete" || !registry.Equal(result.Service, p) {
+		t.Errorf("Next() = %v, want delete %v", result, p)
+	}
+}
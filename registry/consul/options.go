@@ -0,0 +1,50 @@
+package consul
+
+import (
+	"context"
+	"time"
+
+	"github.com/haormj/dodo/registry"
+)
+
+type tcpCheckKey struct{}
+type deregisterAfterKey struct{}
+type tokenKey struct{}
+type waitTimeKey struct{}
+
+func setOption(o *registry.Options, k, v interface{}) {
+	if o.Context == nil {
+		o.Context = context.Background()
+	}
+	o.Context = context.WithValue(o.Context, k, v)
+}
+
+// TCPCheck sets the interval of tcp check of service address, the
+// default is ttl check which is passed for each register
+func TCPCheck(interval time.Duration) registry.Option {
+	return func(o *registry.Options) {
+		setOption(o, tcpCheckKey{}, interval)
+	}
+}
+
+// DeregisterCriticalAfter sets the time after which service with
+// critical check is deregistered by consul, min is one minute
+func DeregisterCriticalAfter(d time.Duration) registry.Option {
+	return func(o *registry.Options) {
+		setOption(o, deregisterAfterKey{}, d)
+	}
+}
+
+// Token sets the acl token of consul
+func Token(token string) registry.Option {
+	return func(o *registry.Options) {
+		setOption(o, tokenKey{}, token)
+	}
+}
+
+// WaitTime sets the max wait of blocking query of watcher
+func WaitTime(d time.Duration) registry.Option {
+	return func(o *registry.Options) {
+		setOption(o, waitTimeKey{}, d)
+	}
+}
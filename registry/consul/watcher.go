@@ -0,0 +1,127 @@
+package consul
+
+import (
+	"context"
+	"time"
+
+	"github.com/haormj/dodo/log"
+	"github.com/haormj/dodo/registry"
+)
+
+// retryInterval is the wait before query again after query failed
+var retryInterval = time.Second
+
+// consulWatcher watch by blocking query, health of service is watched
+// when service is specified, otherwise catalog of services is watched
+// and health of all services is read after it returns, so change of
+// check status is found at most WaitTime later
+type consulWatcher struct {
+	r      *consulRegistry
+	wo     registry.WatchOptions
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	index uint64
+	// services of the last query, key is id of service
+	services map[string]registry.Service
+	results  []registry.Result
+}
+
+func newConsulWatcher(r *consulRegistry, opts ...registry.WatchOption) (registry.Watcher, error) {
+	var wo registry.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	cw := &consulWatcher{
+		r:  r,
+		wo: wo,
+	}
+	cw.ctx, cw.cancel = context.WithCancel(context.Background())
+
+	// services already registered are not reported
+	ctx, cancel := context.WithTimeout(cw.ctx, r.options.Timeout)
+	defer cancel()
+	services, index, err := cw.query(ctx, 0)
+	if err != nil {
+		cw.cancel()
+		return nil, err
+	}
+	cw.services = services
+	cw.index = index
+	return cw, nil
+}
+
+// query services to watch, index > 0 is blocking query
+func (cw *consulWatcher) query(ctx context.Context, index uint64) (map[string]registry.Service, uint64, error) {
+	var svcs []registry.Service
+	if len(cw.wo.Service) > 0 {
+		var err error
+		svcs, index, err = cw.r.health(ctx, cw.wo.Service, index)
+		if err != nil {
+			return nil, 0, err
+		}
+	} else {
+		names, i, err := cw.r.catalog(ctx, index)
+		if err != nil {
+			return nil, 0, err
+		}
+		index = i
+		for _, name := range names {
+			s, _, err := cw.r.health(ctx, name, 0)
+			if err != nil {
+				return nil, 0, err
+			}
+			svcs = append(svcs, s...)
+		}
+	}
+	services := make(map[string]registry.Service)
+	for _, s := range svcs {
+		// only providers are watched for one service
+		if len(cw.wo.Service) > 0 && s.Side != "provider" {
+			continue
+		}
+		services[serviceID(s)] = s
+	}
+	return services, index, nil
+}
+
+func (cw *consulWatcher) Next() (registry.Result, error) {
+	for {
+		if len(cw.results) > 0 {
+			r := cw.results[0]
+			cw.results = cw.results[1:]
+			return r, nil
+		}
+
+		// index 0 is not blocking, at least 1 is used
+		index := cw.index
+		if index == 0 {
+			index = 1
+		}
+		services, index, err := cw.query(cw.ctx, index)
+		if cw.ctx.Err() != nil {
+			return registry.Result{}, cw.ctx.Err()
+		}
+		if err != nil {
+			log.Warnf("watch of consul failed: %v", err)
+			select {
+			case <-time.After(retryInterval):
+			case <-cw.ctx.Done():
+				return registry.Result{}, cw.ctx.Err()
+			}
+			continue
+		}
+		// index is reset, e.g. consul is restarted
+		if index < cw.index {
+			index = 0
+		}
+		cw.index = index
+		cw.results = registry.Diff(cw.services, services)
+		cw.services = services
+	}
+}
+
+func (cw *consulWatcher) Stop() {
+	cw.cancel()
+}
@@ -0,0 +1,320 @@
+// Package etcdv3 provides an etcd v3 registry, all services registered
+// with TTL are attached to one lease, which is kept alive until all of
+// them are deregistered, then the lease is revoked. Keys are same as
+// registry/etcd, /dodo/serviceName/providers/urlencode(url).
+package etcdv3
+
+import (
+	"context"
+	"crypto/tls"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haormj/dodo/log"
+	"github.com/haormj/dodo/registry"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+)
+
+var (
+	prefix = "/dodo"
+
+	// DefaultTimeout of each request to etcd
+	DefaultTimeout = 5 * time.Second
+)
+
+type etcdv3Registry struct {
+	client  *clientv3.Client
+	options registry.Options
+
+	sync.Mutex
+	// lease of services registered with TTL, cancel stop keeping it alive
+	leaseID clientv3.LeaseID
+	cancel  context.CancelFunc
+	// keys registered by this registry and the lease they attached to
+	keys map[string]clientv3.LeaseID
+}
+
+func NewRegistry(opts ...registry.Option) registry.Registry {
+	e := &etcdv3Registry{
+		options: registry.Options{},
+		keys:    make(map[string]clientv3.LeaseID),
+	}
+	configure(e, opts...)
+	return e
+}
+
+func configure(e *etcdv3Registry, opts ...registry.Option) error {
+	config := clientv3.Config{
+		Endpoints: []string{"127.0.0.1:2379"},
+	}
+
+	for _, o := range opts {
+		o(&e.options)
+	}
+
+	if e.options.Timeout == 0 {
+		e.options.Timeout = DefaultTimeout
+	}
+	config.DialTimeout = e.options.Timeout
+
+	if e.options.Secure || e.options.TLSConfig != nil {
+		tlsConfig := e.options.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{
+				InsecureSkipVerify: true,
+			}
+		}
+		config.TLS = tlsConfig
+	}
+
+	var cAddrs []string
+
+	for _, addr := range e.options.Addrs {
+		if len(addr) == 0 {
+			continue
+		}
+		cAddrs = append(cAddrs, addr)
+	}
+
+	// if we got addrs then we'll update
+	if len(cAddrs) > 0 {
+		config.Endpoints = cAddrs
+	}
+
+	c, err := clientv3.New(config)
+	if err != nil {
+		return err
+	}
+	e.Lock()
+	if e.client != nil {
+		e.client.Close()
+	}
+	e.client = c
+	e.Unlock()
+	return nil
+}
+
+func servicePath(s string) string {
+	return path.Join(prefix, s, "providers") + "/"
+}
+
+func serviceKey(s registry.Service) string {
+	return path.Join(prefix, s.Name, s.Side+"s", registry.Format(s))
+}
+
+// parseKey get service from key, key is invalid if it is not
+// /dodo/serviceName/side/service
+func parseKey(key string) (registry.Service, bool) {
+	splits := strings.Split(key, "/")
+	if len(splits) != 5 {
+		log.Warn(key + " invalid service")
+		return registry.Service{}, false
+	}
+	service, err := registry.Parse(splits[4])
+	if err != nil {
+		log.Errorf("key:%v,err:%v", key, err)
+		return registry.Service{}, false
+	}
+	return service, true
+}
+
+func (e *etcdv3Registry) Init(opts ...registry.Option) error {
+	return configure(e, opts...)
+}
+
+func (e *etcdv3Registry) Options() registry.Options {
+	return e.options
+}
+
+// grant lease with ttl and keep it alive, the existing lease is used
+// if it is still alive, lease is created for the first register
+// and after it is lost, e.g. etcd is unavailable longer than ttl
+func (e *etcdv3Registry) grant(ttl time.Duration) (clientv3.LeaseID, error) {
+	if e.leaseID != clientv3.NoLease {
+		return e.leaseID, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.options.Timeout)
+	defer cancel()
+
+	seconds := int64(ttl / time.Second)
+	if seconds <= 0 {
+		seconds = 1
+	}
+	rsp, err := e.client.Grant(ctx, seconds)
+	if err != nil {
+		return clientv3.NoLease, err
+	}
+
+	kaCtx, kaCancel := context.WithCancel(context.Background())
+	ch, err := e.client.KeepAlive(kaCtx, rsp.ID)
+	if err != nil {
+		kaCancel()
+		return clientv3.NoLease, err
+	}
+	go func(id clientv3.LeaseID) {
+		for range ch {
+		}
+		// lease is expired or revoked, grant a new one for next register
+		e.Lock()
+		if e.leaseID == id {
+			log.Warnf("lease %x of etcd is lost", id)
+			e.leaseID = clientv3.NoLease
+			e.cancel = nil
+		}
+		e.Unlock()
+		kaCancel()
+	}(rsp.ID)
+
+	e.leaseID = rsp.ID
+	e.cancel = kaCancel
+	return rsp.ID, nil
+}
+
+// revoke lease, all keys attached to it are deleted
+func (e *etcdv3Registry) revoke() error {
+	if e.leaseID == clientv3.NoLease {
+		return nil
+	}
+	id := e.leaseID
+	e.cancel()
+	e.leaseID = clientv3.NoLease
+	e.cancel = nil
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.options.Timeout)
+	defer cancel()
+
+	if _, err := e.client.Revoke(ctx, id); err != nil && err != rpctypes.ErrLeaseNotFound {
+		return err
+	}
+	return nil
+}
+
+func (e *etcdv3Registry) Register(s registry.Service, opts ...registry.RegisterOption) error {
+	var options registry.RegisterOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	key := serviceKey(s)
+	// key of the same service is already attached to the live lease, or
+	// without lease, put it again only makes an update event
+	if old, ok := e.keys[key]; ok {
+		if (options.TTL > 0 && old != clientv3.NoLease && old == e.leaseID) ||
+			(options.TTL <= 0 && old == clientv3.NoLease) {
+			return nil
+		}
+	}
+	var id clientv3.LeaseID
+	put := func() error {
+		id = clientv3.NoLease
+		var putOpts []clientv3.OpOption
+		if options.TTL > 0 {
+			var err error
+			id, err = e.grant(options.TTL)
+			if err != nil {
+				return err
+			}
+			putOpts = append(putOpts, clientv3.WithLease(id))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), e.options.Timeout)
+		defer cancel()
+
+		_, err := e.client.Put(ctx, key, "", putOpts...)
+		return err
+	}
+	err := put()
+	// lease is expired before keep alive found it
+	if err == rpctypes.ErrLeaseNotFound {
+		e.cancel()
+		e.leaseID = clientv3.NoLease
+		e.cancel = nil
+		err = put()
+	}
+	if err != nil {
+		return err
+	}
+	e.keys[key] = id
+	return nil
+}
+
+// Deregister delete key of service, and revoke the lease after
+// all services registered by this registry are deregistered
+func (e *etcdv3Registry) Deregister(s registry.Service) error {
+	e.Lock()
+	defer e.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.options.Timeout)
+	defer cancel()
+
+	key := serviceKey(s)
+	if _, err := e.client.Delete(ctx, key); err != nil {
+		return err
+	}
+	delete(e.keys, key)
+
+	if len(e.keys) == 0 {
+		return e.revoke()
+	}
+	return nil
+}
+
+// GetService get providers of service, no error if there is no provider
+func (e *etcdv3Registry) GetService(name string) ([]registry.Service, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.options.Timeout)
+	defer cancel()
+
+	rsp, err := e.client.Get(ctx, servicePath(name), clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]registry.Service, 0)
+	for _, kv := range rsp.Kvs {
+		service, ok := parseKey(string(kv.Key))
+		if !ok {
+			continue
+		}
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
+func (e *etcdv3Registry) ListServices() ([]registry.Service, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.options.Timeout)
+	defer cancel()
+
+	rsp, err := e.client.Get(ctx, prefix+"/", clientv3.WithPrefix(),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]registry.Service, 0)
+	for _, kv := range rsp.Kvs {
+		service, ok := parseKey(string(kv.Key))
+		if !ok {
+			continue
+		}
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
+func (e *etcdv3Registry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	return newEtcdv3Watcher(e, opts...)
+}
+
+func (e *etcdv3Registry) String() string {
+	return "etcdv3"
+}
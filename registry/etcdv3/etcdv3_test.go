@@ -0,0 +1,296 @@
+package etcdv3
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/haormj/dodo/log"
+	"github.com/haormj/dodo/registry"
+	"github.com/haormj/dodo/registry/registrytest"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/embed"
+	"github.com/coreos/pkg/capnslog"
+)
+
+const (
+	clientURL = "http://127.0.0.1:27410"
+	peerURL   = "http://127.0.0.1:27411"
+)
+
+func TestMain(m *testing.M) {
+	log.SetDummyLogger()
+	capnslog.SetGlobalLogLevel(capnslog.CRITICAL)
+	os.Exit(m.Run())
+}
+
+// startEtcd start embedded etcd with data in dir
+func startEtcd(t *testing.T, dir string) *embed.Etcd {
+	cu, _ := url.Parse(clientURL)
+	pu, _ := url.Parse(peerURL)
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LCUrls, cfg.ACUrls = []url.URL{*cu}, []url.URL{*cu}
+	cfg.LPUrls, cfg.APUrls = []url.URL{*pu}, []url.URL{*pu}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		e.Close()
+		t.Fatal("etcd is not ready")
+	}
+	return e
+}
+
+func newTestRegistry(t *testing.T) (*etcdv3Registry, func()) {
+	dir, err := ioutil.TempDir("", "etcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := startEtcd(t, dir)
+	r := NewRegistry(registry.Addrs(clientURL)).(*etcdv3Registry)
+	return r, func() {
+		r.client.Close()
+		e.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// leaseKeys get number of keys attached to lease, -1 if lease is not found
+func leaseKeys(t *testing.T, r *etcdv3Registry, id clientv3.LeaseID) int {
+	rsp, err := r.client.TimeToLive(context.Background(), id, clientv3.WithAttachedKeys())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.TTL == -1 {
+		return -1
+	}
+	return len(rsp.Keys)
+}
+
+func TestRegistry(t *testing.T) {
+	r, stop := newTestRegistry(t)
+	defer stop()
+	registrytest.TestRegistry(t, r)
+}
+
+func TestRegistry_Lease(t *testing.T) {
+	r, stop := newTestRegistry(t)
+	defer stop()
+
+	s1 := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	s2 := registrytest.NewService("Hello", "127.0.0.1:17313", "provider")
+	c := registrytest.NewService("Hello", "127.0.0.1:0", "consumer")
+	for _, s := range []registry.Service{s1, s2, c} {
+		if err := r.Register(s, registry.RegisterTTL(10*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// register again keep the same lease
+	id := r.leaseID
+	if err := r.Register(s1, registry.RegisterTTL(10*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if r.leaseID != id {
+		t.Errorf("leaseID = %x, want %x", r.leaseID, id)
+	}
+	if n := leaseKeys(t, r, id); n != 3 {
+		t.Errorf("keys of lease = %d, want %d", n, 3)
+	}
+
+	for _, s := range []registry.Service{s1, s2} {
+		if err := r.Deregister(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := leaseKeys(t, r, id); n != 1 {
+		t.Errorf("keys of lease = %d, want %d", n, 1)
+	}
+	// lease is revoked after all services are deregistered
+	if err := r.Deregister(c); err != nil {
+		t.Fatal(err)
+	}
+	if n := leaseKeys(t, r, id); n != -1 {
+		t.Errorf("keys of lease = %d, want %d", n, -1)
+	}
+	services, err := r.ListServices()
+	if err != nil || len(services) != 0 {
+		t.Errorf("ListServices() = %v, %v", services, err)
+	}
+}
+
+func TestRegistry_LeaseLost(t *testing.T) {
+	r, stop := newTestRegistry(t)
+	defer stop()
+
+	s := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	if err := r.Register(s, registry.RegisterTTL(10*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	id := r.leaseID
+	// lease is lost, e.g. expired when etcd is unavailable
+	if _, err := r.client.Revoke(context.Background(), id); err != nil {
+		t.Fatal(err)
+	}
+	// register again before keep alive found it is lost is skipped
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		r.Lock()
+		lost := r.leaseID != id
+		r.Unlock()
+		if lost {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("lease is not lost")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err := r.Register(s, registry.RegisterTTL(10*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if r.leaseID == id || r.leaseID == clientv3.NoLease {
+		t.Errorf("leaseID = %x, want new lease", r.leaseID)
+	}
+	if services, _ := r.GetService("Hello"); len(services) != 1 {
+		t.Errorf("GetService() = %v, want 1 service", services)
+	}
+}
+
+func TestRegistry_RegisterAgain(t *testing.T) {
+	r, stop := newTestRegistry(t)
+	defer stop()
+
+	w, err := r.Watch(registry.WatchService("Hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	// register the same service again is not put again
+	s := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	for i := 0; i < 3; i++ {
+		if err := r.Register(s, registry.RegisterTTL(10*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if result := registrytest.Next(t, w); result.Action != "create" || !registry.Equal(result.Service, s) {
+		t.Errorf("Next() = %v, want create %v", result, s)
+	}
+	// changed service is put with new key
+	s1 := s
+	s1.Timestamp++
+	if err := r.Register(s1, registry.RegisterTTL(10*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if result := registrytest.Next(t, w); result.Action != "create" || !registry.Equal(result.Service, s1) {
+		t.Errorf("Next() = %v, want create %v", result, s1)
+	}
+	// register without TTL is put again to detach from lease
+	if err := r.Register(s); err != nil {
+		t.Fatal(err)
+	}
+	if result := registrytest.Next(t, w); result.Action != "update" || !registry.Equal(result.Service, s) {
+		t.Errorf("Next() = %v, want update %v", result, s)
+	}
+}
+
+func TestRegistry_Watch(t *testing.T) {
+	r, stop := newTestRegistry(t)
+	defer stop()
+	registrytest.TestWatch(t, r)
+}
+
+func TestRegistry_WatchResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	e := startEtcd(t, dir)
+	r := NewRegistry(registry.Addrs(clientURL)).(*etcdv3Registry)
+	defer r.client.Close()
+
+	w, err := r.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	s1 := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	if err := r.Register(s1); err != nil {
+		t.Fatal(err)
+	}
+	if result := registrytest.Next(t, w); result.Action != "create" || !registry.Equal(result.Service, s1) {
+		t.Errorf("Next() = %v, want create %v", result, s1)
+	}
+
+	// restart etcd, watch is resumed after reconnect
+	e.Close()
+	e = startEtcd(t, dir)
+	defer e.Close()
+	s2 := registrytest.NewService("Hello", "127.0.0.1:17313", "provider")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if err := r.Register(s2); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Register() timeout")
+		}
+	}
+	if result := registrytest.Next(t, w); result.Action != "create" || !registry.Equal(result.Service, s2) {
+		t.Errorf("Next() = %v, want create %v", result, s2)
+	}
+}
+
+func TestRegistry_WatchCompacted(t *testing.T) {
+	r, stop := newTestRegistry(t)
+	defer stop()
+
+	s0 := registrytest.NewService("Hello", "127.0.0.1:17311", "provider")
+	if err := r.Register(s0); err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Watch(registry.WatchService("Hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	ew := w.(*etcdv3Watcher)
+	rev := ew.rev
+
+	// events after rev are compacted before they are got
+	s1 := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	if err := r.Register(s1); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Deregister(s0); err != nil {
+		t.Fatal(err)
+	}
+	rsp, err := r.client.Get(context.Background(), "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.client.Compact(context.Background(), rsp.Header.Revision); err != nil {
+		t.Fatal(err)
+	}
+	ew.cancel()
+	ew.ctx, ew.cancel = context.WithCancel(context.Background())
+	ew.rev = rev
+	ew.watch()
+
+	// changes are got by reading again
+	if result := registrytest.Next(t, w); result.Action != "delete" || !registry.Equal(result.Service, s0) {
+		t.Errorf("Next() = %v, want delete %v", result, s0)
+	}
+	if result := registrytest.Next(t, w); result.Action != "create" || !registry.Equal(result.Service, s1) {
+		t.Errorf("Next() = %v, want create %v", result, s1)
+	}
+}
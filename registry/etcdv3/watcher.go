@@ -0,0 +1,178 @@
+package etcdv3
+
+import (
+	"context"
+	"time"
+
+	"github.com/haormj/dodo/log"
+	"github.com/haormj/dodo/registry"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+// resumeInterval is the wait before watch again after watch is broken
+var resumeInterval = time.Second
+
+// etcdv3Watcher watch keys from revision, and resume from the next
+// revision of the last event when watch is broken, if the revision is
+// compacted, keys are read again and compared with the known services
+type etcdv3Watcher struct {
+	client  *clientv3.Client
+	path    string
+	timeout time.Duration
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	w clientv3.WatchChan
+	// rev is the revision to watch from
+	rev int64
+	// services known by events, key is key of service
+	services map[string]registry.Service
+	results  []registry.Result
+}
+
+func newEtcdv3Watcher(r *etcdv3Registry, opts ...registry.WatchOption) (registry.Watcher, error) {
+	var wo registry.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	// watch everything by default
+	watchPath := prefix + "/"
+	// watch a service
+	if len(wo.Service) > 0 {
+		watchPath = servicePath(wo.Service)
+	}
+
+	r.Lock()
+	client := r.client
+	r.Unlock()
+
+	ew := &etcdv3Watcher{
+		client:  client,
+		path:    watchPath,
+		timeout: r.options.Timeout,
+	}
+	ew.ctx, ew.cancel = context.WithCancel(context.Background())
+	// watch changes after the current revision
+	services, rev, err := ew.load()
+	if err != nil {
+		ew.cancel()
+		return nil, err
+	}
+	ew.services = services
+	ew.rev = rev + 1
+	ew.watch()
+	return ew, nil
+}
+
+// load get services to watch and the revision of them
+func (ew *etcdv3Watcher) load() (map[string]registry.Service, int64, error) {
+	ctx, cancel := context.WithTimeout(ew.ctx, ew.timeout)
+	defer cancel()
+	rsp, err := ew.client.Get(ctx, ew.path, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+	services := make(map[string]registry.Service)
+	for _, kv := range rsp.Kvs {
+		if service, ok := parseKey(string(kv.Key)); ok {
+			services[string(kv.Key)] = service
+		}
+	}
+	return services, rsp.Header.Revision, nil
+}
+
+// resync read services again after events are compacted, changes are
+// got by comparing with the known services
+func (ew *etcdv3Watcher) resync() error {
+	services, rev, err := ew.load()
+	if err != nil {
+		return err
+	}
+	ew.results = registry.Diff(ew.services, services)
+	ew.services = services
+	ew.rev = rev + 1
+	return nil
+}
+
+func (ew *etcdv3Watcher) watch() {
+	// watch is closed when leader is lost, so it can be resumed
+	ctx := clientv3.WithRequireLeader(ew.ctx)
+	ew.w = ew.client.Watch(ctx, ew.path, clientv3.WithPrefix(), clientv3.WithRev(ew.rev))
+}
+
+// resume watch after resumeInterval
+func (ew *etcdv3Watcher) resume() error {
+	select {
+	case <-time.After(resumeInterval):
+	case <-ew.ctx.Done():
+		return ew.ctx.Err()
+	}
+	ew.watch()
+	return nil
+}
+
+func (ew *etcdv3Watcher) Next() (registry.Result, error) {
+	for {
+		if len(ew.results) > 0 {
+			r := ew.results[0]
+			ew.results = ew.results[1:]
+			return r, nil
+		}
+
+		rsp, ok := <-ew.w
+		if ew.ctx.Err() != nil {
+			return registry.Result{}, ew.ctx.Err()
+		}
+		// events before compact revision are lost, read all again
+		if rsp.CompactRevision > 0 {
+			log.Warnf("watch of %s is compacted from %d to %d", ew.path, ew.rev, rsp.CompactRevision)
+			if err := ew.resync(); err != nil {
+				log.Warnf("read %s failed: %v", ew.path, err)
+				if err := ew.resume(); err != nil {
+					return registry.Result{}, err
+				}
+				continue
+			}
+			ew.watch()
+			continue
+		}
+		if !ok || rsp.Canceled || rsp.Err() != nil {
+			log.Warnf("watch of %s is broken: %v, resume from %d", ew.path, rsp.Err(), ew.rev)
+			if err := ew.resume(); err != nil {
+				return registry.Result{}, err
+			}
+			continue
+		}
+
+		for _, ev := range rsp.Events {
+			ew.rev = ev.Kv.ModRevision + 1
+			key := string(ev.Kv.Key)
+			service, ok := parseKey(key)
+			if !ok {
+				continue
+			}
+			action := "update"
+			switch {
+			case ev.Type == mvccpb.DELETE:
+				action = "delete"
+				delete(ew.services, key)
+			case ev.IsCreate():
+				action = "create"
+				ew.services[key] = service
+			default:
+				ew.services[key] = service
+			}
+			ew.results = append(ew.results, registry.Result{
+				Action:  action,
+				Service: service,
+			})
+		}
+	}
+}
+
+func (ew *etcdv3Watcher) Stop() {
+	ew.cancel()
+}
@@ -0,0 +1,414 @@
+// Package file provides a registry on top of a directory of yaml/json
+// files, one file for each service, or a single file of all services,
+// so small deployments can work without etcd. The format of file is
+// same as the config of selector/cache, e.g.
+//
+//	# Hello.yaml
+//	- protocol: rpc
+//	  address: 127.0.0.1:17312
+//	  name: Hello
+//	  version: 0.1.0
+//	  funcs: [SayHello]
+//	  codecs: [json]
+//	  transport: grpc
+//	  side: provider
+//	  timestamp: 1543311057
+//
+// Services registered with TTL are written with the time of register
+// and the TTL in seconds, and expire if they are not registered again
+// in TTL. Writes of all processes are serialized by flock of a .lock
+// file in the directory.
+package file
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haormj/dodo/log"
+	"github.com/haormj/dodo/registry"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// DefaultPath is the directory of services when no path is set
+	DefaultPath = "../config/registry"
+	// DefaultPollInterval is the interval of watcher reading services
+	DefaultPollInterval = time.Second
+
+	exts = []string{".yaml", ".yml", ".json"}
+
+	now = time.Now
+)
+
+// record of service in file, service without TTL never expires
+type record struct {
+	registry.Service `yaml:",inline"`
+	// Registered is the unix time of the last register
+	Registered int64 `yaml:",omitempty" json:",omitempty"`
+	// TTL in seconds
+	TTL int64 `yaml:",omitempty" json:",omitempty"`
+}
+
+func (r record) expired(t time.Time) bool {
+	return r.TTL > 0 && t.Unix() >= r.Registered+r.TTL
+}
+
+type fileRegistry struct {
+	options registry.Options
+	// Mutex serialize writes in this process, flock of lockFile
+	// serialize writes of processes
+	sync.Mutex
+}
+
+func NewRegistry(opts ...registry.Option) registry.Registry {
+	f := &fileRegistry{
+		options: registry.Options{},
+	}
+	f.Init(opts...)
+	return f
+}
+
+func (f *fileRegistry) Init(opts ...registry.Option) error {
+	for _, o := range opts {
+		o(&f.options)
+	}
+	return nil
+}
+
+func (f *fileRegistry) Options() registry.Options {
+	return f.options
+}
+
+func (f *fileRegistry) path() string {
+	if f.options.Context != nil {
+		if v := f.options.Context.Value(pathKey{}); v != nil {
+			return v.(string)
+		}
+	}
+	if len(f.options.Addrs) > 0 && len(f.options.Addrs[0]) > 0 {
+		return f.options.Addrs[0]
+	}
+	return DefaultPath
+}
+
+func (f *fileRegistry) pollInterval() time.Duration {
+	if f.options.Context != nil {
+		if v := f.options.Context.Value(pollIntervalKey{}); v != nil {
+			return v.(time.Duration)
+		}
+	}
+	return DefaultPollInterval
+}
+
+// single judge whether all services are in one file
+func (f *fileRegistry) single() bool {
+	return isServiceFile(f.path())
+}
+
+func isServiceFile(p string) bool {
+	ext := filepath.Ext(p)
+	for _, e := range exts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceFile get the file of service, existing file of service with
+// any supported ext is used, otherwise it is name.yaml
+func (f *fileRegistry) serviceFile(name string) string {
+	if f.single() {
+		return f.path()
+	}
+	for _, ext := range exts {
+		p := filepath.Join(f.path(), name+ext)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return filepath.Join(f.path(), name+".yaml")
+}
+
+// lockFile get the file locked while services are written
+func (f *fileRegistry) lockFile() string {
+	if f.single() {
+		dir, base := filepath.Split(f.path())
+		return filepath.Join(dir, "."+base+".lock")
+	}
+	return filepath.Join(f.path(), ".lock")
+}
+
+// lock lock the lockFile, the returned func unlock it
+func (f *fileRegistry) lock() (func(), error) {
+	p := f.lockFile()
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(p, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := flock(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		funlock(file)
+		file.Close()
+	}, nil
+}
+
+// files get all files of services
+func (f *fileRegistry) files() ([]string, error) {
+	if f.single() {
+		return []string{f.path()}, nil
+	}
+	fis, err := ioutil.ReadDir(f.path())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, fi := range fis {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") || !isServiceFile(fi.Name()) {
+			continue
+		}
+		files = append(files, filepath.Join(f.path(), fi.Name()))
+	}
+	return files, nil
+}
+
+// load read services of all files, invalid file is skipped
+func (f *fileRegistry) load() ([]registry.Service, error) {
+	files, err := f.files()
+	if err != nil {
+		return nil, err
+	}
+	services := make([]registry.Service, 0)
+	for _, p := range files {
+		svcs, err := readFile(p)
+		if err != nil {
+			log.Errorf("file:%v,err:%v", p, err)
+			continue
+		}
+		services = append(services, svcs...)
+	}
+	return services, nil
+}
+
+// readFile read services in p which are not expired
+func readFile(p string) ([]registry.Service, error) {
+	records, err := readRecords(p)
+	if err != nil {
+		return nil, err
+	}
+	t := now()
+	var services []registry.Service
+	for _, r := range records {
+		if !r.expired(t) {
+			services = append(services, r.Service)
+		}
+	}
+	return services, nil
+}
+
+// readRecords read records in p, no record if p is not exist
+func readRecords(p string) ([]record, error) {
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []record
+	if filepath.Ext(p) == ".json" {
+		if len(strings.TrimSpace(string(b))) == 0 {
+			return nil, nil
+		}
+		err = json.Unmarshal(b, &records)
+	} else {
+		err = yaml.Unmarshal(b, &records)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// writeFile write records to temp file and rename it to p, so reader
+// never see partial file
+func writeFile(p string, records []record) error {
+	if records == nil {
+		records = make([]record, 0)
+	}
+	var b []byte
+	var err error
+	if filepath.Ext(p) == ".json" {
+		b, err = json.MarshalIndent(records, "", "  ")
+	} else {
+		b, err = yaml.Marshal(records)
+	}
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(p)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(p)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// id identify the registration of service, registration with the
+// same id is replaced
+func id(s registry.Service) string {
+	return s.Side + "/" + s.Name + "/" + s.Protocol + "://" + s.Address
+}
+
+// update read records of file of service, records not expired are
+// changed by fn and written back, both in lock
+func (f *fileRegistry) update(name string, fn func([]record) ([]record, error)) error {
+	f.Lock()
+	defer f.Unlock()
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	p := f.serviceFile(name)
+	records, err := readRecords(p)
+	if err != nil {
+		return err
+	}
+	t := now()
+	alive := make([]record, 0, len(records))
+	for _, r := range records {
+		if !r.expired(t) {
+			alive = append(alive, r)
+		}
+	}
+	changed, err := fn(alive)
+	if err != nil || changed == nil {
+		return err
+	}
+	return writeFile(p, changed)
+}
+
+func (f *fileRegistry) Register(s registry.Service, opts ...registry.RegisterOption) error {
+	var options registry.RegisterOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	r := record{Service: s}
+	if options.TTL > 0 {
+		r.Registered = now().Unix()
+		r.TTL = int64(options.TTL / time.Second)
+		if r.TTL <= 0 {
+			r.TTL = 1
+		}
+	}
+
+	return f.update(s.Name, func(records []record) ([]record, error) {
+		replaced := false
+		for i, old := range records {
+			if id(old.Service) == id(s) {
+				// service without TTL is not written again
+				if registry.Equal(old.Service, s) && old.TTL == 0 && r.TTL == 0 {
+					return nil, nil
+				}
+				records[i] = r
+				replaced = true
+			}
+		}
+		if !replaced {
+			records = append(records, r)
+		}
+		return records, nil
+	})
+}
+
+func (f *fileRegistry) Deregister(s registry.Service) error {
+	return f.update(s.Name, func(records []record) ([]record, error) {
+		left := make([]record, 0, len(records))
+		for _, r := range records {
+			if id(r.Service) != id(s) {
+				left = append(left, r)
+			}
+		}
+		if len(left) == len(records) {
+			return nil, registry.ErrNotFound
+		}
+		return left, nil
+	})
+}
+
+// GetService get providers of service
+func (f *fileRegistry) GetService(name string) ([]registry.Service, error) {
+	all, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	services := make([]registry.Service, 0)
+	for _, s := range all {
+		if s.Name != name {
+			continue
+		}
+		found = true
+		if s.Side == "provider" {
+			services = append(services, s)
+		}
+	}
+	// service without providers is found when its file exists, so
+	// watcher can know all providers are deregistered
+	if !found {
+		_, err := os.Stat(f.serviceFile(name))
+		found = err == nil
+	}
+	if !found {
+		return nil, registry.ErrNotFound
+	}
+	return services, nil
+}
+
+// ListServices get providers and consumers of all services
+func (f *fileRegistry) ListServices() ([]registry.Service, error) {
+	return f.load()
+}
+
+func (f *fileRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	return newFileWatcher(f, opts...)
+}
+
+func (f *fileRegistry) String() string {
+	return "file"
+}
@@ -0,0 +1,244 @@
+package file
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/haormj/dodo/log"
+	"github.com/haormj/dodo/registry"
+	"github.com/haormj/dodo/registry/registrytest"
+)
+
+// equal compare services by Format, empty and nil slices are same
+func equal(s1, s2 []registry.Service) bool {
+	if len(s1) != len(s2) {
+		return false
+	}
+	for i := range s1 {
+		if !registry.Equal(s1[i], s2[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "dodo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func testRegistry(t *testing.T, r registry.Registry) {
+	if _, err := r.GetService("Hello"); err != registry.ErrNotFound {
+		t.Errorf("GetService() err = %v, want %v", err, registry.ErrNotFound)
+	}
+	registrytest.TestRegistry(t, r)
+
+	// register again replace the old one
+	s := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	if err := r.Register(s); err != nil {
+		t.Fatal(err)
+	}
+	s.Timestamp++
+	if err := r.Register(s); err != nil {
+		t.Fatal(err)
+	}
+	services, err := r.GetService("Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []registry.Service{s}; !equal(services, want) {
+		t.Errorf("GetService() = %v, want %v", services, want)
+	}
+	if err := r.Deregister(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Deregister(s); err != registry.ErrNotFound {
+		t.Errorf("Deregister() err = %v, want %v", err, registry.ErrNotFound)
+	}
+}
+
+func TestRegistry_Dir(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	testRegistry(t, NewRegistry(Path(filepath.Join(dir, "registry"))))
+}
+
+func TestRegistry_File(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"services.yaml", "services.json"} {
+		t.Run(name, func(t *testing.T) {
+			testRegistry(t, NewRegistry(registry.Addrs(filepath.Join(dir, name))))
+		})
+	}
+}
+
+func TestRegistry_Config(t *testing.T) {
+	log.SetDummyLogger()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	config := `
+- protocol: rpc
+  address: 127.0.0.1:17312
+  name: Hello
+  version: 0.1.0
+  funcs: [SayHello]
+  codecs: [json]
+  transport: grpc
+  side: provider
+  timestamp: 1543311057
+  labels:
+    nodeID: "1"
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "Hello.yml"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "World.yaml"), []byte("invalid"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry(Path(dir))
+	services, err := r.GetService("Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []registry.Service{{
+		Protocol:  "rpc",
+		Address:   "127.0.0.1:17312",
+		Name:      "Hello",
+		Version:   "0.1.0",
+		Funcs:     []string{"SayHello"},
+		Codecs:    []string{"json"},
+		Transport: "grpc",
+		Side:      "provider",
+		Timestamp: 1543311057,
+		Labels:    map[string]string{"nodeID": "1"},
+	}}
+	if !equal(services, want) {
+		t.Errorf("GetService() = %v, want %v", services, want)
+	}
+	// existing file of service is updated
+	if err := r.Register(registrytest.NewService("Hello", "127.0.0.1:17313", "provider")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Hello.yaml")); !os.IsNotExist(err) {
+		t.Errorf("Stat() err = %v, want not exist", err)
+	}
+	if services, _ := r.GetService("Hello"); len(services) != 2 {
+		t.Errorf("GetService() = %v, want 2 services", services)
+	}
+}
+
+func TestRegistry_Watch(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	registrytest.TestWatch(t, NewRegistry(Path(dir), PollInterval(10*time.Millisecond)))
+}
+
+func TestRegistry_WatchUpdate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	r := NewRegistry(Path(dir), PollInterval(10*time.Millisecond))
+	w, err := r.Watch(registry.WatchService("Hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// register again with the same address is update
+	s := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	if err := r.Register(s); err != nil {
+		t.Fatal(err)
+	}
+	if result := registrytest.Next(t, w); result.Action != "create" || !registry.Equal(result.Service, s) {
+		t.Errorf("Next() = %v, want create %v", result, s)
+	}
+	s.Labels["weight"] = "10"
+	if err := r.Register(s); err != nil {
+		t.Fatal(err)
+	}
+	if result := registrytest.Next(t, w); result.Action != "update" || !registry.Equal(result.Service, s) {
+		t.Errorf("Next() = %v, want update %v", result, s)
+	}
+
+	w.Stop()
+	if _, err := w.Next(); err != ErrWatcherStopped {
+		t.Errorf("Next() err = %v, want %v", err, ErrWatcherStopped)
+	}
+}
+
+func TestRegistry_TTL(t *testing.T) {
+	defer func() { now = time.Now }()
+	t0 := time.Unix(1543311057, 0)
+	now = func() time.Time { return t0 }
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	r := NewRegistry(Path(dir))
+
+	s1 := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	s2 := registrytest.NewService("Hello", "127.0.0.1:17313", "provider")
+	if err := r.Register(s1, registry.RegisterTTL(10*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(s2); err != nil {
+		t.Fatal(err)
+	}
+	// register again before expired extends TTL
+	now = func() time.Time { return t0.Add(8 * time.Second) }
+	if err := r.Register(s1, registry.RegisterTTL(10*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	now = func() time.Time { return t0.Add(16 * time.Second) }
+	if services, _ := r.GetService("Hello"); len(services) != 2 {
+		t.Errorf("GetService() = %v, want 2 services", services)
+	}
+	// service without TTL never expires
+	now = func() time.Time { return t0.Add(18 * time.Second) }
+	services, err := r.GetService("Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []registry.Service{s2}; !equal(services, want) {
+		t.Errorf("GetService() = %v, want %v", services, want)
+	}
+	// expired service is removed by write
+	if err := r.Deregister(s1); err != registry.ErrNotFound {
+		t.Errorf("Deregister() err = %v, want %v", err, registry.ErrNotFound)
+	}
+}
+
+func TestRegistry_Lock(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// registries of different processes write the same file
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		r := NewRegistry(Path(dir))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				s := registrytest.NewService("Hello", fmt.Sprintf("127.0.0.1:%d", 17000+i*10+j), "provider")
+				if err := r.Register(s); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	services, err := NewRegistry(Path(dir)).GetService("Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 40 {
+		t.Errorf("GetService() = %d services, want %d", len(services), 40)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package file
+
+import (
+	"os"
+	"syscall"
+)
+
+// flock lock file exclusively, it blocks until file is unlocked
+func flock(file *os.File) error {
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+func funlock(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,13 @@
+package file
+
+import "os"
+
+// flock is not supported on windows, writes are only serialized in
+// the same process
+func flock(file *os.File) error {
+	return nil
+}
+
+func funlock(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,32 @@
+package file
+
+import (
+	"context"
+	"time"
+
+	"github.com/haormj/dodo/registry"
+)
+
+type pathKey struct{}
+type pollIntervalKey struct{}
+
+// Path sets the directory or the single yaml/json file of services,
+// path with ext .yaml, .yml or .json is taken as single file
+func Path(p string) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, pathKey{}, p)
+	}
+}
+
+// PollInterval sets the interval of watcher reading services
+func PollInterval(d time.Duration) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, pollIntervalKey{}, d)
+	}
+}
@@ -0,0 +1,93 @@
+package file
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/haormj/dodo/registry"
+)
+
+// ErrWatcherStopped is returned by Next after watcher is stopped
+var ErrWatcherStopped = errors.New("watcher stopped")
+
+// fileWatcher poll files and compare services with the last poll
+type fileWatcher struct {
+	r      *fileRegistry
+	wo     registry.WatchOptions
+	ticker *time.Ticker
+	once   sync.Once
+	stop   chan struct{}
+
+	// services of the last poll, key is id of service
+	services map[string]registry.Service
+	results  []registry.Result
+}
+
+func newFileWatcher(r *fileRegistry, opts ...registry.WatchOption) (registry.Watcher, error) {
+	var wo registry.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	fw := &fileWatcher{
+		r:    r,
+		wo:   wo,
+		stop: make(chan struct{}),
+	}
+	// services already registered are not reported
+	services, err := fw.poll()
+	if err != nil {
+		return nil, err
+	}
+	fw.services = services
+	fw.ticker = time.NewTicker(r.pollInterval())
+	return fw, nil
+}
+
+// poll read services to watch
+func (fw *fileWatcher) poll() (map[string]registry.Service, error) {
+	all, err := fw.r.load()
+	if err != nil {
+		return nil, err
+	}
+	services := make(map[string]registry.Service)
+	for _, s := range all {
+		// only providers are watched for one service
+		if len(fw.wo.Service) > 0 && (s.Name != fw.wo.Service || s.Side != "provider") {
+			continue
+		}
+		services[id(s)] = s
+	}
+	return services, nil
+}
+
+func (fw *fileWatcher) Next() (registry.Result, error) {
+	for {
+		if len(fw.results) > 0 {
+			r := fw.results[0]
+			fw.results = fw.results[1:]
+			return r, nil
+		}
+
+		select {
+		case <-fw.ticker.C:
+		case <-fw.stop:
+			return registry.Result{}, ErrWatcherStopped
+		}
+
+		services, err := fw.poll()
+		if err != nil {
+			return registry.Result{}, err
+		}
+		fw.results = registry.Diff(fw.services, services)
+		fw.services = services
+	}
+}
+
+func (fw *fileWatcher) Stop() {
+	fw.once.Do(func() {
+		fw.ticker.Stop()
+		close(fw.stop)
+	})
+}
@@ -0,0 +1,204 @@
+// Package memory provides an in-memory registry, it can be shared by
+// provider and consumer in the same process, e.g. in tests or
+// deployments of single process
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/haormj/dodo/registry"
+)
+
+// record of registered service, timer expire it when TTL is set
+type record struct {
+	service registry.Service
+	expires time.Time
+	timer   *time.Timer
+}
+
+type memoryRegistry struct {
+	options registry.Options
+
+	sync.RWMutex
+	// records of service name, key of records is formatted service,
+	// the entry of name is kept after all records are deleted
+	records  map[string]map[string]*record
+	watchers map[*memoryWatcher]struct{}
+}
+
+func NewRegistry(opts ...registry.Option) registry.Registry {
+	m := &memoryRegistry{
+		options:  registry.Options{},
+		records:  make(map[string]map[string]*record),
+		watchers: make(map[*memoryWatcher]struct{}),
+	}
+	m.Init(opts...)
+	return m
+}
+
+func (m *memoryRegistry) Init(opts ...registry.Option) error {
+	for _, o := range opts {
+		o(&m.options)
+	}
+	return nil
+}
+
+func (m *memoryRegistry) Options() registry.Options {
+	return m.options
+}
+
+func (m *memoryRegistry) Register(s registry.Service, opts ...registry.RegisterOption) error {
+	var options registry.RegisterOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	key := registry.Format(s)
+
+	m.Lock()
+	defer m.Unlock()
+
+	records, ok := m.records[s.Name]
+	if !ok {
+		records = make(map[string]*record)
+		m.records[s.Name] = records
+	}
+	action := "update"
+	r, ok := records[key]
+	if !ok {
+		action = "create"
+		r = &record{}
+		records[key] = r
+	}
+	r.service = copyService(s)
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	r.expires = time.Time{}
+	if options.TTL > 0 {
+		r.expires = time.Now().Add(options.TTL)
+		r.timer = time.AfterFunc(options.TTL, func() {
+			m.expire(s.Name, key)
+		})
+	}
+	m.notify(registry.Result{Action: action, Service: r.service})
+	return nil
+}
+
+// expire delete record whose TTL is passed without registered again
+func (m *memoryRegistry) expire(name, key string) {
+	m.Lock()
+	defer m.Unlock()
+	r, ok := m.records[name][key]
+	if !ok || r.expires.IsZero() || time.Now().Before(r.expires) {
+		return
+	}
+	delete(m.records[name], key)
+	m.notify(registry.Result{Action: "delete", Service: r.service})
+}
+
+func (m *memoryRegistry) Deregister(s registry.Service) error {
+	key := registry.Format(s)
+
+	m.Lock()
+	defer m.Unlock()
+
+	r, ok := m.records[s.Name][key]
+	if !ok {
+		return registry.ErrNotFound
+	}
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	delete(m.records[s.Name], key)
+	m.notify(registry.Result{Action: "delete", Service: r.service})
+	return nil
+}
+
+// GetService get providers of service
+func (m *memoryRegistry) GetService(name string) ([]registry.Service, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	records, ok := m.records[name]
+	if !ok {
+		return nil, registry.ErrNotFound
+	}
+	services := make([]registry.Service, 0)
+	for _, r := range records {
+		if r.service.Side != "provider" {
+			continue
+		}
+		services = append(services, copyService(r.service))
+	}
+	return services, nil
+}
+
+// ListServices get providers and consumers of all services
+func (m *memoryRegistry) ListServices() ([]registry.Service, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	services := make([]registry.Service, 0)
+	for _, records := range m.records {
+		for _, r := range records {
+			services = append(services, copyService(r.service))
+		}
+	}
+	return services, nil
+}
+
+func (m *memoryRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	var wo registry.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+	w := newMemoryWatcher(m, wo)
+
+	m.Lock()
+	m.watchers[w] = struct{}{}
+	m.Unlock()
+	return w, nil
+}
+
+// notify watchers, it is called with lock held
+func (m *memoryRegistry) notify(r registry.Result) {
+	for w := range m.watchers {
+		w.push(r)
+	}
+}
+
+func (m *memoryRegistry) removeWatcher(w *memoryWatcher) {
+	m.Lock()
+	delete(m.watchers, w)
+	m.Unlock()
+}
+
+func (m *memoryRegistry) String() string {
+	return "memory"
+}
+
+// copyService deep copy s, so registered service is not changed by caller
+func copyService(s registry.Service) registry.Service {
+	c := s
+	c.Funcs = copyStrings(s.Funcs)
+	c.Codecs = copyStrings(s.Codecs)
+	c.Compressors = copyStrings(s.Compressors)
+	c.Idempotent = copyStrings(s.Idempotent)
+	if s.Labels != nil {
+		c.Labels = make(map[string]string, len(s.Labels))
+		for k, v := range s.Labels {
+			c.Labels[k] = v
+		}
+	}
+	return c
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
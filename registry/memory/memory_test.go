@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/haormj/dodo/registry"
+	"github.com/haormj/dodo/registry/registrytest"
+)
+
+func TestRegistry(t *testing.T) {
+	registrytest.TestRegistry(t, NewRegistry())
+}
+
+func TestRegistry_Watch(t *testing.T) {
+	registrytest.TestWatch(t, NewRegistry())
+}
+
+func TestRegistry_NotFound(t *testing.T) {
+	r := NewRegistry()
+	if _, err := r.GetService("Hello"); err != registry.ErrNotFound {
+		t.Errorf("GetService() err = %v, want %v", err, registry.ErrNotFound)
+	}
+	s := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	if err := r.Register(s); err != nil {
+		t.Fatal(err)
+	}
+	// registered service is not changed by caller
+	s.Labels["weight"] = "10"
+	services, err := r.GetService("Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || services[0].Labels["weight"] != "" {
+		t.Errorf("GetService() = %v", services)
+	}
+	delete(s.Labels, "weight")
+
+	if err := r.Deregister(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Deregister(s); err != registry.ErrNotFound {
+		t.Errorf("Deregister() err = %v, want %v", err, registry.ErrNotFound)
+	}
+}
+
+func TestRegistry_TTL(t *testing.T) {
+	r := NewRegistry()
+	s := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	if err := r.Register(s, registry.RegisterTTL(50*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	// register again before expired extends TTL
+	time.Sleep(30 * time.Millisecond)
+	if err := r.Register(s, registry.RegisterTTL(50*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if services, _ := r.GetService("Hello"); len(services) != 1 {
+		t.Errorf("GetService() = %v, want 1 service", services)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if services, _ := r.GetService("Hello"); len(services) != 0 {
+		t.Errorf("GetService() = %v, want no service", services)
+	}
+}
+
+func TestRegistry_WatchTTL(t *testing.T) {
+	r := NewRegistry()
+	w, err := r.Watch(registry.WatchService("Hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// register again is update, and expired is delete
+	s := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	if err := r.Register(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(s, registry.RegisterTTL(20*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for i := 0; i < 3; i++ {
+		result := registrytest.Next(t, w)
+		if !registry.Equal(result.Service, s) {
+			t.Errorf("Next() service = %v, want %v", result.Service, s)
+		}
+		got = append(got, result.Action)
+	}
+	want := []string{"create", "update", "delete"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Next() actions = %v, want %v", got, want)
+	}
+
+	w.Stop()
+	if _, err := w.Next(); err != ErrWatcherStopped {
+		t.Errorf("Next() err = %v, want %v", err, ErrWatcherStopped)
+	}
+}
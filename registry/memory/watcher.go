@@ -0,0 +1,74 @@
+package memory
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/haormj/dodo/registry"
+)
+
+// ErrWatcherStopped is returned by Next after watcher is stopped
+var ErrWatcherStopped = errors.New("watcher stopped")
+
+// memoryWatcher queue results, so registry is never blocked by watcher
+type memoryWatcher struct {
+	r    *memoryRegistry
+	wo   registry.WatchOptions
+	once sync.Once
+	stop chan struct{}
+
+	sync.Mutex
+	results []registry.Result
+	// signal has value when results is not empty
+	signal chan struct{}
+}
+
+func newMemoryWatcher(r *memoryRegistry, wo registry.WatchOptions) *memoryWatcher {
+	return &memoryWatcher{
+		r:      r,
+		wo:     wo,
+		stop:   make(chan struct{}),
+		signal: make(chan struct{}, 1),
+	}
+}
+
+// push r to results, only providers are watched for one service
+func (mw *memoryWatcher) push(r registry.Result) {
+	if len(mw.wo.Service) > 0 &&
+		(r.Service.Name != mw.wo.Service || r.Service.Side != "provider") {
+		return
+	}
+	mw.Lock()
+	mw.results = append(mw.results, r)
+	mw.Unlock()
+	select {
+	case mw.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (mw *memoryWatcher) Next() (registry.Result, error) {
+	for {
+		mw.Lock()
+		if len(mw.results) > 0 {
+			r := mw.results[0]
+			mw.results = mw.results[1:]
+			mw.Unlock()
+			return r, nil
+		}
+		mw.Unlock()
+
+		select {
+		case <-mw.signal:
+		case <-mw.stop:
+			return registry.Result{}, ErrWatcherStopped
+		}
+	}
+}
+
+func (mw *memoryWatcher) Stop() {
+	mw.once.Do(func() {
+		close(mw.stop)
+		mw.r.removeWatcher(mw)
+	})
+}
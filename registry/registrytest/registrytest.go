@@ -0,0 +1,162 @@
+// Package registrytest provides services and common tests shared by
+// implementations of registry, so tests of each implementation only
+// cover what is specific to it.
+package registrytest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/haormj/dodo/registry"
+)
+
+// NextTimeout is the max wait of Next
+var NextTimeout = 10 * time.Second
+
+// NewService create a service with all fields set
+func NewService(name, address, side string) registry.Service {
+	return registry.Service{
+		Protocol:    "rpc",
+		Address:     address,
+		Name:        name,
+		Version:     "0.1.0",
+		Funcs:       []string{"SayHello", "SayWorld"},
+		Codecs:      []string{"json", "proto"},
+		Compressors: []string{"gzip"},
+		Transport:   "grpc",
+		Side:        side,
+		TLS:         true,
+		Timestamp:   1543311057,
+		Labels:      map[string]string{"ratelimit.SayHello.rate": "10"},
+	}
+}
+
+// Next get the next result of w, test fails if it is not got in
+// NextTimeout
+func Next(t *testing.T, w registry.Watcher) registry.Result {
+	t.Helper()
+	ch := make(chan registry.Result, 1)
+	go func() {
+		r, err := w.Next()
+		if err != nil {
+			t.Error(err)
+		}
+		ch <- r
+	}()
+	select {
+	case r := <-ch:
+		return r
+	case <-time.After(NextTimeout):
+		t.Fatal("Next() timeout")
+	}
+	return registry.Result{}
+}
+
+// TestRegistry test register, discover and deregister of r, r should
+// be empty
+func TestRegistry(t *testing.T, r registry.Registry) {
+	t.Helper()
+	p1 := NewService("Hello", "127.0.0.1:17312", "provider")
+	p2 := NewService("Hello", "127.0.0.1:17313", "provider")
+	world := NewService("World", "127.0.0.1:17312", "provider")
+	c := NewService("Hello", "127.0.0.1:0", "consumer")
+	for _, s := range []registry.Service{p1, p2, world, c} {
+		if err := r.Register(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// only providers are discovered
+	services, err := r.GetService("Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 2 || !registry.Contains(services, p1) || !registry.Contains(services, p2) {
+		t.Errorf("GetService() = %v, want %v", services, []registry.Service{p1, p2})
+	}
+	services, err = r.ListServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 4 || !registry.Contains(services, c) || !registry.Contains(services, world) {
+		t.Errorf("ListServices() = %v", services)
+	}
+
+	for _, s := range []registry.Service{p2, world} {
+		if err := r.Deregister(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	services, err = r.GetService("Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || !registry.Equal(services[0], p1) {
+		t.Errorf("GetService() = %v, want %v", services, []registry.Service{p1})
+	}
+	// service without providers may be not found
+	services, err = r.GetService("World")
+	if (err != nil && err != registry.ErrNotFound) || len(services) != 0 {
+		t.Errorf("GetService() = %v, %v, want no service", services, err)
+	}
+
+	for _, s := range []registry.Service{p1, c} {
+		if err := r.Deregister(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestWatch test watch of one service and all services, r should be
+// empty
+func TestWatch(t *testing.T, r registry.Registry) {
+	t.Helper()
+	// registered before watch is not reported
+	existing := NewService("Hello", "127.0.0.1:17311", "provider")
+	if err := r.Register(existing); err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Watch(registry.WatchService("Hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// other services and consumers are not reported
+	p := NewService("Hello", "127.0.0.1:17312", "provider")
+	for _, s := range []registry.Service{
+		NewService("World", "127.0.0.1:17312", "provider"),
+		NewService("Hello", "127.0.0.1:0", "consumer"),
+		p,
+	} {
+		if err := r.Register(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if result := Next(t, w); result.Action != "create" || !registry.Equal(result.Service, p) {
+		t.Errorf("Next() = %v, want create %v", result, p)
+	}
+	if err := r.Deregister(existing); err != nil {
+		t.Fatal(err)
+	}
+	if result := Next(t, w); result.Action != "delete" || !registry.Equal(result.Service, existing) {
+		t.Errorf("Next() = %v, want delete %v", result, existing)
+	}
+	w.Stop()
+	if _, err := w.Next(); err == nil {
+		t.Errorf("Next() err = %v, want not nil", err)
+	}
+
+	all, err := r.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer all.Stop()
+	s := NewService("Foo", "127.0.0.1:17312", "provider")
+	if err := r.Register(s); err != nil {
+		t.Fatal(err)
+	}
+	if result := Next(t, all); result.Action != "create" || !registry.Equal(result.Service, s) {
+		t.Errorf("Next() = %v, want create %v", result, s)
+	}
+}
@@ -22,6 +22,11 @@ type Service struct {
 	TLS       bool
 	Timestamp int64
 	Labels    map[string]string
+
+	// Compressors supported, it is optional
+	Compressors []string
+	// Idempotent funcs can be retried automatically, it is optional
+	Idempotent []string
 }
 
 // Parse string to Service
@@ -67,6 +72,14 @@ func Parse(str string) (Service, error) {
 			service.Funcs = strings.Split(values[k][0], ",")
 		case "codecs":
 			service.Codecs = strings.Split(values[k][0], ",")
+		case "compressors":
+			if len(values[k][0]) != 0 {
+				service.Compressors = strings.Split(values[k][0], ",")
+			}
+		case "idempotent":
+			if len(values[k][0]) != 0 {
+				service.Idempotent = strings.Split(values[k][0], ",")
+			}
 		case "transport":
 			service.Transport = values[k][0]
 		case "side":
@@ -125,6 +138,13 @@ func Format(s Service) string {
 		s.TLS,
 		s.Timestamp,
 	)
+	// compressors is optional, keep format compatible when it is empty
+	if len(s.Compressors) != 0 {
+		str += fmt.Sprintf("&compressors=%s", strings.Join(s.Compressors, ","))
+	}
+	if len(s.Idempotent) != 0 {
+		str += fmt.Sprintf("&idempotent=%s", strings.Join(s.Idempotent, ","))
+	}
 	var keys []string
 	for k := range s.Labels {
 		keys = append(keys, k)
@@ -154,3 +174,13 @@ func Contains(services []Service, service Service) bool {
 	}
 	return false
 }
+
+// IsIdempotent judge whether funcName of s can be retried automatically
+func IsIdempotent(s Service, funcName string) bool {
+	for _, f := range s.Idempotent {
+		if f == funcName {
+			return true
+		}
+	}
+	return false
+}
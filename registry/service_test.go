@@ -0,0 +1,75 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		service Service
+	}{
+		{
+			name: "Service",
+			service: Service{
+				Protocol:  "rpc",
+				Address:   "127.0.0.1:17312",
+				Name:      "Hello",
+				Version:   "0.1.0",
+				Funcs:     []string{"SayHello", "SayWorld"},
+				Codecs:    []string{"json"},
+				Transport: "grpc",
+				Side:      "provider",
+				TLS:       true,
+				Timestamp: 1543311057,
+				Labels: map[string]string{
+					"nodeID": "1",
+				},
+			},
+		},
+		{
+			name: "ServiceWithCompressors",
+			service: Service{
+				Protocol:    "rpc",
+				Address:     "127.0.0.1:17312",
+				Name:        "Hello",
+				Version:     "0.1.0",
+				Funcs:       []string{"SayHello"},
+				Codecs:      []string{"json", "proto"},
+				Compressors: []string{"gzip", "snappy"},
+				Transport:   "grpc",
+				Side:        "provider",
+				Timestamp:   1543311057,
+				Labels:      map[string]string{},
+			},
+		},
+		{
+			name: "ServiceWithIdempotent",
+			service: Service{
+				Protocol:   "rpc",
+				Address:    "127.0.0.1:17312",
+				Name:       "Hello",
+				Version:    "0.1.0",
+				Funcs:      []string{"SayHello", "SayWorld"},
+				Codecs:     []string{"json"},
+				Idempotent: []string{"SayHello"},
+				Transport:  "grpc",
+				Side:       "provider",
+				Timestamp:  1543311057,
+				Labels:     map[string]string{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(Format(tt.service))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.service) {
+				t.Errorf("Parse(Format()) = %v, want %v", got, tt.service)
+			}
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package registry
 
+import "sort"
+
 // Watcher is an interface that returns updates
 // about services within the registry.
 type Watcher interface {
@@ -14,3 +16,34 @@ type Result struct {
 	Action  string
 	Service Service
 }
+
+// Diff get results from old to services, key of maps identify one
+// registration of service, so change of other fields is update,
+// results are sorted by key
+func Diff(old, services map[string]Service) []Result {
+	var keys []string
+	for k := range old {
+		keys = append(keys, k)
+	}
+	for k := range services {
+		if _, ok := old[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var results []Result
+	for _, k := range keys {
+		o, inOld := old[k]
+		s, inNew := services[k]
+		switch {
+		case !inOld:
+			results = append(results, Result{Action: "create", Service: s})
+		case !inNew:
+			results = append(results, Result{Action: "delete", Service: o})
+		case !Equal(o, s):
+			results = append(results, Result{Action: "update", Service: s})
+		}
+	}
+	return results
+}
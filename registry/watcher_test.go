@@ -0,0 +1,27 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a := Service{Name: "Hello", Address: "a"}
+	b := Service{Name: "Hello", Address: "b"}
+	c := Service{Name: "Hello", Address: "c"}
+	b2 := b
+	b2.Version = "0.2.0"
+	old := map[string]Service{"a": a, "b": b}
+	services := map[string]Service{"b": b2, "c": c}
+	want := []Result{
+		{Action: "delete", Service: a},
+		{Action: "update", Service: b2},
+		{Action: "create", Service: c},
+	}
+	if got := Diff(old, services); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %v, want %v", got, want)
+	}
+	if got := Diff(services, services); len(got) != 0 {
+		t.Errorf("Diff() = %v, want no result", got)
+	}
+}
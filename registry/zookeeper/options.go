@@ -0,0 +1,33 @@
+package zookeeper
+
+import (
+	"context"
+	"time"
+
+	"github.com/haormj/dodo/registry"
+)
+
+type rootKey struct{}
+type sessionTimeoutKey struct{}
+
+// Root sets the root path of services, e.g. /dubbo to discover
+// services of an existing dubbo tree, default is /dodo
+func Root(root string) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, rootKey{}, root)
+	}
+}
+
+// SessionTimeout sets the session timeout of zookeeper, registered
+// services are deleted by zookeeper after session is expired
+func SessionTimeout(d time.Duration) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, sessionTimeoutKey{}, d)
+	}
+}
@@ -0,0 +1,197 @@
+package zookeeper
+
+import (
+	"errors"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/haormj/dodo/log"
+	"github.com/haormj/dodo/registry"
+
+	"github.com/go-zookeeper/zk"
+)
+
+var (
+	// ErrWatcherStopped is returned by Next after watcher is stopped
+	ErrWatcherStopped = errors.New("watcher stopped")
+
+	// retryInterval is the wait before watch or read again after failed
+	retryInterval = time.Second
+)
+
+// zookeeperWatcher set child watch on providers node of services, and
+// root node when all services are watched, services are read again
+// and compared with the last read when any watch is triggered
+type zookeeperWatcher struct {
+	r    *zookeeperRegistry
+	wo   registry.WatchOptions
+	once sync.Once
+	stop chan struct{}
+	// notify has value when any watch is triggered
+	notify chan struct{}
+
+	// watched paths, only used by Next
+	watched map[string]bool
+	// services of the last read, key is id of service
+	services map[string]registry.Service
+	results  []registry.Result
+}
+
+func newZookeeperWatcher(r *zookeeperRegistry, opts ...registry.WatchOption) (registry.Watcher, error) {
+	var wo registry.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	zw := &zookeeperWatcher{
+		r:       r,
+		wo:      wo,
+		stop:    make(chan struct{}),
+		notify:  make(chan struct{}, 1),
+		watched: make(map[string]bool),
+	}
+	// services already registered are not reported
+	services, err := zw.load()
+	if err != nil {
+		zw.Stop()
+		return nil, err
+	}
+	zw.services = services
+	return zw, nil
+}
+
+// set child watch on p, or exist watch if p is not exist
+func (zw *zookeeperWatcher) set(p string) (<-chan zk.Event, error) {
+	c := zw.r.getConn()
+	for {
+		_, _, ch, err := c.ChildrenW(p)
+		if err != zk.ErrNoNode {
+			return ch, err
+		}
+		exists, _, ch, err := c.ExistsW(p)
+		if err != nil || !exists {
+			return ch, err
+		}
+	}
+}
+
+// watch p until watcher is stopped, watch is set before return, so
+// changes after it are not missed
+func (zw *zookeeperWatcher) watch(p string) error {
+	if zw.watched[p] {
+		return nil
+	}
+	ch, err := zw.set(p)
+	if err != nil {
+		return err
+	}
+	zw.watched[p] = true
+
+	go func() {
+		for {
+			select {
+			case <-ch:
+			case <-zw.stop:
+				return
+			}
+			select {
+			case zw.notify <- struct{}{}:
+			default:
+			}
+			for {
+				ch, err = zw.set(p)
+				if err == nil {
+					break
+				}
+				log.Warnf("watch of %s failed: %v", p, err)
+				select {
+				case <-time.After(retryInterval):
+				case <-zw.stop:
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// load set watches and read providers to watch
+func (zw *zookeeperWatcher) load() (map[string]registry.Service, error) {
+	names := []string{zw.wo.Service}
+	if len(zw.wo.Service) == 0 {
+		root := zw.r.root()
+		if err := zw.watch(root); err != nil {
+			return nil, err
+		}
+		var err error
+		names, _, err = zw.r.getConn().Children(root)
+		if err != nil && err != zk.ErrNoNode {
+			return nil, err
+		}
+	}
+
+	services := make(map[string]registry.Service)
+	for _, name := range names {
+		p := zw.r.servicePath(name, "provider")
+		if err := zw.watch(p); err != nil {
+			return nil, err
+		}
+		svcs, err := zw.r.children(p, "provider")
+		if err == zk.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range svcs {
+			services[id(s)] = s
+		}
+	}
+	return services, nil
+}
+
+// id identify the registration of service
+func id(s registry.Service) string {
+	return path.Join(s.Side, s.Name, s.Protocol+"://"+s.Address)
+}
+
+func (zw *zookeeperWatcher) Next() (registry.Result, error) {
+	for {
+		if len(zw.results) > 0 {
+			r := zw.results[0]
+			zw.results = zw.results[1:]
+			return r, nil
+		}
+
+		select {
+		case <-zw.notify:
+		case <-zw.stop:
+			return registry.Result{}, ErrWatcherStopped
+		}
+
+		services, err := zw.load()
+		if err != nil {
+			log.Warnf("read services of zookeeper failed: %v", err)
+			select {
+			case <-time.After(retryInterval):
+			case <-zw.stop:
+				return registry.Result{}, ErrWatcherStopped
+			}
+			// read again
+			select {
+			case zw.notify <- struct{}{}:
+			default:
+			}
+			continue
+		}
+		zw.results = registry.Diff(zw.services, services)
+		zw.services = services
+	}
+}
+
+func (zw *zookeeperWatcher) Stop() {
+	zw.once.Do(func() {
+		close(zw.stop)
+	})
+}
@@ -0,0 +1,333 @@
+// Package zookeeper provides a zookeeper registry with the layout of
+// dubbo, /root/serviceName/providers/urlencode(url), registrations are
+// ephemeral nodes, so they are deleted after session is expired, and
+// created again when new session is established. Url of dubbo is also
+// parsed, so services of an existing dubbo tree can be discovered.
+package zookeeper
+
+import (
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haormj/dodo/log"
+	"github.com/haormj/dodo/registry"
+
+	"github.com/go-zookeeper/zk"
+)
+
+var (
+	// DefaultRoot is the root path of services
+	DefaultRoot = "/dodo"
+	// DefaultSessionTimeout of zookeeper
+	DefaultSessionTimeout = 10 * time.Second
+)
+
+// conn is the operations of zookeeper used by registry
+type conn interface {
+	Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+	Delete(path string, version int32) error
+	Exists(path string) (bool, *zk.Stat, error)
+	ExistsW(path string) (bool, *zk.Stat, <-chan zk.Event, error)
+	Children(path string) ([]string, *zk.Stat, error)
+	ChildrenW(path string) ([]string, *zk.Stat, <-chan zk.Event, error)
+	SessionID() int64
+	Close()
+}
+
+// dial connect to zookeeper servers
+var dial = func(servers []string, sessionTimeout time.Duration) (conn, <-chan zk.Event, error) {
+	return zk.Connect(servers, sessionTimeout, zk.WithLogger(zkLogger{}))
+}
+
+// zkLogger write log of zookeeper client as debug
+type zkLogger struct{}
+
+func (zkLogger) Printf(format string, a ...interface{}) {
+	log.Debugf(format, a...)
+}
+
+type zookeeperRegistry struct {
+	options registry.Options
+
+	sync.Mutex
+	conn conn
+	// ephemeral nodes registered by this registry, they are created
+	// again when new session is established
+	nodes map[string]struct{}
+}
+
+func NewRegistry(opts ...registry.Option) registry.Registry {
+	z := &zookeeperRegistry{
+		options: registry.Options{},
+		nodes:   make(map[string]struct{}),
+	}
+	configure(z, opts...)
+	return z
+}
+
+func configure(z *zookeeperRegistry, opts ...registry.Option) error {
+	for _, o := range opts {
+		o(&z.options)
+	}
+
+	servers := []string{"127.0.0.1:2181"}
+	var cAddrs []string
+	for _, addr := range z.options.Addrs {
+		if len(addr) == 0 {
+			continue
+		}
+		cAddrs = append(cAddrs, addr)
+	}
+	if len(cAddrs) > 0 {
+		servers = cAddrs
+	}
+
+	sessionTimeout := DefaultSessionTimeout
+	if z.options.Context != nil {
+		if v, ok := z.options.Context.Value(sessionTimeoutKey{}).(time.Duration); ok {
+			sessionTimeout = v
+		}
+	}
+
+	c, events, err := dial(servers, sessionTimeout)
+	if err != nil {
+		return err
+	}
+	z.Lock()
+	if z.conn != nil {
+		z.conn.Close()
+	}
+	z.conn = c
+	z.Unlock()
+
+	go func() {
+		for ev := range events {
+			if ev.State == zk.StateHasSession {
+				z.recreate(c)
+			}
+		}
+	}()
+	return nil
+}
+
+func (z *zookeeperRegistry) Init(opts ...registry.Option) error {
+	return configure(z, opts...)
+}
+
+func (z *zookeeperRegistry) Options() registry.Options {
+	return z.options
+}
+
+func (z *zookeeperRegistry) root() string {
+	root := DefaultRoot
+	if z.options.Context != nil {
+		if v, ok := z.options.Context.Value(rootKey{}).(string); ok {
+			root = v
+		}
+	}
+	return path.Join("/", root)
+}
+
+func (z *zookeeperRegistry) getConn() conn {
+	z.Lock()
+	defer z.Unlock()
+	return z.conn
+}
+
+func (z *zookeeperRegistry) servicePath(name, side string) string {
+	return path.Join(z.root(), name, side+"s")
+}
+
+func (z *zookeeperRegistry) nodePath(s registry.Service) string {
+	return path.Join(z.servicePath(s.Name, s.Side), registry.Format(s))
+}
+
+// createParents create persistent parents of p
+func createParents(c conn, p string) error {
+	var parent string
+	dirs := strings.Split(strings.Trim(path.Dir(p), "/"), "/")
+	for _, dir := range dirs {
+		parent += "/" + dir
+		_, err := c.Create(parent, nil, 0, zk.WorldACL(zk.PermAll))
+		if err != nil && err != zk.ErrNodeExists {
+			return err
+		}
+	}
+	return nil
+}
+
+// createNode create ephemeral node p, node of expired session is
+// deleted and created again
+func createNode(c conn, p string) error {
+	if err := createParents(c, p); err != nil {
+		return err
+	}
+	_, err := c.Create(p, nil, zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+	if err != zk.ErrNodeExists {
+		return err
+	}
+	_, stat, err := c.Exists(p)
+	if err != nil {
+		return err
+	}
+	if stat == nil || stat.EphemeralOwner == c.SessionID() {
+		return nil
+	}
+	if err := c.Delete(p, -1); err != nil && err != zk.ErrNoNode {
+		return err
+	}
+	_, err = c.Create(p, nil, zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+	return err
+}
+
+// recreate registered nodes after new session is established
+func (z *zookeeperRegistry) recreate(c conn) {
+	z.Lock()
+	defer z.Unlock()
+	if c != z.conn {
+		return
+	}
+	for p := range z.nodes {
+		if err := createNode(c, p); err != nil {
+			log.Errorf("node:%v,err:%v", p, err)
+		}
+	}
+}
+
+func (z *zookeeperRegistry) Register(s registry.Service, opts ...registry.RegisterOption) error {
+	z.Lock()
+	defer z.Unlock()
+
+	p := z.nodePath(s)
+	if err := createNode(z.conn, p); err != nil {
+		return err
+	}
+	z.nodes[p] = struct{}{}
+	return nil
+}
+
+func (z *zookeeperRegistry) Deregister(s registry.Service) error {
+	z.Lock()
+	defer z.Unlock()
+
+	p := z.nodePath(s)
+	delete(z.nodes, p)
+	err := z.conn.Delete(p, -1)
+	if err == zk.ErrNoNode {
+		return registry.ErrNotFound
+	}
+	return err
+}
+
+// children get services in nodes of p, side is the default side
+// of services of dubbo
+func (z *zookeeperRegistry) children(p string, side string) ([]registry.Service, error) {
+	nodes, _, err := z.getConn().Children(p)
+	if err != nil {
+		return nil, err
+	}
+	services := make([]registry.Service, 0, len(nodes))
+	for _, node := range nodes {
+		service, ok := parseNode(node, side)
+		if !ok {
+			log.Warn(path.Join(p, node) + " invalid service")
+			continue
+		}
+		services = append(services, service)
+	}
+	return services, nil
+}
+
+func (z *zookeeperRegistry) GetService(name string) ([]registry.Service, error) {
+	services, err := z.children(z.servicePath(name, "provider"), "provider")
+	if err == zk.ErrNoNode {
+		return nil, registry.ErrNotFound
+	}
+	return services, err
+}
+
+func (z *zookeeperRegistry) ListServices() ([]registry.Service, error) {
+	services := make([]registry.Service, 0)
+	names, _, err := z.getConn().Children(z.root())
+	if err == zk.ErrNoNode {
+		return services, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		for _, side := range []string{"provider", "consumer"} {
+			svcs, err := z.children(z.servicePath(name, side), side)
+			if err == zk.ErrNoNode {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			services = append(services, svcs...)
+		}
+	}
+	return services, nil
+}
+
+func (z *zookeeperRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	return newZookeeperWatcher(z, opts...)
+}
+
+func (z *zookeeperRegistry) String() string {
+	return "zookeeper"
+}
+
+// parseNode parse url of dodo or dubbo in node name, for url of dubbo
+// methods are funcs, serialization is codec, and interface is name
+func parseNode(node string, side string) (registry.Service, bool) {
+	if service, err := registry.Parse(node); err == nil {
+		return service, true
+	}
+
+	str, err := url.QueryUnescape(node)
+	if err != nil {
+		return registry.Service{}, false
+	}
+	u, err := url.Parse(str)
+	if err != nil {
+		return registry.Service{}, false
+	}
+	values := u.Query()
+	service := registry.Service{
+		Protocol: u.Scheme,
+		Address:  u.Host,
+		Name:     strings.Trim(u.Path, "/"),
+		Side:     side,
+		Codecs:   []string{"hessian2"},
+		Labels:   make(map[string]string),
+	}
+	for k := range values {
+		v := values.Get(k)
+		switch k {
+		case "interface":
+			service.Name = v
+		case "version":
+			service.Version = v
+		case "methods":
+			service.Funcs = strings.Split(v, ",")
+		case "serialization":
+			service.Codecs = []string{v}
+		case "side":
+			service.Side = v
+		case "timestamp":
+			service.Timestamp, _ = strconv.ParseInt(v, 10, 64)
+		default:
+			service.Labels[k] = v
+		}
+	}
+	if len(service.Protocol) == 0 || len(service.Address) == 0 ||
+		len(service.Name) == 0 || len(service.Funcs) == 0 {
+		return registry.Service{}, false
+	}
+	return service, true
+}
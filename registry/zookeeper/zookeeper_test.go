@@ -0,0 +1,367 @@
+package zookeeper
+
+import (
+	"net/url"
+	"path"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/haormj/dodo/log"
+	"github.com/haormj/dodo/registry"
+	"github.com/haormj/dodo/registry/registrytest"
+
+	"github.com/go-zookeeper/zk"
+)
+
+// fakeTree is nodes of zookeeper shared by connections
+type fakeTree struct {
+	sync.Mutex
+	// value is session of ephemeral node, 0 is persistent
+	nodes        map[string]int64
+	childWatches map[string][]chan zk.Event
+	existWatches map[string][]chan zk.Event
+	session      int64
+}
+
+func newFakeTree() *fakeTree {
+	return &fakeTree{
+		nodes:        map[string]int64{"/": 0},
+		childWatches: make(map[string][]chan zk.Event),
+		existWatches: make(map[string][]chan zk.Event),
+	}
+}
+
+// fire trigger watches of p, lock is held
+func (t *fakeTree) fire(watches map[string][]chan zk.Event, p string, typ zk.EventType) {
+	for _, ch := range watches[p] {
+		ch <- zk.Event{Type: typ, Path: p}
+	}
+	delete(watches, p)
+}
+
+func (t *fakeTree) watch(watches map[string][]chan zk.Event, p string) <-chan zk.Event {
+	ch := make(chan zk.Event, 1)
+	watches[p] = append(watches[p], ch)
+	return ch
+}
+
+func (t *fakeTree) children(p string) []string {
+	var children []string
+	for n := range t.nodes {
+		if n != "/" && path.Dir(n) == p {
+			children = append(children, path.Base(n))
+		}
+	}
+	sort.Strings(children)
+	return children
+}
+
+func (t *fakeTree) create(p string, session int64) error {
+	if _, ok := t.nodes[path.Dir(p)]; !ok {
+		return zk.ErrNoNode
+	}
+	if _, ok := t.nodes[p]; ok {
+		return zk.ErrNodeExists
+	}
+	t.nodes[p] = session
+	t.fire(t.existWatches, p, zk.EventNodeCreated)
+	t.fire(t.childWatches, path.Dir(p), zk.EventNodeChildrenChanged)
+	return nil
+}
+
+func (t *fakeTree) delete(p string) error {
+	if _, ok := t.nodes[p]; !ok {
+		return zk.ErrNoNode
+	}
+	if len(t.children(p)) > 0 {
+		return zk.ErrNotEmpty
+	}
+	delete(t.nodes, p)
+	t.fire(t.childWatches, p, zk.EventNodeDeleted)
+	t.fire(t.childWatches, path.Dir(p), zk.EventNodeChildrenChanged)
+	return nil
+}
+
+// fakeConn is a session of fakeTree
+type fakeConn struct {
+	t       *fakeTree
+	session int64
+	events  chan zk.Event
+}
+
+func (t *fakeTree) dial(servers []string, sessionTimeout time.Duration) (conn, <-chan zk.Event, error) {
+	t.Lock()
+	defer t.Unlock()
+	t.session++
+	c := &fakeConn{
+		t:       t,
+		session: t.session,
+		events:  make(chan zk.Event, 10),
+	}
+	c.events <- zk.Event{Type: zk.EventSession, State: zk.StateHasSession}
+	return c, c.events, nil
+}
+
+// expire delete ephemeral nodes of session, and establish a new session
+func (c *fakeConn) expire() {
+	c.t.Lock()
+	var nodes []string
+	for p, session := range c.t.nodes {
+		if session == c.session {
+			nodes = append(nodes, p)
+		}
+	}
+	for _, p := range nodes {
+		c.t.delete(p)
+	}
+	c.t.session++
+	c.session = c.t.session
+	c.t.Unlock()
+	c.events <- zk.Event{Type: zk.EventSession, State: zk.StateHasSession}
+}
+
+func (c *fakeConn) Create(p string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	c.t.Lock()
+	defer c.t.Unlock()
+	var session int64
+	if flags&zk.FlagEphemeral != 0 {
+		session = c.session
+	}
+	return p, c.t.create(p, session)
+}
+
+func (c *fakeConn) Delete(p string, version int32) error {
+	c.t.Lock()
+	defer c.t.Unlock()
+	return c.t.delete(p)
+}
+
+func (c *fakeConn) Exists(p string) (bool, *zk.Stat, error) {
+	c.t.Lock()
+	defer c.t.Unlock()
+	session, ok := c.t.nodes[p]
+	if !ok {
+		return false, nil, nil
+	}
+	return true, &zk.Stat{EphemeralOwner: session}, nil
+}
+
+func (c *fakeConn) ExistsW(p string) (bool, *zk.Stat, <-chan zk.Event, error) {
+	c.t.Lock()
+	defer c.t.Unlock()
+	session, ok := c.t.nodes[p]
+	if !ok {
+		return false, nil, c.t.watch(c.t.existWatches, p), nil
+	}
+	return true, &zk.Stat{EphemeralOwner: session}, nil, nil
+}
+
+func (c *fakeConn) Children(p string) ([]string, *zk.Stat, error) {
+	c.t.Lock()
+	defer c.t.Unlock()
+	if _, ok := c.t.nodes[p]; !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	return c.t.children(p), &zk.Stat{}, nil
+}
+
+func (c *fakeConn) ChildrenW(p string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	c.t.Lock()
+	defer c.t.Unlock()
+	if _, ok := c.t.nodes[p]; !ok {
+		return nil, nil, nil, zk.ErrNoNode
+	}
+	return c.t.children(p), &zk.Stat{}, c.t.watch(c.t.childWatches, p), nil
+}
+
+func (c *fakeConn) SessionID() int64 {
+	c.t.Lock()
+	defer c.t.Unlock()
+	return c.session
+}
+
+func (c *fakeConn) Close() {}
+
+func newTestRegistry(t *testing.T, opts ...registry.Option) (*zookeeperRegistry, *fakeTree) {
+	log.SetDummyLogger()
+	tree := newFakeTree()
+	dial = tree.dial
+	return NewRegistry(opts...).(*zookeeperRegistry), tree
+}
+
+func TestRegistry(t *testing.T) {
+	r, tree := newTestRegistry(t)
+	if _, err := r.GetService("Hello"); err != registry.ErrNotFound {
+		t.Errorf("GetService() err = %v, want %v", err, registry.ErrNotFound)
+	}
+	registrytest.TestRegistry(t, r)
+
+	// registration is ephemeral node of session
+	p := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	if err := r.Register(p); err != nil {
+		t.Fatal(err)
+	}
+	node := path.Join("/dodo/Hello/providers", registry.Format(p))
+	tree.Lock()
+	owner := tree.nodes[node]
+	tree.Unlock()
+	if owner != r.getConn().SessionID() {
+		t.Errorf("owner of %s = %d, want ephemeral node of session %d", node, owner, r.getConn().SessionID())
+	}
+	if err := r.Deregister(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Deregister(p); err != registry.ErrNotFound {
+		t.Errorf("Deregister() err = %v, want %v", err, registry.ErrNotFound)
+	}
+}
+
+func TestRegistry_Session(t *testing.T) {
+	r, tree := newTestRegistry(t)
+
+	p := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	node := path.Join("/dodo/Hello/providers", registry.Format(p))
+	// node of expired session is replaced
+	tree.Lock()
+	tree.nodes["/dodo"] = 0
+	tree.nodes["/dodo/Hello"] = 0
+	tree.nodes["/dodo/Hello/providers"] = 0
+	tree.nodes[node] = 100
+	tree.Unlock()
+	if err := r.Register(p); err != nil {
+		t.Fatal(err)
+	}
+	c := r.getConn().(*fakeConn)
+	tree.Lock()
+	owner := tree.nodes[node]
+	tree.Unlock()
+	if owner != c.SessionID() {
+		t.Errorf("owner = %d, want %d", owner, c.SessionID())
+	}
+
+	// node is created again after session is expired
+	c.expire()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tree.Lock()
+		owner, ok := tree.nodes[node]
+		tree.Unlock()
+		if ok && owner == c.SessionID() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("node %s is not created again", node)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRegistry_Dubbo(t *testing.T) {
+	r, tree := newTestRegistry(t, Root("dubbo"))
+
+	u := "dubbo://10.0.0.1:20880/org.apache.dubbo.demo.DemoService?anyhost=true" +
+		"&application=demo-provider&interface=org.apache.dubbo.demo.DemoService" +
+		"&methods=sayHello,sayHelloAsync&side=provider&timestamp=1543311057&version=1.0.0"
+	tree.Lock()
+	for _, p := range []string{
+		"/dubbo",
+		"/dubbo/org.apache.dubbo.demo.DemoService",
+		"/dubbo/org.apache.dubbo.demo.DemoService/providers",
+		"/dubbo/org.apache.dubbo.demo.DemoService/providers/" + url.QueryEscape(u),
+		"/dubbo/org.apache.dubbo.demo.DemoService/providers/invalid",
+	} {
+		tree.nodes[p] = 0
+	}
+	tree.Unlock()
+
+	services, err := r.GetService("org.apache.dubbo.demo.DemoService")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []registry.Service{{
+		Protocol:  "dubbo",
+		Address:   "10.0.0.1:20880",
+		Name:      "org.apache.dubbo.demo.DemoService",
+		Version:   "1.0.0",
+		Funcs:     []string{"sayHello", "sayHelloAsync"},
+		Codecs:    []string{"hessian2"},
+		Side:      "provider",
+		Timestamp: 1543311057,
+		Labels:    map[string]string{"anyhost": "true", "application": "demo-provider"},
+	}}
+	if !reflect.DeepEqual(services, want) {
+		t.Errorf("GetService() = %+v, want %+v", services, want)
+	}
+
+	// dodo service is registered in the same tree
+	p := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	if err := r.Register(p); err != nil {
+		t.Fatal(err)
+	}
+	tree.Lock()
+	_, ok := tree.nodes[path.Join("/dubbo/Hello/providers", registry.Format(p))]
+	tree.Unlock()
+	if !ok {
+		t.Errorf("service is not registered under root /dubbo")
+	}
+}
+
+func TestRegistry_Watch(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	registrytest.TestWatch(t, r)
+}
+
+func TestRegistry_WatchUpdate(t *testing.T) {
+	r, _ := newTestRegistry(t)
+
+	// root is not exist before watch
+	w, err := r.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	p := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	if err := r.Register(p); err != nil {
+		t.Fatal(err)
+	}
+	if result := registrytest.Next(t, w); result.Action != "create" || !registry.Equal(result.Service, p) {
+		t.Errorf("Next() = %v, want create %v", result, p)
+	}
+	// labels are part of node, so update is a new node with the same id
+	old := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	p.Labels["weight"] = "10"
+	if err := r.Register(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Deregister(old); err != nil {
+		t.Fatal(err)
+	}
+	if result := registrytest.Next(t, w); result.Action != "update" || !registry.Equal(result.Service, p) {
+		t.Errorf("Next() = %v, want update %v", result, p)
+	}
+
+	w.Stop()
+	if _, err := w.Next(); err != ErrWatcherStopped {
+		t.Errorf("Next() err = %v, want %v", err, ErrWatcherStopped)
+	}
+}
+
+func TestParseNode(t *testing.T) {
+	for _, node := range []string{
+		"invalid",
+		url.QueryEscape("dubbo://10.0.0.1:20880/Hello"),
+		url.QueryEscape("dubbo:///Hello?methods=sayHello"),
+	} {
+		if s, ok := parseNode(node, "provider"); ok {
+			t.Errorf("parseNode(%q) = %v, want invalid", node, s)
+		}
+	}
+	s := registrytest.NewService("Hello", "127.0.0.1:17312", "provider")
+	got, ok := parseNode(registry.Format(s), "consumer")
+	if !ok || !registry.Equal(got, s) {
+		t.Errorf("parseNode() = %v, want %v", got, s)
+	}
+}
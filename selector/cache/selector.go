@@ -20,12 +20,14 @@ type Selector struct {
 	sync.RWMutex
 	opts     selector.Options
 	services map[string][]registry.Service
+	outlier  *selector.Outlier
 	exit     chan struct{}
 }
 
 func NewSelector(opts ...selector.Option) selector.Selector {
 	options := selector.Options{
 		Strategy: selector.Random,
+		Outlier:  selector.DefaultOutlierOptions,
 	}
 
 	for _, o := range opts {
@@ -35,6 +37,7 @@ func NewSelector(opts ...selector.Option) selector.Selector {
 	s := &Selector{
 		opts:     options,
 		services: make(map[string][]registry.Service),
+		outlier:  selector.NewOutlier(options.Outlier),
 	}
 
 	return s
@@ -183,12 +186,28 @@ func (s *Selector) watch() {
 			s.Lock()
 			s.services[result.Service.Name] = services
 			s.Unlock()
+			selector.UpdateRing(result.Service.Name, services)
+			// forget status of the deleted address
+			if result.Action == "delete" && !hasAddress(services, result.Service.Address) {
+				s.outlier.Remove(result.Service.Name, result.Service.Address)
+				selector.RemoveStat(result.Service)
+			}
 
 			s.writeToCache()
 		}
 	}
 }
 
+// hasAddress report whether address is in services
+func hasAddress(services []registry.Service, address string) bool {
+	for _, svc := range services {
+		if svc.Address == address {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Selector) writeToCache() error {
 	s.RLock()
 	for name, svcs := range s.services {
@@ -228,7 +247,7 @@ func (s *Selector) read() error {
 	return nil
 }
 
-func (s Selector) addService(services []registry.Service) {
+func (s *Selector) addService(services []registry.Service) {
 	if len(services) == 0 {
 		// TODO
 		return
@@ -237,12 +256,14 @@ func (s Selector) addService(services []registry.Service) {
 	s.Lock()
 	s.services[n] = services
 	s.Unlock()
+	selector.UpdateRing(n, services)
 }
 
 func (s *Selector) Init(opts ...selector.Option) error {
 	for _, o := range opts {
 		o(&s.opts)
 	}
+	s.outlier = selector.NewOutlier(s.opts.Outlier)
 
 	if err := s.read(); err != nil {
 		return err
@@ -280,15 +301,18 @@ func (s *Selector) Select(service string, opts ...selector.SelectOption) (regist
 		return svc, selector.ErrNoneAvailable
 	}
 
+	// skip ejected nodes
+	services = s.outlier.Filter(services)
+
 	return sopts.Strategy(services)
 }
 
-func (s *Selector) Mark(service string, err error) {
-
+func (s *Selector) Mark(service string, address string, err error) {
+	s.outlier.Mark(service, address, err)
 }
 
 func (s *Selector) Reset(service string) {
-
+	s.outlier.Reset(service)
 }
 
 func (s *Selector) Close() error {
@@ -41,6 +41,22 @@ func FilterVersion(version string) Filter {
 	}
 }
 
+// FilterCodec is a codec based Select Filter which will
+// only return services support the codec specified.
+func FilterCodec(codec string) Filter {
+	return func(old []registry.Service) []registry.Service {
+		var services []registry.Service
+
+		for _, service := range old {
+			if util.ArrayContainsString(service.Codecs, codec) {
+				services = append(services, service)
+			}
+		}
+
+		return services
+	}
+}
+
 func FilterTLS() Filter {
 	return func(old []registry.Service) []registry.Service {
 		var services []registry.Service
@@ -90,3 +106,19 @@ func FilterClient(clis []client.Client) Filter {
 		return services
 	}
 }
+
+// FilterExclude is an address based Select Filter which will
+// only return services not in the addresses specified.
+func FilterExclude(addrs ...string) Filter {
+	return func(old []registry.Service) []registry.Service {
+		var services []registry.Service
+
+		for _, service := range old {
+			if !util.ArrayContainsString(addrs, service.Address) {
+				services = append(services, service)
+			}
+		}
+
+		return services
+	}
+}
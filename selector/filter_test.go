@@ -340,3 +340,78 @@ func TestFilterClient(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterCodec(t *testing.T) {
+	type args struct {
+		codec    string
+		services []registry.Service
+	}
+	tests := []struct {
+		name string
+		args args
+		want []registry.Service
+	}{
+		{
+			name: "FilterCodec",
+			args: args{
+				codec: "proto",
+				services: []registry.Service{
+					{
+						Protocol:  "rpc",
+						Address:   "127.0.0.1:17312",
+						Name:      "Hello",
+						Version:   "0.1.0",
+						Funcs:     []string{"SayHello"},
+						Codecs:    []string{"json", "proto"},
+						Transport: "grpc",
+						Side:      "provider",
+						TLS:       true,
+						Timestamp: 1543311057,
+						Labels: map[string]string{
+							"nodeID": "1",
+						},
+					},
+					{
+						Protocol:  "rpc",
+						Address:   "127.0.0.1:17312",
+						Name:      "Hello",
+						Version:   "0.1.0",
+						Funcs:     []string{"SayHello"},
+						Codecs:    []string{"json"},
+						Transport: "grpc",
+						Side:      "provider",
+						TLS:       true,
+						Timestamp: 1543311057,
+						Labels: map[string]string{
+							"nodeID": "2",
+						},
+					},
+				},
+			},
+			want: []registry.Service{
+				{
+					Protocol:  "rpc",
+					Address:   "127.0.0.1:17312",
+					Name:      "Hello",
+					Version:   "0.1.0",
+					Funcs:     []string{"SayHello"},
+					Codecs:    []string{"json", "proto"},
+					Transport: "grpc",
+					Side:      "provider",
+					TLS:       true,
+					Timestamp: 1543311057,
+					Labels: map[string]string{
+						"nodeID": "1",
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FilterCodec(tt.args.codec)(tt.args.services); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FilterCodec() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
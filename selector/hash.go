@@ -0,0 +1,158 @@
+package selector
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/haormj/dodo/registry"
+)
+
+// Replicas is the number of virtual nodes of each service instance
+const Replicas = 160
+
+// point of ring, it belongs to the instance with address
+type point struct {
+	hash    uint32
+	address string
+}
+
+// ring is ketama consistent hash ring, when instance join or leave,
+// only keys on its virtual nodes are remapped
+type ring struct {
+	// sig is addresses of instances, ring is rebuilt if it changed
+	sig    string
+	points []point
+	// full is true if ring is updated by UpdateRing with all services
+	full bool
+}
+
+func newRing(sig string, addrs []string) *ring {
+	r := &ring{
+		sig:    sig,
+		points: make([]point, 0, len(addrs)*Replicas),
+	}
+	for _, addr := range addrs {
+		// every md5 digest give 4 points
+		for i := 0; i < Replicas/4; i++ {
+			d := md5.Sum([]byte(addr + "-" + strconv.Itoa(i)))
+			for j := 0; j < 4; j++ {
+				r.points = append(r.points, point{
+					hash:    binary.LittleEndian.Uint32(d[j*4:]),
+					address: addr,
+				})
+			}
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool {
+		return r.points[i].hash < r.points[j].hash
+	})
+	return r
+}
+
+// get the first point not less than hash of key, then walk clockwise
+// until the address of point is in candidates
+func (r *ring) get(key string, candidates map[string]registry.Service) (registry.Service, bool) {
+	if len(r.points) == 0 {
+		return registry.Service{}, false
+	}
+	d := md5.Sum([]byte(key))
+	h := binary.LittleEndian.Uint32(d[:4])
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= h
+	})
+	for n := 0; n < len(r.points); n++ {
+		p := r.points[(i+n)%len(r.points)]
+		if svc, ok := candidates[p.address]; ok {
+			return svc, true
+		}
+	}
+	return registry.Service{}, false
+}
+
+// rings of services, ring of one service is reused until
+// its instances changed
+var rings = struct {
+	sync.Mutex
+	m map[string]*ring
+}{
+	m: make(map[string]*ring),
+}
+
+// signature get sorted addresses of services
+func signature(services []registry.Service) (string, []string) {
+	addrs := make([]string, 0, len(services))
+	for _, svc := range services {
+		addrs = append(addrs, svc.Address)
+	}
+	sort.Strings(addrs)
+	return strings.Join(addrs, ","), addrs
+}
+
+// UpdateRing set instances of ring of service name to all services
+// got from registry, selector should call it before services are
+// filtered, so keys of instances filtered out or ejected move to the
+// next instance on ring, and keys of others are not remapped. Ring is
+// built from candidates of strategy if it is never updated.
+func UpdateRing(name string, services []registry.Service) {
+	rings.Lock()
+	defer rings.Unlock()
+	if len(services) == 0 {
+		delete(rings.m, name)
+		return
+	}
+	sig, addrs := signature(services)
+	if r, ok := rings.m[name]; ok && r.sig == sig {
+		return
+	}
+	r := newRing(sig, addrs)
+	r.full = true
+	rings.m[name] = r
+}
+
+func getRing(services []registry.Service) *ring {
+	name := services[0].Name
+	rings.Lock()
+	defer rings.Unlock()
+	r, ok := rings.m[name]
+	if ok && r.full {
+		return r
+	}
+	sig, addrs := signature(services)
+	if !ok || r.sig != sig {
+		r = newRing(sig, addrs)
+		rings.m[name] = r
+	}
+	return r
+}
+
+// ConsistentHash create a strategy which always select the same service
+// for the same key, Random is used if key is empty
+func ConsistentHash(key string) Strategy {
+	return func(services []registry.Service) (registry.Service, error) {
+		var svc registry.Service
+		if len(services) == 0 {
+			return svc, ErrNoneAvailable
+		}
+		if len(key) == 0 {
+			return Random(services)
+		}
+
+		candidates := make(map[string]registry.Service, len(services))
+		for _, svc := range services {
+			candidates[svc.Address] = svc
+		}
+		if svc, ok := getRing(services).get(key, candidates); ok {
+			return svc, nil
+		}
+		// ring is stale, candidates are not in it
+		sig, addrs := signature(services)
+		if svc, ok := newRing(sig, addrs).get(key, candidates); ok {
+			return svc, nil
+		}
+		return svc, ErrNoneAvailable
+	}
+}
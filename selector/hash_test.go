@@ -0,0 +1,130 @@
+package selector
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/haormj/dodo/registry"
+)
+
+func TestConsistentHash(t *testing.T) {
+	var services []registry.Service
+	for i := 0; i < 5; i++ {
+		services = append(services, registry.Service{
+			Name:    "Hash",
+			Address: "127.0.0.1:" + strconv.Itoa(17312+i),
+		})
+	}
+
+	selectAll := func(services []registry.Service) map[string]string {
+		m := make(map[string]string)
+		for i := 0; i < 1000; i++ {
+			key := strconv.Itoa(i)
+			svc, err := ConsistentHash(key)(services)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m[key] = svc.Address
+		}
+		return m
+	}
+
+	before := selectAll(services)
+	// same key select the same service
+	if again := selectAll(services); len(again) != len(before) {
+		t.Fatalf("ConsistentHash() = %d keys, want %d", len(again), len(before))
+	} else {
+		for k, addr := range before {
+			if again[k] != addr {
+				t.Errorf("ConsistentHash(%s) = %v, want %v", k, again[k], addr)
+			}
+		}
+	}
+
+	// keys are distributed to all services
+	counts := make(map[string]int)
+	for _, addr := range before {
+		counts[addr]++
+	}
+	for _, svc := range services {
+		if counts[svc.Address] < 100 {
+			t.Errorf("ConsistentHash() selected %v %d times, want at least 100", svc.Address, counts[svc.Address])
+		}
+	}
+
+	// only keys of the removed service are remapped
+	removed := services[2].Address
+	after := selectAll(append(services[:2:2], services[3:]...))
+	for k, addr := range before {
+		if addr != removed && after[k] != addr {
+			t.Errorf("ConsistentHash(%s) = %v, want %v", k, after[k], addr)
+		}
+		if after[k] == removed {
+			t.Errorf("ConsistentHash(%s) = removed service %v", k, removed)
+		}
+	}
+
+	// empty key fallback to random
+	if _, err := ConsistentHash("")(services); err != nil {
+		t.Errorf("ConsistentHash() err = %v, want %v", err, nil)
+	}
+	if _, err := ConsistentHash("key")(nil); err != ErrNoneAvailable {
+		t.Errorf("ConsistentHash() err = %v, want %v", err, ErrNoneAvailable)
+	}
+}
+
+func TestConsistentHash_Filtered(t *testing.T) {
+	var services []registry.Service
+	for i := 0; i < 5; i++ {
+		services = append(services, registry.Service{
+			Name:    "Filtered",
+			Address: "127.0.0.1:" + strconv.Itoa(17312+i),
+		})
+	}
+	UpdateRing("Filtered", services)
+	defer UpdateRing("Filtered", nil)
+
+	selectAll := func(services []registry.Service) map[string]string {
+		m := make(map[string]string)
+		for i := 0; i < 1000; i++ {
+			key := strconv.Itoa(i)
+			svc, err := ConsistentHash(key)(services)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m[key] = svc.Address
+		}
+		return m
+	}
+	before := selectAll(services)
+
+	// keys of filtered out service move to the next ones on ring, and
+	// service is not removed from ring, so keys move back after it is
+	// selectable again
+	filtered := services[2].Address
+	candidates := append(services[:2:2], services[3:]...)
+	after := selectAll(candidates)
+	moved := make(map[string]int)
+	for k, addr := range before {
+		if addr != filtered && after[k] != addr {
+			t.Errorf("ConsistentHash(%s) = %v, want %v", k, after[k], addr)
+		}
+		if addr == filtered {
+			moved[after[k]]++
+		}
+	}
+	if len(moved) < 2 {
+		t.Errorf("keys of filtered service moved to %v, want spread", moved)
+	}
+	for k, addr := range selectAll(services) {
+		if before[k] != addr {
+			t.Errorf("ConsistentHash(%s) = %v, want %v", k, addr, before[k])
+		}
+	}
+
+	// candidate not in ring is still selectable
+	svc := registry.Service{Name: "Filtered", Address: "127.0.0.1:17400"}
+	if got, err := ConsistentHash("key")([]registry.Service{svc}); err != nil || got.Address != svc.Address {
+		t.Errorf("ConsistentHash() = %v, %v, want %v", got, err, svc)
+	}
+}
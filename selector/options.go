@@ -9,6 +9,8 @@ import (
 type Options struct {
 	Registry registry.Registry
 	Strategy Strategy
+	// Outlier options of ejecting unhealthy nodes
+	Outlier OutlierOptions
 
 	// Other options for implementations of the interface
 	// can be stored in a context
@@ -44,6 +46,13 @@ func SetStrategy(fn Strategy) Option {
 	}
 }
 
+// SetOutlier sets the options of outlier ejection
+func SetOutlier(o OutlierOptions) Option {
+	return func(opts *Options) {
+		opts.Outlier = o
+	}
+}
+
 // WithFilter adds a filter function to the list of filters
 // used during the Select call.
 func WithFilter(fn ...Filter) SelectOption {
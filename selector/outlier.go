@@ -0,0 +1,193 @@
+package selector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/registry"
+)
+
+// OutlierOptions of outlier ejection
+type OutlierOptions struct {
+	// ConsecutiveErrors eject address after consecutive failures
+	ConsecutiveErrors int
+	// ErrorRate eject address when failure rate in Interval reach it,
+	// and there are at least MinRequests calls
+	ErrorRate   float64
+	MinRequests int
+	Interval    time.Duration
+	// BaseEjectionTime is the ejection time of the first ejection,
+	// it is doubled for each ejection, and no more than MaxEjectionTime
+	BaseEjectionTime time.Duration
+	MaxEjectionTime  time.Duration
+	// PanicThreshold ignore ejection when the rate of available
+	// addresses is less than it, so Select never return none
+	// because all addresses are ejected
+	PanicThreshold float64
+}
+
+// DefaultOutlierOptions is used by selector without outlier options
+var DefaultOutlierOptions = OutlierOptions{
+	ConsecutiveErrors: 5,
+	ErrorRate:         0.5,
+	MinRequests:       10,
+	Interval:          10 * time.Second,
+	BaseEjectionTime:  30 * time.Second,
+	MaxEjectionTime:   5 * time.Minute,
+	PanicThreshold:    0.5,
+}
+
+// host is the status of one address
+type host struct {
+	consecutive int
+	// calls and failures in current interval
+	start    time.Time
+	calls    int
+	failures int
+	// ejections decide ejection time, it decrease for each
+	// interval without failure
+	ejections    int
+	ejectedUntil time.Time
+	// last is the time of the last call
+	last time.Time
+}
+
+// Outlier track failures of addresses by Mark, and eject unhealthy
+// addresses for an exponentially increasing period
+type Outlier struct {
+	opts OutlierOptions
+	now  func() time.Time
+
+	sync.Mutex
+	hosts map[statKey]*host
+	// swept is the time of the last removing of idle hosts
+	swept time.Time
+}
+
+// NewOutlier create outlier ejection with options
+func NewOutlier(opts OutlierOptions) *Outlier {
+	return &Outlier{
+		opts:  opts,
+		now:   time.Now,
+		hosts: make(map[statKey]*host),
+	}
+}
+
+// Mark record the result of call to address
+func (o *Outlier) Mark(service string, address string, err error) {
+	now := o.now()
+	k := statKey{name: service, address: address}
+
+	o.Lock()
+	defer o.Unlock()
+	h, ok := o.hosts[k]
+	if !ok {
+		o.sweep(now)
+		h = &host{start: now}
+		o.hosts[k] = h
+	}
+	h.last = now
+	// start a new interval
+	if now.Sub(h.start) >= o.opts.Interval {
+		// the whole interval is after ejection
+		if h.failures == 0 && h.ejections > 0 && !h.start.Before(h.ejectedUntil) {
+			h.ejections--
+		}
+		h.start = now
+		h.calls = 0
+		h.failures = 0
+	}
+
+	h.calls++
+	if !errors.IsFailure(err) {
+		h.consecutive = 0
+		return
+	}
+	h.consecutive++
+	h.failures++
+
+	// already ejected
+	if now.Before(h.ejectedUntil) {
+		return
+	}
+	eject := o.opts.ConsecutiveErrors > 0 && h.consecutive >= o.opts.ConsecutiveErrors
+	if o.opts.ErrorRate > 0 && h.calls >= o.opts.MinRequests &&
+		float64(h.failures)/float64(h.calls) >= o.opts.ErrorRate {
+		eject = true
+	}
+	if !eject {
+		return
+	}
+	d := o.opts.BaseEjectionTime << uint(h.ejections)
+	if d > o.opts.MaxEjectionTime || d <= 0 {
+		d = o.opts.MaxEjectionTime
+	}
+	h.ejections++
+	h.ejectedUntil = now.Add(d)
+	// count again after ejection
+	h.consecutive = 0
+	h.start = now
+	h.calls = 0
+	h.failures = 0
+}
+
+// sweep remove hosts without call in IdleTime, ejected hosts are kept,
+// it runs at most once in IdleTime, lock is held
+func (o *Outlier) sweep(now time.Time) {
+	if now.Sub(o.swept) < IdleTime {
+		return
+	}
+	o.swept = now
+	for k, h := range o.hosts {
+		if now.Sub(h.last) >= IdleTime && !now.Before(h.ejectedUntil) {
+			delete(o.hosts, k)
+		}
+	}
+}
+
+// Remove forget status of address, e.g. it is deleted from registry
+func (o *Outlier) Remove(service string, address string) {
+	o.Lock()
+	defer o.Unlock()
+	delete(o.hosts, statKey{name: service, address: address})
+}
+
+// Reset forget all status of service, ejected addresses are restored
+func (o *Outlier) Reset(service string) {
+	o.Lock()
+	defer o.Unlock()
+	for k := range o.hosts {
+		if k.name == service {
+			delete(o.hosts, k)
+		}
+	}
+}
+
+// Ejected report whether address of service is ejected now
+func (o *Outlier) Ejected(service string, address string) bool {
+	now := o.now()
+	o.Lock()
+	defer o.Unlock()
+	h, ok := o.hosts[statKey{name: service, address: address}]
+	return ok && now.Before(h.ejectedUntil)
+}
+
+// Filter remove ejected services, all services are returned if the
+// rate of remained services is less than PanicThreshold
+func (o *Outlier) Filter(services []registry.Service) []registry.Service {
+	if len(services) == 0 {
+		return services
+	}
+	var available []registry.Service
+	for _, svc := range services {
+		if !o.Ejected(svc.Name, svc.Address) {
+			available = append(available, svc)
+		}
+	}
+	if len(available) == 0 ||
+		float64(len(available))/float64(len(services)) < o.opts.PanicThreshold {
+		return services
+	}
+	return available
+}
@@ -0,0 +1,144 @@
+package selector
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	derrors "github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/registry"
+)
+
+func newTestOutlier() (*Outlier, *time.Time) {
+	now := time.Unix(1543311057, 0)
+	o := NewOutlier(OutlierOptions{
+		ConsecutiveErrors: 3,
+		ErrorRate:         0.5,
+		MinRequests:       10,
+		Interval:          10 * time.Second,
+		BaseEjectionTime:  30 * time.Second,
+		MaxEjectionTime:   time.Minute,
+		PanicThreshold:    0.5,
+	})
+	o.now = func() time.Time {
+		return now
+	}
+	return o, &now
+}
+
+func TestOutlier_Mark(t *testing.T) {
+	o, now := newTestOutlier()
+	errUnavailable := derrors.New(derrors.Unavailable, "connection closed")
+
+	// handler error is not failure
+	for i := 0; i < 5; i++ {
+		o.Mark("Hello", "a", derrors.New(derrors.HandlerError, "say error"))
+	}
+	if o.Ejected("Hello", "a") {
+		t.Error("Ejected() = true after handler errors, want false")
+	}
+
+	// consecutive errors
+	for i := 0; i < 3; i++ {
+		o.Mark("Hello", "a", errUnavailable)
+	}
+	if !o.Ejected("Hello", "a") {
+		t.Error("Ejected() = false after consecutive errors, want true")
+	}
+	if o.Ejected("World", "a") {
+		t.Error("Ejected() = true for other service, want false")
+	}
+
+	// ejection time is doubled, and no more than max
+	for i, d := range []time.Duration{30 * time.Second, time.Minute, time.Minute} {
+		*now = now.Add(d - time.Second)
+		if !o.Ejected("Hello", "a") {
+			t.Errorf("Ejected() = false before %v of ejection %d, want true", d, i)
+		}
+		*now = now.Add(time.Second)
+		if o.Ejected("Hello", "a") {
+			t.Errorf("Ejected() = true after %v of ejection %d, want false", d, i)
+		}
+		for j := 0; j < 3; j++ {
+			o.Mark("Hello", "a", context.DeadlineExceeded)
+		}
+	}
+
+	// reset restore ejected address
+	o.Reset("Hello")
+	if o.Ejected("Hello", "a") {
+		t.Error("Ejected() = true after Reset, want false")
+	}
+}
+
+func TestOutlier_MarkErrorRate(t *testing.T) {
+	o, _ := newTestOutlier()
+	for i := 0; i < 10; i++ {
+		var err error
+		if i%2 == 1 {
+			err = errors.New("broken pipe")
+		}
+		o.Mark("Hello", "a", err)
+	}
+	if !o.Ejected("Hello", "a") {
+		t.Error("Ejected() = false when error rate reached, want true")
+	}
+}
+
+func TestOutlier_Filter(t *testing.T) {
+	o, _ := newTestOutlier()
+	services := []registry.Service{
+		{Name: "Hello", Address: "a"},
+		{Name: "Hello", Address: "b"},
+		{Name: "Hello", Address: "c"},
+	}
+	eject := func(addr string) {
+		for i := 0; i < 3; i++ {
+			o.Mark("Hello", addr, context.DeadlineExceeded)
+		}
+	}
+
+	eject("a")
+	if got, want := o.Filter(services), services[1:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Filter() = %v, want %v", got, want)
+	}
+	// less than half is available, panic
+	eject("b")
+	if got := o.Filter(services); !reflect.DeepEqual(got, services) {
+		t.Errorf("Filter() = %v, want %v", got, services)
+	}
+	eject("c")
+	if got := o.Filter(services); !reflect.DeepEqual(got, services) {
+		t.Errorf("Filter() = %v, want %v", got, services)
+	}
+}
+
+func TestOutlier_Remove(t *testing.T) {
+	o, now := newTestOutlier()
+	for i := 0; i < 3; i++ {
+		o.Mark("Hello", "a", context.DeadlineExceeded)
+	}
+	o.Mark("Hello", "b", nil)
+	o.Mark("Hello", "c", nil)
+
+	// deleted from registry
+	o.Remove("Hello", "a")
+	if o.Ejected("Hello", "a") {
+		t.Error("Ejected() = true after Remove, want false")
+	}
+
+	// idle host is removed when new host is marked
+	*now = now.Add(IdleTime / 2)
+	o.Mark("Hello", "b", nil)
+	*now = now.Add(IdleTime / 2)
+	o.Mark("Hello", "d", nil)
+	o.Lock()
+	_, b := o.hosts[statKey{name: "Hello", address: "b"}]
+	_, c := o.hosts[statKey{name: "Hello", address: "c"}]
+	o.Unlock()
+	if !b || c {
+		t.Errorf("hosts b = %v, c = %v, want b kept and c removed", b, c)
+	}
+}
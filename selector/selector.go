@@ -15,9 +15,11 @@ type Selector interface {
 	Options() Options
 	// Select returns a function which should return the next node
 	Select(service string, opts ...SelectOption) (registry.Service, error)
-	// Mark sets the success/error against a node
-	Mark(service string, err error)
-	// Reset returns state back to zero for a service
+	// Mark sets the success/error against a node,
+	// unhealthy node is ejected for a while
+	Mark(service string, address string, err error)
+	// Reset returns state back to zero for a service,
+	// ejected nodes are restored
 	Reset(service string)
 	// Close renders the selector unusable
 	Close() error
@@ -6,12 +6,14 @@ import (
 )
 
 type Selector struct {
-	so selector.Options
+	so      selector.Options
+	outlier *selector.Outlier
 }
 
 func NewSelector(opts ...selector.Option) selector.Selector {
 	sopts := selector.Options{
 		Strategy: selector.Random,
+		Outlier:  selector.DefaultOutlierOptions,
 	}
 
 	for _, opt := range opts {
@@ -19,7 +21,8 @@ func NewSelector(opts ...selector.Option) selector.Selector {
 	}
 
 	return &Selector{
-		so: sopts,
+		so:      sopts,
+		outlier: selector.NewOutlier(sopts.Outlier),
 	}
 }
 
@@ -27,6 +30,7 @@ func (r *Selector) Init(opts ...selector.Option) error {
 	for _, o := range opts {
 		o(&r.so)
 	}
+	r.outlier = selector.NewOutlier(r.so.Outlier)
 	return nil
 }
 
@@ -49,6 +53,7 @@ func (r *Selector) Select(service string, opts ...selector.SelectOption) (regist
 	if err != nil {
 		return svc, err
 	}
+	selector.UpdateRing(service, services)
 
 	// apply the filters
 	for _, filter := range sopts.Filters {
@@ -60,15 +65,18 @@ func (r *Selector) Select(service string, opts ...selector.SelectOption) (regist
 		return svc, selector.ErrNoneAvailable
 	}
 
+	// skip ejected nodes
+	services = r.outlier.Filter(services)
+
 	return sopts.Strategy(services)
 }
 
-func (r *Selector) Mark(service string, err error) {
-	return
+func (r *Selector) Mark(service string, address string, err error) {
+	r.outlier.Mark(service, address, err)
 }
 
 func (r *Selector) Reset(service string) {
-	return
+	r.outlier.Reset(service)
 }
 
 func (r *Selector) Close() error {
@@ -0,0 +1,220 @@
+package selector
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/registry"
+)
+
+// statKey identify one service instance
+type statKey struct {
+	name    string
+	address string
+}
+
+var (
+	// DecayTime of latency EWMA, sample older than it has less weight,
+	// latency of instance without new sample decay to the average of
+	// instances by it, so the recovered instance can get traffic back
+	DecayTime = 10 * time.Second
+	// DefaultLatency is the latency of instance without sample, when
+	// there is no instance with sample to get the average
+	DefaultLatency = 100 * time.Millisecond
+	// FailureLatency is the min latency recorded for failed call, so
+	// instance returning error fast does not look cheap
+	FailureLatency = time.Second
+)
+
+// now is used to get current time, it can be replaced by test
+var now = time.Now
+
+// stat of calls to one service instance
+type stat struct {
+	active int64
+
+	mu sync.Mutex
+	// ewma of latency in nanoseconds
+	ewma    float64
+	updated time.Time
+	// created is the time of the first call
+	created time.Time
+}
+
+// observe add a latency sample, weight of old value decay by time
+func (st *stat) observe(d time.Duration) {
+	t := now()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.updated.IsZero() {
+		st.ewma = float64(d)
+	} else {
+		w := math.Exp(-float64(t.Sub(st.updated)) / float64(DecayTime))
+		st.ewma = st.ewma*w + float64(d)*(1-w)
+	}
+	st.updated = t
+}
+
+// sample get ewma of latency without decay, false is returned if
+// there is no sample
+func (st *stat) sample() (float64, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.ewma, !st.updated.IsZero()
+}
+
+// latency get ewma of latency, which decay to def without new sample,
+// def is also the latency without sample
+func (st *stat) latency(def time.Duration) time.Duration {
+	t := now()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.updated.IsZero() {
+		return def
+	}
+	w := math.Exp(-float64(t.Sub(st.updated)) / float64(DecayTime))
+	return time.Duration(st.ewma*w + float64(def)*(1-w))
+}
+
+// IdleTime is the time after which status of service instance without
+// call is removed, so instances removed from registry do not leak
+var IdleTime = 5 * time.Minute
+
+// stats of all service instances, it is shared by strategies,
+// caller should call BeginCall and EndCall around every call
+var stats = struct {
+	sync.RWMutex
+	m map[statKey]*stat
+	// swept is the time of the last removing of idle stats
+	swept time.Time
+}{
+	m: make(map[statKey]*stat),
+}
+
+// lookup get stat of svc, nil is returned if it is not called yet
+func lookup(svc registry.Service) *stat {
+	stats.RLock()
+	defer stats.RUnlock()
+	return stats.m[statKey{name: svc.Name, address: svc.Address}]
+}
+
+// sweep remove stats without in-flight call and sample in IdleTime,
+// it runs at most once in IdleTime, lock is held
+func sweep(t time.Time) {
+	if t.Sub(stats.swept) < IdleTime {
+		return
+	}
+	stats.swept = t
+	for k, st := range stats.m {
+		st.mu.Lock()
+		idle := t.Sub(st.created) >= IdleTime && t.Sub(st.updated) >= IdleTime
+		st.mu.Unlock()
+		if idle && atomic.LoadInt64(&st.active) == 0 {
+			delete(stats.m, k)
+		}
+	}
+}
+
+// BeginCall record the start of a call to svc
+func BeginCall(svc registry.Service) {
+	k := statKey{name: svc.Name, address: svc.Address}
+	// active is increased with read lock held, so the stat is not
+	// removed by sweep before it
+	stats.RLock()
+	st, ok := stats.m[k]
+	if ok {
+		atomic.AddInt64(&st.active, 1)
+	}
+	stats.RUnlock()
+	if ok {
+		return
+	}
+
+	t := now()
+	stats.Lock()
+	defer stats.Unlock()
+	st, ok = stats.m[k]
+	if !ok {
+		sweep(t)
+		st = &stat{created: t}
+		stats.m[k] = st
+	}
+	atomic.AddInt64(&st.active, 1)
+}
+
+// EndCall record the end of a call to svc, d is latency of the call,
+// and at least FailureLatency is recorded if err is failure, latency
+// of canceled call is not recorded as it is cut short by caller, e.g.
+// losers of forking and hedging
+func EndCall(svc registry.Service, d time.Duration, err error) {
+	st := lookup(svc)
+	if st == nil {
+		return
+	}
+	atomic.AddInt64(&st.active, -1)
+	if errors.Is(err, errors.Canceled) {
+		return
+	}
+	if errors.IsFailure(err) && d < FailureLatency {
+		d = FailureLatency
+	}
+	st.observe(d)
+}
+
+// RemoveStat forget status of svc, e.g. it is deleted from registry,
+// it is kept if there are in-flight calls
+func RemoveStat(svc registry.Service) {
+	k := statKey{name: svc.Name, address: svc.Address}
+	stats.Lock()
+	defer stats.Unlock()
+	if st, ok := stats.m[k]; ok && atomic.LoadInt64(&st.active) == 0 {
+		delete(stats.m, k)
+	}
+}
+
+// Active get the number of in-flight calls to svc
+func Active(svc registry.Service) int64 {
+	st := lookup(svc)
+	if st == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&st.active)
+}
+
+// Latency get EWMA of latency of svc, it decay to DefaultLatency
+// without new sample
+func Latency(svc registry.Service) time.Duration {
+	return latency(svc, DefaultLatency)
+}
+
+func latency(svc registry.Service, def time.Duration) time.Duration {
+	st := lookup(svc)
+	if st == nil {
+		return def
+	}
+	return st.latency(def)
+}
+
+// averageLatency get average of latency EWMA of services with sample,
+// DefaultLatency is returned if there is no sample
+func averageLatency(services []registry.Service) time.Duration {
+	var sum float64
+	var n int
+	for _, svc := range services {
+		st := lookup(svc)
+		if st == nil {
+			continue
+		}
+		if ewma, ok := st.sample(); ok {
+			sum += ewma
+			n++
+		}
+	}
+	if n == 0 {
+		return DefaultLatency
+	}
+	return time.Duration(sum / float64(n))
+}
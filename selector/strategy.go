@@ -2,11 +2,16 @@ package selector
 
 import (
 	"math/rand"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/haormj/dodo/registry"
 )
 
+// DefaultWeight of service without weight label
+const DefaultWeight = 100
+
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
@@ -21,3 +26,157 @@ func Random(services []registry.Service) (registry.Service, error) {
 	i := rand.Int() % len(services)
 	return services[i], nil
 }
+
+// NewRoundRobin create a round robin strategy, each service
+// name has its own counter
+func NewRoundRobin() Strategy {
+	var mu sync.Mutex
+	counters := make(map[string]int)
+	return func(services []registry.Service) (registry.Service, error) {
+		var svc registry.Service
+		if len(services) == 0 {
+			return svc, ErrNoneAvailable
+		}
+
+		name := services[0].Name
+		mu.Lock()
+		i := counters[name] % len(services)
+		counters[name] = i + 1
+		mu.Unlock()
+		return services[i], nil
+	}
+}
+
+// Weight get weight of service from weight label,
+// DefaultWeight is returned if label is missing or invalid
+func Weight(svc registry.Service) int {
+	v, ok := svc.Labels["weight"]
+	if !ok {
+		return DefaultWeight
+	}
+	w, err := strconv.Atoi(v)
+	if err != nil || w < 0 {
+		return DefaultWeight
+	}
+	return w
+}
+
+// WeightedRandom select service randomly by weight, service with
+// zero weight is not selected unless all weights are zero
+func WeightedRandom(services []registry.Service) (registry.Service, error) {
+	var svc registry.Service
+	if len(services) == 0 {
+		return svc, ErrNoneAvailable
+	}
+
+	total := 0
+	for _, s := range services {
+		total += Weight(s)
+	}
+	if total == 0 {
+		return Random(services)
+	}
+	n := rand.Intn(total)
+	for _, s := range services {
+		n -= Weight(s)
+		if n < 0 {
+			return s, nil
+		}
+	}
+	return services[len(services)-1], nil
+}
+
+// NewWeightedRoundRobin create a smooth weighted round robin strategy,
+// e.g. weights 5,1,1 select a,a,b,a,c,a,a rather than a,a,a,a,a,b,c
+func NewWeightedRoundRobin() Strategy {
+	var mu sync.Mutex
+	// current weight of each instance by service name and address,
+	// instances not in the last pick are removed
+	currents := make(map[string]map[string]int)
+	return func(services []registry.Service) (registry.Service, error) {
+		var svc registry.Service
+		if len(services) == 0 {
+			return svc, ErrNoneAvailable
+		}
+
+		name := services[0].Name
+		mu.Lock()
+		defer mu.Unlock()
+		last := currents[name]
+		current := make(map[string]int, len(services))
+		currents[name] = current
+		total := 0
+		best := -1
+		for i, s := range services {
+			w := Weight(s)
+			if w == 0 {
+				continue
+			}
+			current[s.Address] = last[s.Address] + w
+			total += w
+			if best < 0 || current[s.Address] > current[services[best].Address] {
+				best = i
+			}
+		}
+		if best < 0 {
+			return Random(services)
+		}
+		current[services[best].Address] -= total
+		return services[best], nil
+	}
+}
+
+// LeastActive select the service with least in-flight calls, which are
+// recorded by BeginCall and EndCall, tie is broken by WeightedRandom
+func LeastActive(services []registry.Service) (registry.Service, error) {
+	var svc registry.Service
+	if len(services) == 0 {
+		return svc, ErrNoneAvailable
+	}
+
+	var least []registry.Service
+	var min int64
+	for _, s := range services {
+		active := Active(s)
+		if len(least) == 0 || active < min {
+			min = active
+			least = append(least[:0], s)
+		} else if active == min {
+			least = append(least, s)
+		}
+	}
+	return WeightedRandom(least)
+}
+
+// cost of service is latency multiplied by in-flight calls, def is the
+// latency of service without sample, so it is never zero, and service
+// with stalled calls is more expensive as calls are sent to it
+func cost(svc registry.Service, def time.Duration) float64 {
+	return float64(latency(svc, def)) * float64(Active(svc)+1)
+}
+
+// P2C pick two services randomly, and select the one with lower cost,
+// cost is EWMA of latency multiplied by in-flight calls, which are
+// recorded by BeginCall and EndCall, service without sample or with
+// stale sample use the average latency of services
+func P2C(services []registry.Service) (registry.Service, error) {
+	var svc registry.Service
+	if len(services) == 0 {
+		return svc, ErrNoneAvailable
+	}
+	if len(services) == 1 {
+		return services[0], nil
+	}
+
+	i := rand.Intn(len(services))
+	j := rand.Intn(len(services) - 1)
+	if j >= i {
+		j++
+	}
+	a, b := services[i], services[j]
+	def := averageLatency(services)
+	if cost(b, def) < cost(a, def) {
+		return b, nil
+	}
+	return a, nil
+}
@@ -0,0 +1,352 @@
+package selector
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/registry"
+)
+
+func newTestServices(name string, weights ...string) []registry.Service {
+	var services []registry.Service
+	for i, w := range weights {
+		svc := registry.Service{
+			Name:    name,
+			Address: string(rune('a' + i)),
+			Labels:  make(map[string]string),
+		}
+		if len(w) != 0 {
+			svc.Labels["weight"] = w
+		}
+		services = append(services, svc)
+	}
+	return services
+}
+
+// resetStats forget stats of other tests
+func resetStats() {
+	stats.Lock()
+	defer stats.Unlock()
+	stats.m = make(map[statKey]*stat)
+	stats.swept = time.Time{}
+}
+
+func selectN(t *testing.T, fn Strategy, services []registry.Service, n int) []string {
+	var addrs []string
+	for i := 0; i < n; i++ {
+		svc, err := fn(services)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs = append(addrs, svc.Address)
+	}
+	return addrs
+}
+
+func TestNewRoundRobin(t *testing.T) {
+	rr := NewRoundRobin()
+	hello := newTestServices("Hello", "", "", "")
+	world := newTestServices("World", "", "")
+
+	if got, want := selectN(t, rr, hello, 2), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RoundRobin() = %v, want %v", got, want)
+	}
+	// each service name has its own counter
+	if got, want := selectN(t, rr, world, 3), []string{"a", "b", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RoundRobin() = %v, want %v", got, want)
+	}
+	if got, want := selectN(t, rr, hello, 2), []string{"c", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RoundRobin() = %v, want %v", got, want)
+	}
+	if _, err := rr(nil); err != ErrNoneAvailable {
+		t.Errorf("RoundRobin() err = %v, want %v", err, ErrNoneAvailable)
+	}
+}
+
+func TestWeight(t *testing.T) {
+	tests := []struct {
+		name   string
+		weight string
+		want   int
+	}{
+		{"missing", "", DefaultWeight},
+		{"invalid", "x", DefaultWeight},
+		{"negative", "-1", DefaultWeight},
+		{"zero", "0", 0},
+		{"weight", "10", 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Weight(newTestServices("Hello", tt.weight)[0]); got != tt.want {
+				t.Errorf("Weight() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightedRandom(t *testing.T) {
+	services := newTestServices("Hello", "3", "1", "0")
+	counts := make(map[string]int)
+	for _, addr := range selectN(t, WeightedRandom, services, 4000) {
+		counts[addr]++
+	}
+	if counts["c"] != 0 {
+		t.Errorf("WeightedRandom() selected zero weight %d times", counts["c"])
+	}
+	if counts["a"] < 2*counts["b"] {
+		t.Errorf("WeightedRandom() = %v, want a about 3 times of b", counts)
+	}
+
+	// all weights are zero
+	if _, err := WeightedRandom(newTestServices("Hello", "0", "0")); err != nil {
+		t.Errorf("WeightedRandom() err = %v, want %v", err, nil)
+	}
+}
+
+func TestNewWeightedRoundRobin(t *testing.T) {
+	wrr := NewWeightedRoundRobin()
+	services := newTestServices("Hello", "5", "1", "1")
+	got := selectN(t, wrr, services, 7)
+	want := []string{"a", "a", "b", "a", "c", "a", "a"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WeightedRoundRobin() = %v, want %v", got, want)
+	}
+
+	// current weight of b is forgot when it is not available,
+	// it start from zero after back
+	services = newTestServices("World", "2", "1")
+	got = append(selectN(t, wrr, services, 1), selectN(t, wrr, services[:1], 1)...)
+	got = append(got, selectN(t, wrr, services, 2)...)
+	want = []string{"a", "a", "a", "b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WeightedRoundRobin() = %v, want %v", got, want)
+	}
+}
+
+func TestLeastActive(t *testing.T) {
+	services := newTestServices("LeastActive", "", "", "")
+	BeginCall(services[0])
+	BeginCall(services[0])
+	BeginCall(services[1])
+	defer func() {
+		EndCall(services[0], 0, nil)
+		EndCall(services[0], 0, nil)
+		EndCall(services[1], 0, nil)
+	}()
+
+	for _, addr := range selectN(t, LeastActive, services, 10) {
+		if addr != "c" {
+			t.Errorf("LeastActive() = %v, want %v", addr, "c")
+		}
+	}
+	if got := Active(services[0]); got != 2 {
+		t.Errorf("Active() = %v, want %v", got, 2)
+	}
+}
+
+func TestStrategy_Concurrent(t *testing.T) {
+	services := newTestServices("Concurrent", "2", "1")
+	strategies := []Strategy{Random, WeightedRandom, LeastActive, P2C, NewRoundRobin(), NewWeightedRoundRobin()}
+	var wg sync.WaitGroup
+	for _, fn := range strategies {
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(fn Strategy) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					svc, err := fn(services)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					BeginCall(svc)
+					EndCall(svc, time.Millisecond, nil)
+				}
+			}(fn)
+		}
+	}
+	wg.Wait()
+}
+
+func TestP2C(t *testing.T) {
+	defer func() {
+		now = time.Now
+	}()
+	current := time.Unix(1543311057, 0)
+	now = func() time.Time {
+		return current
+	}
+
+	resetStats()
+	services := newTestServices("P2C", "", "")
+	BeginCall(services[0])
+	EndCall(services[0], 10*time.Millisecond, nil)
+	BeginCall(services[1])
+	EndCall(services[1], time.Second, nil)
+	for _, addr := range selectN(t, P2C, services, 10) {
+		if addr != "a" {
+			t.Errorf("P2C() = %v, want %v", addr, "a")
+		}
+	}
+
+	// stale latency of slow node decay to the average, it get traffic
+	// back when fast node is busy
+	current = current.Add(10 * DecayTime)
+	BeginCall(services[0])
+	EndCall(services[0], 10*time.Millisecond, nil)
+	for i := 0; i < 60; i++ {
+		BeginCall(services[0])
+	}
+	for _, addr := range selectN(t, P2C, services, 10) {
+		if addr != "b" {
+			t.Errorf("P2C() = %v, want %v", addr, "b")
+		}
+	}
+	for i := 0; i < 60; i++ {
+		EndCall(services[0], 10*time.Millisecond, nil)
+	}
+
+	// in-flight calls increase cost
+	current = current.Add(DecayTime)
+	for _, svc := range services {
+		BeginCall(svc)
+		EndCall(svc, 10*time.Millisecond, nil)
+	}
+	for i := 0; i < 3; i++ {
+		BeginCall(services[1])
+		defer EndCall(services[1], 0, nil)
+	}
+	for _, addr := range selectN(t, P2C, services, 10) {
+		if addr != "a" {
+			t.Errorf("P2C() = %v, want %v", addr, "a")
+		}
+	}
+}
+
+func TestP2C_Stalled(t *testing.T) {
+	defer func() {
+		now = time.Now
+	}()
+	current := time.Unix(1543311057, 0)
+	now = func() time.Time {
+		return current
+	}
+
+	resetStats()
+	services := newTestServices("P2C", "", "")
+	for _, svc := range services {
+		BeginCall(svc)
+		EndCall(svc, 10*time.Millisecond, nil)
+	}
+	// calls to b never finish, its latency is not decreased by them
+	for i := 0; i < 10; i++ {
+		BeginCall(services[1])
+	}
+	current = current.Add(10 * DecayTime)
+	BeginCall(services[0])
+	EndCall(services[0], 10*time.Millisecond, nil)
+	for _, addr := range selectN(t, P2C, services, 10) {
+		if addr != "a" {
+			t.Errorf("P2C() = %v, want %v", addr, "a")
+		}
+	}
+}
+
+func TestP2C_NewNode(t *testing.T) {
+	resetStats()
+	services := newTestServices("P2C", "", "", "")
+	BeginCall(services[0])
+	EndCall(services[0], 10*time.Millisecond, nil)
+	BeginCall(services[1])
+	EndCall(services[1], time.Second, nil)
+
+	// c use the average latency, it is selected only when paired with b
+	counts := make(map[string]int)
+	for _, addr := range selectN(t, P2C, services, 3000) {
+		counts[addr]++
+	}
+	if counts["c"] == 0 || counts["a"] < 3*counts["c"]/2 {
+		t.Errorf("P2C() = %v, want new node c selected less than a", counts)
+	}
+}
+
+func TestP2C_Failure(t *testing.T) {
+	resetStats()
+	services := newTestServices("P2C", "", "")
+	// a fail fast, b succeed slowly
+	BeginCall(services[0])
+	EndCall(services[0], time.Millisecond, errors.New(errors.Unavailable, "connection refused"))
+	BeginCall(services[1])
+	EndCall(services[1], 100*time.Millisecond, nil)
+	for _, addr := range selectN(t, P2C, services, 10) {
+		if addr != "b" {
+			t.Errorf("P2C() = %v, want %v", addr, "b")
+		}
+	}
+}
+
+func TestP2C_Canceled(t *testing.T) {
+	resetStats()
+	services := newTestServices("P2C", "", "")
+	// a is slow, its calls canceled early do not make it look fast
+	BeginCall(services[0])
+	EndCall(services[0], 100*time.Millisecond, nil)
+	for i := 0; i < 10; i++ {
+		BeginCall(services[0])
+		EndCall(services[0], time.Millisecond, context.Canceled)
+	}
+	if got := Active(services[0]); got != 0 {
+		t.Errorf("Active() = %v, want %v", got, 0)
+	}
+	BeginCall(services[1])
+	EndCall(services[1], 10*time.Millisecond, nil)
+	for _, addr := range selectN(t, P2C, services, 10) {
+		if addr != "b" {
+			t.Errorf("P2C() = %v, want %v", addr, "b")
+		}
+	}
+}
+
+func TestRemoveStat(t *testing.T) {
+	defer func() {
+		now = time.Now
+	}()
+	current := time.Unix(1543311057, 0)
+	now = func() time.Time {
+		return current
+	}
+
+	resetStats()
+	services := newTestServices("RemoveStat", "", "", "")
+	for _, svc := range services {
+		BeginCall(svc)
+	}
+	EndCall(services[0], time.Millisecond, nil)
+	EndCall(services[1], time.Millisecond, nil)
+
+	// deleted from registry
+	RemoveStat(services[0])
+	if lookup(services[0]) != nil {
+		t.Error("stat is kept after RemoveStat")
+	}
+	// in-flight calls are kept
+	RemoveStat(services[2])
+	if Active(services[2]) != 1 {
+		t.Errorf("Active() = %v after RemoveStat, want %v", Active(services[2]), 1)
+	}
+
+	// idle stat is removed when new stat is created
+	current = current.Add(IdleTime)
+	BeginCall(newTestServices("RemoveStat2", "")[0])
+	if lookup(services[1]) != nil {
+		t.Error("idle stat is not removed")
+	}
+	if lookup(services[2]) == nil {
+		t.Error("stat with in-flight call is removed")
+	}
+	EndCall(services[2], time.Millisecond, nil)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/haormj/dodo/codec"
+	"github.com/haormj/dodo/compressor"
+	"github.com/haormj/dodo/invoker"
 	"github.com/haormj/dodo/transport"
 )
 
@@ -16,6 +18,12 @@ type Options struct {
 
 	Transport transport.Transport
 	Codecs    []codec.Codec
+	// Compressors used to compress body, body smaller than
+	// CompressThreshold will not be compressed
+	Compressors       []compressor.Compressor
+	CompressThreshold int
+	// Interceptors run before invoker of every request, e.g. rate limit
+	Interceptors []invoker.Interceptor
 
 	Context context.Context
 }
@@ -60,6 +68,26 @@ func Codec(c codec.Codec) Option {
 	}
 }
 
+func Compressor(c compressor.Compressor) Option {
+	return func(o *Options) {
+		o.Compressors = append(o.Compressors, c)
+	}
+}
+
+// Intercept add interceptors run before invoker of every request
+func Intercept(i ...invoker.Interceptor) Option {
+	return func(o *Options) {
+		o.Interceptors = append(o.Interceptors, i...)
+	}
+}
+
+// CompressThreshold sets the min body size to compress
+func CompressThreshold(n int) Option {
+	return func(o *Options) {
+		o.CompressThreshold = n
+	}
+}
+
 // Wait tells the server to wait for requests to finish before exiting
 func Wait(b bool) Option {
 	return func(o *Options) {
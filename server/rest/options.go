@@ -1,15 +1,23 @@
 package rest
 
 import (
+	"github.com/haormj/dodo/codec/json"
 	"github.com/haormj/dodo/server"
 )
 
 func newOptions(opts ...server.Option) server.Options {
-	options := server.Options{}
+	options := server.Options{
+		Address: ":17313",
+		Wait:    true,
+	}
 
 	for _, o := range opts {
 		o(&options)
 	}
 
+	if len(options.Codecs) == 0 {
+		options.Codecs = append(options.Codecs, json.NewCodec())
+	}
+
 	return options
 }
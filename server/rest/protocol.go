@@ -0,0 +1,103 @@
+package rest
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/haormj/dodo/errors"
+)
+
+const (
+	defaultContentType = "application/json"
+	metaPrefix         = "Meta-"
+	metadataHeader     = "Metadata"
+	timeoutHeader      = "Timeout"
+	errorCodeHeader    = "Error-Code"
+	errorDetailsHeader = "Error-Details"
+)
+
+// alias of content type which can not map to codec by name
+var contentTypes = map[string]string{
+	"application/protobuf":   "proto",
+	"application/x-protobuf": "proto",
+}
+
+// http status of error code, default is 500
+var httpStatuses = map[errors.ErrorCode]int{
+	errors.ServiceNotFound:    http.StatusNotFound,
+	errors.FuncNotFound:       http.StatusNotFound,
+	errors.CodecNotFound:      http.StatusUnsupportedMediaType,
+	errors.CompressorNotFound: http.StatusUnsupportedMediaType,
+	errors.DecodeError:        http.StatusBadRequest,
+	errors.Unavailable:        http.StatusServiceUnavailable,
+	errors.DeadlineExceeded:   http.StatusGatewayTimeout,
+	errors.Unimplemented:      http.StatusNotImplemented,
+	errors.ResourceExhausted:  http.StatusTooManyRequests,
+	errors.Overloaded:         http.StatusServiceUnavailable,
+}
+
+func httpStatus(code errors.ErrorCode) int {
+	if s, ok := httpStatuses[code]; ok {
+		return s
+	}
+	return http.StatusInternalServerError
+}
+
+// codecName get codec name from content type,
+// application/json => json, application/x-msgpack => msgpack
+func codecName(contentType string) string {
+	if len(contentType) == 0 {
+		contentType = defaultContentType
+	}
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	if c, ok := contentTypes[t]; ok {
+		return c
+	}
+	splits := strings.Split(t, "/")
+	if len(splits) != 2 {
+		return ""
+	}
+	return strings.TrimPrefix(splits[1], "x-")
+}
+
+// contentType get content type from codec name
+func contentType(codecName string) string {
+	return "application/" + codecName
+}
+
+// parseMetadata get metadata from url encoded Metadata header, which
+// keep keys as they are, and headers with Meta- prefix, whose keys
+// are canonicalized, e.g. Meta-NodeID is Nodeid
+func parseMetadata(h http.Header) map[string]string {
+	md := make(map[string]string)
+	for k, v := range h {
+		if !strings.HasPrefix(k, metaPrefix) || len(v) == 0 {
+			continue
+		}
+		md[strings.TrimPrefix(k, metaPrefix)] = v[0]
+	}
+	values, _ := url.ParseQuery(h.Get(metadataHeader))
+	for k, v := range values {
+		md[k] = v[0]
+	}
+	return md
+}
+
+// parseTimeout get remaining time of caller from Timeout header
+func parseTimeout(h http.Header) (time.Duration, bool) {
+	v := h.Get(timeoutHeader)
+	if len(v) == 0 {
+		return 0, false
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, false
+	}
+	return d, true
+}
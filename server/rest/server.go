@@ -2,37 +2,199 @@
 package rest
 
 import (
-	"errors"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"sync"
 
+	"github.com/haormj/dodo/codec"
+	"github.com/haormj/dodo/errors"
 	"github.com/haormj/dodo/invoker"
 	"github.com/haormj/dodo/log"
+	"github.com/haormj/dodo/metadata"
 	"github.com/haormj/dodo/server"
+	"github.com/haormj/dodo/util"
 )
 
+// Server implement by http, every function of registered invoker
+// is served as POST /{ServiceName}/{FuncName}. Request body is decoded
+// by the codec chosen from Content-Type, header with Meta- prefix is
+// treated as metadata and Timeout header limits the request context.
+// Start and Stop follow the same rule as rpc server.
 type Server struct {
 	sync.RWMutex
+	exit     chan chan error
 	opts     server.Options
 	invokers map[string]invoker.Invoker
+	codecs   map[string]codec.Codec
+
+	started bool
+	stopped bool
+	// call Start +1, call Stop -1
+	counter uint32
 }
 
+// NewServer implement by http
 func NewServer(opts ...server.Option) server.Server {
 	options := newOptions(opts...)
 
 	s := &Server{
 		opts:     options,
 		invokers: make(map[string]invoker.Invoker),
+		codecs:   make(map[string]codec.Codec),
+		exit:     make(chan chan error),
 	}
 
 	return s
 }
 
+// writeError write error with Error, Error-Code and Error-Details headers,
+// http status is decided by the code of error
+func (s *Server) writeError(w http.ResponseWriter, e *errors.Error) {
+	s.writeErrorStatus(w, httpStatus(e.Code), e)
+}
+
+func (s *Server) writeErrorStatus(w http.ResponseWriter, status int, e *errors.Error) {
+	w.Header().Set("Error", e.Message)
+	w.Header().Set(errorCodeHeader, strconv.Itoa(int(e.Code)))
+	// details are url encoded in one header to keep the case of keys
+	if len(e.Details) > 0 {
+		values := make(url.Values, len(e.Details))
+		for k, v := range e.Details {
+			values.Set(k, v)
+		}
+		w.Header().Set(errorDetailsHeader, values.Encode())
+	}
+	http.Error(w, e.Message, status)
+}
+
+// ServeHTTP handle POST /{ServiceName}/{FuncName}
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error(r, string(debug.Stack()))
+			s.writeError(w, errors.New(errors.Internal, "Internal Server Error"))
+		}
+	}()
+
+	if r.Method != http.MethodPost {
+		s.writeErrorStatus(w, http.StatusMethodNotAllowed,
+			errors.New(errors.Unknown, "method not allowed "+r.Method))
+		return
+	}
+
+	splits := strings.Split(util.TrimSpaceAndSlash(r.URL.Path), "/")
+	if len(splits) != 2 {
+		s.writeError(w, errors.New(errors.ServiceNotFound, "invalid path "+r.URL.Path))
+		return
+	}
+	serviceName, funcName := splits[0], splits[1]
+
+	s.RLock()
+	inv, ok := s.invokers[serviceName]
+	s.RUnlock()
+	if !ok {
+		s.writeError(w, errors.New(errors.ServiceNotFound, "not find service "+serviceName))
+		return
+	}
+	f, err := inv.Function(funcName)
+	if err != nil {
+		s.writeError(w, errors.New(errors.FuncNotFound, err.Error()))
+		return
+	}
+	if invoker.IsStream(f) {
+		s.writeError(w, errors.New(errors.Unimplemented, funcName+" is streaming function"))
+		return
+	}
+
+	cdcName := codecName(r.Header.Get("Content-Type"))
+	c, ok := s.codecs[cdcName]
+	if !ok {
+		s.writeError(w, errors.New(errors.CodecNotFound, "not find codec "+cdcName))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s.writeError(w, errors.New(errors.DecodeError, err.Error()))
+		return
+	}
+
+	in := f.In()
+	reqVal := util.InitPointer(in[1])
+	rspVal := util.InitPointer(in[2])
+
+	// decode
+	if err := c.Unmarshal(body, reqVal.Addr().Interface()); err != nil {
+		s.writeError(w, errors.New(errors.DecodeError, err.Error()))
+		return
+	}
+
+	ctx := metadata.NewContext(r.Context(), parseMetadata(r.Header))
+	if d, ok := parseTimeout(r.Header); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	mi := invoker.NewMessage()
+	mi.SetFuncName(funcName)
+	mi.SetParameters([]interface{}{ctx, reqVal.Interface(), rspVal.Interface()})
+	mi.SetAttachment(invoker.ServiceNameAttachment, inv.Name())
+	mo, err := inv.Invoke(ctx, mi, invoker.WithInterceptor(s.opts.Interceptors...))
+	if err != nil {
+		s.writeError(w, errors.FromError(err, errors.Internal))
+		return
+	}
+	// invoker exceed the remaining time of caller
+	if ctx.Err() == context.DeadlineExceeded {
+		s.writeError(w, errors.FromError(ctx.Err(), errors.Internal))
+		return
+	}
+	if mo.Parameters()[0] != nil {
+		s.writeError(w, errors.FromError(mo.Parameters()[0].(error), errors.HandlerError))
+		return
+	}
+
+	// encode
+	rspBytes, err := c.Marshal(rspVal.Interface())
+	if err != nil {
+		s.writeError(w, errors.New(errors.EncodeError, err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", contentType(cdcName))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(rspBytes); err != nil {
+		log.Error(err)
+	}
+}
+
 func (s *Server) Init(opts ...server.Option) error {
 	s.Lock()
+	defer s.Unlock()
 	for _, o := range opts {
 		o(&s.opts)
 	}
-	s.Unlock()
+
+	// auto get ip address and port, if address is empty
+	host, port, err := net.SplitHostPort(s.opts.Address)
+	if err == nil {
+		addr, err := util.Address(host)
+		if err == nil {
+			host = addr
+		}
+	}
+	s.opts.Address = net.JoinHostPort(host, port)
+
+	for _, c := range s.opts.Codecs {
+		s.codecs[c.String()] = c
+	}
 
 	return nil
 }
@@ -44,22 +206,101 @@ func (s *Server) Options() server.Options {
 	return opts
 }
 
+// Register invoker to server
 func (s *Server) Register(inv invoker.Invoker) error {
+	s.Lock()
+	defer s.Unlock()
 	if _, ok := s.invokers[inv.Name()]; ok {
 		s := "duplicate service name " + inv.Name()
 		log.Error(s)
-		return errors.New(s)
+		return fmt.Errorf(s)
 	}
 	s.invokers[inv.Name()] = inv
 	return nil
 }
 
+// Start server when counter == 1 and started == false
 func (s *Server) Start() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.counter = s.counter + 1; s.counter > 1 {
+		return nil
+	}
+	if s.started {
+		return nil
+	}
+	s.started = true
+
+	var ln net.Listener
+	var err error
+	if s.opts.TLSEnable {
+		var config *tls.Config
+		// use not give key and cert, will generate
+		if len(s.opts.TLSKeyFile) == 0 || len(s.opts.TLSCertFile) == 0 {
+			config, err = util.GetTLSConfigByAddr(s.opts.Address)
+		} else {
+			config, err = util.GetTLSConfig(s.opts.TLSKeyFile, s.opts.TLSCertFile)
+		}
+		if err != nil {
+			return err
+		}
+		ln, err = util.Listen(s.opts.Address, func(addr string) (net.Listener, error) {
+			return tls.Listen("tcp", addr, config)
+		})
+	} else {
+		ln, err = util.Listen(s.opts.Address, func(addr string) (net.Listener, error) {
+			return net.Listen("tcp", addr)
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Listening on %s", ln.Addr())
+	hs := &http.Server{Handler: s}
+	go func() {
+		if err := hs.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Error(err)
+		}
+	}()
+
+	go func() {
+		// wait for exit
+		ch := <-s.exit
+
+		// wait for requests to finish
+		if s.opts.Wait {
+			ch <- hs.Shutdown(context.Background())
+			return
+		}
+
+		ch <- hs.Close()
+	}()
+
 	return nil
 }
 
+// Stop server when started == true, counter == 0 and stopped == false
 func (s *Server) Stop() error {
-	return nil
+	s.Lock()
+	defer s.Unlock()
+	if !s.started {
+		return nil
+	}
+	if s.counter > 0 {
+		s.counter = s.counter - 1
+	}
+	if s.counter > 0 {
+		return nil
+	}
+	if s.stopped {
+		return nil
+	}
+	s.stopped = true
+
+	ch := make(chan error)
+	s.exit <- ch
+	return <-ch
 }
 
 func (s *Server) String() string {
@@ -0,0 +1,132 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/haormj/dodo/invoker/receiver"
+	"github.com/haormj/dodo/metadata"
+)
+
+type Hello struct{}
+
+func (*Hello) SayHello(ctx context.Context, req string, rsp *string) error {
+	md, _ := metadata.FromContext(ctx)
+	*rsp = req + " dodo" + md["NodeID"]
+	return nil
+}
+
+func (*Hello) SayError(ctx context.Context, req string, rsp *string) error {
+	return errors.New("say error")
+}
+
+func TestServer_ServeHTTP(t *testing.T) {
+	inv := receiver.NewInvoker(new(Hello))
+	if err := inv.Init(); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer().(*Server)
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register(inv); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		code        int
+		want        string
+	}{
+		{
+			name:        "SayHello",
+			method:      http.MethodPost,
+			path:        "/Hello/SayHello",
+			contentType: "application/json; charset=utf-8",
+			body:        `"hello"`,
+			code:        http.StatusOK,
+			want:        `"hello dodo1"`,
+		},
+		{
+			name:   "MethodNotAllowed",
+			method: http.MethodGet,
+			path:   "/Hello/SayHello",
+			code:   http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "ServiceNotFound",
+			method: http.MethodPost,
+			path:   "/World/SayHello",
+			body:   `"hello"`,
+			code:   http.StatusNotFound,
+		},
+		{
+			name:   "FuncNotFound",
+			method: http.MethodPost,
+			path:   "/Hello/SayWorld",
+			body:   `"hello"`,
+			code:   http.StatusNotFound,
+		},
+		{
+			name:        "CodecNotFound",
+			method:      http.MethodPost,
+			path:        "/Hello/SayHello",
+			contentType: "application/gob",
+			body:        `"hello"`,
+			code:        http.StatusUnsupportedMediaType,
+		},
+		{
+			name:   "DecodeError",
+			method: http.MethodPost,
+			path:   "/Hello/SayHello",
+			body:   `hello`,
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:   "HandlerError",
+			method: http.MethodPost,
+			path:   "/Hello/SayError",
+			body:   `"hello"`,
+			code:   http.StatusInternalServerError,
+			want:   "say error\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Metadata", "NodeID=1")
+			if len(tt.contentType) != 0 {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+			if w.Code != tt.code {
+				t.Errorf("ServeHTTP() code = %v, want %v", w.Code, tt.code)
+			}
+			if len(tt.want) != 0 && w.Body.String() != tt.want {
+				t.Errorf("ServeHTTP() body = %v, want %v", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	h := make(http.Header)
+	h.Set("Meta-Zone", "a")
+	h.Set("Meta-NodeID", "2")
+	h.Set("Metadata", "NodeID=1&traceId=x%26y")
+	md := parseMetadata(h)
+	want := map[string]string{"Zone": "a", "Nodeid": "2", "NodeID": "1", "traceId": "x&y"}
+	if !reflect.DeepEqual(md, want) {
+		t.Errorf("parseMetadata() = %v, want %v", md, want)
+	}
+}
@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"github.com/haormj/dodo/codec/json"
+	"github.com/haormj/dodo/compressor"
 	"github.com/haormj/dodo/server"
 	"github.com/haormj/dodo/transport/grpc"
 )
@@ -11,6 +12,8 @@ func newOptions(opt ...server.Option) server.Options {
 		Address:   ":17312",
 		Transport: grpc.NewTransport(),
 		Wait:      true,
+
+		CompressThreshold: compressor.DefaultThreshold,
 	}
 
 	for _, o := range opt {
@@ -3,12 +3,16 @@ package rpc
 import (
 	"context"
 	"crypto/tls"
-	"errors"
+	"fmt"
+	"io"
 	"net"
 	"runtime/debug"
 	"sync"
 
 	"github.com/haormj/dodo/codec"
+	"github.com/haormj/dodo/compressor"
+	"github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/internal/queue"
 	"github.com/haormj/dodo/invoker"
 	"github.com/haormj/dodo/log"
 	"github.com/haormj/dodo/metadata"
@@ -27,10 +31,11 @@ import (
 // overflow and cause the server to stop prematurely.
 type Server struct {
 	sync.RWMutex
-	exit     chan chan error
-	opts     server.Options
-	invokers map[string]invoker.Invoker
-	codecs   map[string]codec.Codec
+	exit        chan chan error
+	opts        server.Options
+	invokers    map[string]invoker.Invoker
+	codecs      map[string]codec.Codec
+	compressors map[string]compressor.Compressor
 
 	// graceful exit
 	wg sync.WaitGroup
@@ -45,16 +50,44 @@ type Server struct {
 func NewServer(opts ...server.Option) server.Server {
 	options := newOptions(opts...)
 	return &Server{
-		opts:     options,
-		invokers: make(map[string]invoker.Invoker),
-		codecs:   make(map[string]codec.Codec),
-		exit:     make(chan chan error),
+		opts:        options,
+		invokers:    make(map[string]invoker.Invoker),
+		codecs:      make(map[string]codec.Codec),
+		compressors: make(map[string]compressor.Compressor),
+		exit:        make(chan chan error),
 	}
 }
 
+// accept receive messages from socket, every message is served in its own
+// goroutine, so requests multiplexed on one socket will not block each other.
+// Response has the same ID as request, client use it to find the caller.
+// Message with Cancel header cancel the in-flight request with the same ID.
+// The first message of stream open it, the others with the same ID are
+// put into the queue of stream in order.
 func (s *Server) accept(sock transport.Socket) {
+	// in-flight requests of this socket
+	var wg sync.WaitGroup
+	// guard Send, socket is not safe for concurrent Send
+	var sendMu sync.Mutex
+	send := func(m *transport.Message) error {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		return sock.Send(m)
+	}
+	// cancel func of in-flight requests, and queue of streams
+	var mu sync.Mutex
+	cancels := make(map[string]context.CancelFunc)
+	streams := make(map[string]*queue.Queue)
+
 	defer func() {
-		// close socket
+		// streams can not receive message any more
+		mu.Lock()
+		for id := range streams {
+			cancels[id]()
+		}
+		mu.Unlock()
+		// wait for in-flight requests, then close socket
+		wg.Wait()
 		sock.Close()
 
 		if r := recover(); r != nil {
@@ -69,82 +102,276 @@ func (s *Server) accept(sock transport.Socket) {
 			return
 		}
 
+		pi := parse(mi)
+		if pi.header.Cancel {
+			mu.Lock()
+			cancel, ok := cancels[pi.header.ID]
+			mu.Unlock()
+			if ok {
+				cancel()
+			}
+			continue
+		}
+		if pi.header.Stream {
+			mu.Lock()
+			q, ok := streams[pi.header.ID]
+			cancel := cancels[pi.header.ID]
+			mu.Unlock()
+			// stream is canceled if handler is too slow to
+			// receive, other requests are not blocked
+			if ok {
+				if q.Push(mi) == queue.ErrFull {
+					cancel()
+				}
+				continue
+			}
+			// late message of finished stream
+			if len(pi.header.ServiceName) == 0 {
+				continue
+			}
+		}
+
+		// request context is limited by the remaining time of caller
+		var ctx context.Context
+		var cancel context.CancelFunc
+		if pi.header.Timeout > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), pi.header.Timeout)
+		} else {
+			ctx, cancel = context.WithCancel(context.Background())
+		}
+		var q *queue.Queue
+		mu.Lock()
+		cancels[pi.header.ID] = cancel
+		if pi.header.Stream {
+			q = queue.New(queue.DefaultSize)
+			streams[pi.header.ID] = q
+			// messages are not received after stream is done
+			go func() {
+				<-ctx.Done()
+				q.Close()
+			}()
+		}
+		mu.Unlock()
+
 		// add to wait group
 		s.wg.Add(1)
-		pi := parse(mi)
-		var fn = func(pi protocol) (po protocol) {
+		wg.Add(1)
+		go func(ctx context.Context, cancel context.CancelFunc, pi protocol) {
 			defer func() {
-				if r := recover(); r != nil {
-					log.Error(r, string(debug.Stack()))
-					po.header.Error = "Internal Server Error"
-				}
+				mu.Lock()
+				delete(cancels, pi.header.ID)
+				delete(streams, pi.header.ID)
+				mu.Unlock()
+				cancel()
+				wg.Done()
+				s.wg.Done()
 			}()
-			po = protocol{
-				header: header{
-					ServiceName: pi.header.ServiceName,
-					FuncName:    pi.header.FuncName,
-					Codec:       pi.header.Codec,
-				},
-			}
-			ctx := metadata.NewContext(context.Background(), pi.header.Metadata)
-			inv, ok := s.invokers[pi.header.ServiceName]
-			if !ok {
-				s := "not find service " + pi.header.ServiceName
-				po.header.Error = s
-				return po
+
+			var po protocol
+			if pi.header.Stream {
+				po = s.serveStream(ctx, pi, q, send)
+			} else {
+				po = s.serve(ctx, pi)
 			}
-			f, err := inv.Function(pi.header.FuncName)
-			if err != nil {
-				po.header.Error = err.Error()
-				return po
+			mo := format(po)
+			if err := send(&mo); err != nil {
+				log.Error(err)
 			}
+		}(ctx, cancel, pi)
+	}
+}
 
-			c, ok := s.codecs[pi.header.Codec]
-			if !ok {
-				s := "not find codec " + pi.header.Codec
-				po.header.Error = s
-				return po
-			}
+// serve one request, error is returned by Error header
+func (s *Server) serve(ctx context.Context, pi protocol) (po protocol) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error(r, string(debug.Stack()))
+			po.header.Error = errors.New(errors.Internal, "Internal Server Error")
+		}
+	}()
+	po = protocol{
+		header: header{
+			ID:          pi.header.ID,
+			ServiceName: pi.header.ServiceName,
+			FuncName:    pi.header.FuncName,
+			Codec:       pi.header.Codec,
+		},
+	}
+	ctx = metadata.NewContext(ctx, pi.header.Metadata)
+	inv, f, c, e := s.lookup(pi)
+	if e != nil {
+		po.header.Error = e
+		return po
+	}
+	if invoker.IsStream(f) {
+		po.header.Error = errors.New(errors.Unimplemented, pi.header.FuncName+" is streaming function")
+		return po
+	}
 
-			in := f.In()
-			reqVal := util.InitPointer(in[1])
-			rspVal := util.InitPointer(in[2])
+	// decompress
+	if len(pi.header.Compress) != 0 {
+		cps, ok := s.compressors[pi.header.Compress]
+		if !ok {
+			po.header.Error = errors.New(errors.CompressorNotFound, "not find compressor "+pi.header.Compress)
+			return po
+		}
+		b, err := cps.Decompress(pi.Body)
+		if err != nil {
+			po.header.Error = errors.New(errors.DecodeError, err.Error())
+			return po
+		}
+		pi.Body = b
+	}
 
-			// decode
-			if err := c.Unmarshal(mi.Body, reqVal.Addr().Interface()); err != nil {
-				po.header.Error = err.Error()
-				return po
-			}
+	in := f.In()
+	reqVal := util.InitPointer(in[1])
+	rspVal := util.InitPointer(in[2])
 
-			mi := invoker.NewMessage()
-			mi.SetFuncName(pi.header.FuncName)
-			mi.SetParameters([]interface{}{ctx, reqVal.Interface(), rspVal.Interface()})
-			mo, err := inv.Invoke(ctx, mi)
-			if err != nil {
-				po.header.Error = err.Error()
-				return po
-			}
+	// decode
+	if err := c.Unmarshal(pi.Body, reqVal.Addr().Interface()); err != nil {
+		po.header.Error = errors.New(errors.DecodeError, err.Error())
+		return po
+	}
 
-			if mo.Parameters()[0] != nil {
-				po.header.Error = mo.Parameters()[0].(error).Error()
-			}
-			// encode
-			rspBytes, err := c.Marshal(rspVal.Interface())
-			if err != nil {
-				po.header.Error = err.Error()
-				return po
-			}
-			po.Body = rspBytes
+	// caller has given up, no need to invoke
+	if err := ctx.Err(); err != nil {
+		po.header.Error = errors.FromError(err, errors.Internal)
+		return po
+	}
+
+	mi := invoker.NewMessage()
+	mi.SetFuncName(pi.header.FuncName)
+	mi.SetParameters([]interface{}{ctx, reqVal.Interface(), rspVal.Interface()})
+	mi.SetAttachment(invoker.ServiceNameAttachment, inv.Name())
+	mo, err := inv.Invoke(ctx, mi, invoker.WithInterceptor(s.opts.Interceptors...))
+	if err != nil {
+		po.header.Error = errors.FromError(err, errors.Internal)
+		return po
+	}
+
+	// error returned by handler keep its code if it is *errors.Error
+	if mo.Parameters()[0] != nil {
+		po.header.Error = errors.FromError(mo.Parameters()[0].(error), errors.HandlerError)
+	}
+	// invoker exceed the remaining time of caller
+	if ctx.Err() == context.DeadlineExceeded {
+		po.header.Error = errors.FromError(ctx.Err(), errors.Internal)
+		return po
+	}
+	// encode
+	rspBytes, err := c.Marshal(rspVal.Interface())
+	if err != nil {
+		po.header.Error = errors.New(errors.EncodeError, err.Error())
+		return po
+	}
+	// compress by the compressor accepted by client
+	cps, ok := s.compressors[pi.header.AcceptCompress]
+	if ok && len(rspBytes) >= s.opts.CompressThreshold {
+		b, err := cps.Compress(rspBytes)
+		if err != nil {
+			po.header.Error = errors.New(errors.EncodeError, err.Error())
 			return po
 		}
-		mo := format(fn(pi))
-		if err := sock.Send(&mo); err != nil {
-			log.Error(err)
-			return
+		rspBytes = b
+		po.header.Compress = pi.header.AcceptCompress
+	}
+	po.Body = rspBytes
+	return po
+}
+
+// lookup find invoker, function and codec of request
+func (s *Server) lookup(pi protocol) (invoker.Invoker, invoker.Function, codec.Codec, *errors.Error) {
+	s.RLock()
+	inv, ok := s.invokers[pi.header.ServiceName]
+	s.RUnlock()
+	if !ok {
+		return nil, nil, nil, errors.New(errors.ServiceNotFound, "not find service "+pi.header.ServiceName)
+	}
+	f, err := inv.Function(pi.header.FuncName)
+	if err != nil {
+		return nil, nil, nil, errors.New(errors.FuncNotFound, err.Error())
+	}
+	c, ok := s.codecs[pi.header.Codec]
+	if !ok {
+		return nil, nil, nil, errors.New(errors.CodecNotFound, "not find codec "+pi.header.Codec)
+	}
+	return inv, f, c, nil
+}
+
+// serveStream serve one stream until handler returned, messages of
+// client are received from q, the returned message end the stream
+// and carry the error of handler
+func (s *Server) serveStream(ctx context.Context, pi protocol, q *queue.Queue,
+	send func(*transport.Message) error) (po protocol) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error(r, string(debug.Stack()))
+			po.header.Error = errors.New(errors.Internal, "Internal Server Error")
+		}
+	}()
+	po = protocol{
+		header: header{
+			ID:        pi.header.ID,
+			Stream:    true,
+			EndStream: true,
+		},
+	}
+	ctx = metadata.NewContext(ctx, pi.header.Metadata)
+	inv, f, c, e := s.lookup(pi)
+	if e != nil {
+		po.header.Error = e
+		return po
+	}
+	if !invoker.IsStream(f) {
+		po.header.Error = errors.New(errors.Unimplemented, pi.header.FuncName+" is not streaming function")
+		return po
+	}
+
+	st := &stream{
+		ctx:         ctx,
+		id:          pi.header.ID,
+		q:           q,
+		send:        send,
+		codec:       c,
+		compressor:  s.compressors[pi.header.AcceptCompress],
+		compressors: s.compressors,
+		threshold:   s.opts.CompressThreshold,
+	}
+	// server streaming function receive the first message as request
+	params := []interface{}{ctx, st}
+	if in := f.In(); len(in) == 3 {
+		reqVal := util.InitPointer(in[1])
+		if err := st.Recv(reqVal.Addr().Interface()); err != nil {
+			if err == io.EOF {
+				err = errors.New(errors.DecodeError, "missing request of "+pi.header.FuncName)
+			}
+			po.header.Error = errors.FromError(err, errors.DecodeError)
+			return po
 		}
+		params = []interface{}{ctx, reqVal.Interface(), st}
+	}
 
-		s.wg.Done()
+	mi := invoker.NewMessage()
+	mi.SetFuncName(pi.header.FuncName)
+	mi.SetParameters(params)
+	mi.SetAttachment(invoker.ServiceNameAttachment, inv.Name())
+	mo, err := inv.Invoke(ctx, mi, invoker.WithInterceptor(s.opts.Interceptors...))
+	if err != nil {
+		po.header.Error = errors.FromError(err, errors.Internal)
+		return po
 	}
+	if mo.Parameters()[0] != nil {
+		po.header.Error = errors.FromError(mo.Parameters()[0].(error), errors.HandlerError)
+	}
+	// invoker exceed the remaining time of caller
+	if ctx.Err() == context.DeadlineExceeded {
+		po.header.Error = errors.FromError(ctx.Err(), errors.Internal)
+	}
+	// stream is canceled as client sent too many messages
+	if q.Err() == queue.ErrFull {
+		po.header.Error = queue.ErrFull
+	}
+	return po
 }
 
 func (s *Server) Init(opts ...server.Option) error {
@@ -168,6 +395,10 @@ func (s *Server) Init(opts ...server.Option) error {
 		s.codecs[c.String()] = c
 	}
 
+	for _, c := range s.opts.Compressors {
+		s.compressors[c.String()] = c
+	}
+
 	if err := s.opts.Transport.Init(); err != nil {
 		return err
 	}
@@ -186,8 +417,7 @@ func (s *Server) Register(inv invoker.Invoker) error {
 	s.Lock()
 	defer s.Unlock()
 	if _, ok := s.invokers[inv.Name()]; ok {
-		s := "duplicate service name " + inv.Name()
-		return errors.New(s)
+		return fmt.Errorf("duplicate service name %s", inv.Name())
 	}
 	s.invokers[inv.Name()] = inv
 	return nil
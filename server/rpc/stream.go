@@ -0,0 +1,94 @@
+package rpc
+
+import (
+	"context"
+	"io"
+
+	"github.com/haormj/dodo/codec"
+	"github.com/haormj/dodo/compressor"
+	"github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/internal/queue"
+	"github.com/haormj/dodo/transport"
+)
+
+// stream implement invoker.Stream, messages of client are put into
+// q by accept, every message of handler is sent with the ID of stream
+type stream struct {
+	ctx  context.Context
+	id   string
+	q    *queue.Queue
+	send func(*transport.Message) error
+
+	codec codec.Codec
+	// compressor accepted by client, nil means not compress
+	compressor  compressor.Compressor
+	compressors map[string]compressor.Compressor
+	threshold   int
+
+	// client has closed send
+	eos bool
+}
+
+func (s *stream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *stream) Send(v interface{}) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	b, err := s.codec.Marshal(v)
+	if err != nil {
+		return errors.New(errors.EncodeError, err.Error())
+	}
+	p := protocol{
+		header: header{
+			ID:     s.id,
+			Codec:  s.codec.String(),
+			Stream: true,
+		},
+		Body: b,
+	}
+	if s.compressor != nil && len(b) >= s.threshold {
+		cb, err := s.compressor.Compress(b)
+		if err != nil {
+			return errors.New(errors.EncodeError, err.Error())
+		}
+		p.Body = cb
+		p.header.Compress = s.compressor.String()
+	}
+	m := format(p)
+	return s.send(&m)
+}
+
+// Recv is not safe for concurrent use, it return io.EOF
+// when client has closed send
+func (s *stream) Recv(v interface{}) error {
+	if s.eos {
+		return io.EOF
+	}
+	m, err := s.q.Pop(s.ctx, nil)
+	if err != nil {
+		return err
+	}
+	p := parse(m)
+	if p.header.EndStream {
+		s.eos = true
+		return io.EOF
+	}
+	if len(p.header.Compress) != 0 {
+		cps, ok := s.compressors[p.header.Compress]
+		if !ok {
+			return errors.New(errors.CompressorNotFound, "not find compressor "+p.header.Compress)
+		}
+		b, err := cps.Decompress(p.Body)
+		if err != nil {
+			return errors.New(errors.DecodeError, err.Error())
+		}
+		p.Body = b
+	}
+	if err := s.codec.Unmarshal(p.Body, v); err != nil {
+		return errors.New(errors.DecodeError, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/haormj/dodo/errors"
+	"github.com/haormj/dodo/internal/queue"
+	"github.com/haormj/dodo/invoker"
+	"github.com/haormj/dodo/invoker/receiver"
+	"github.com/haormj/dodo/log"
+	"github.com/haormj/dodo/server"
+	"github.com/haormj/dodo/transport"
+	"github.com/haormj/dodo/transport/tcp"
+)
+
+type Hello struct {
+	// release let SayWait start to receive
+	release chan struct{}
+}
+
+func (*Hello) SayHello(ctx context.Context, req string, rsp *string) error {
+	*rsp = req + " dodo"
+	return nil
+}
+
+// SayStream send n messages to client
+func (*Hello) SayStream(ctx context.Context, n int, stream invoker.Stream) error {
+	for i := 0; i < n; i++ {
+		if err := stream.Send(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SayWait send back every message of client after released
+func (h *Hello) SayWait(ctx context.Context, stream invoker.Stream) error {
+	<-h.release
+	for {
+		var req string
+		if err := stream.Recv(&req); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := stream.Send(req); err != nil {
+			return err
+		}
+	}
+}
+
+// SayNothing return without receiving messages of client
+func (*Hello) SayNothing(ctx context.Context, stream invoker.Stream) error {
+	return nil
+}
+
+func newTestServer(t *testing.T, address string, h *Hello) server.Server {
+	log.SetDummyLogger()
+	inv := receiver.NewInvoker(h)
+	if err := inv.Init(); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(server.Transport(tcp.NewTransport()), server.Address(address))
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register(inv); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func dial(t *testing.T, address string) transport.Client {
+	c, err := tcp.NewTransport().Dial(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// send message of stream id, v is encoded as body if it is not nil
+func send(t *testing.T, c transport.Client, p protocol, v interface{}) {
+	t.Helper()
+	p.header.Codec = "json"
+	if v != nil {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Body = b
+	}
+	m := format(p)
+	if err := c.Send(&m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// recv message, body is decoded to v if it is not nil
+func recv(t *testing.T, c transport.Client, v interface{}) protocol {
+	t.Helper()
+	var m transport.Message
+	if err := c.Recv(&m); err != nil {
+		t.Fatal(err)
+	}
+	p := parse(m)
+	if v != nil && !p.header.EndStream && len(p.Body) != 0 {
+		if err := json.Unmarshal(p.Body, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p
+}
+
+func open(id string, funcName string) protocol {
+	return protocol{header: header{ID: id, ServiceName: "Hello", FuncName: funcName, Stream: true}}
+}
+
+func message(id string) protocol {
+	return protocol{header: header{ID: id, Stream: true}}
+}
+
+func end(id string) protocol {
+	return protocol{header: header{ID: id, Stream: true, EndStream: true}}
+}
+
+func TestServer_Stream(t *testing.T) {
+	address := "127.0.0.1:27330"
+	s := newTestServer(t, address, &Hello{})
+	defer s.Stop()
+	c := dial(t, address)
+	defer c.Close()
+
+	// the first message after open is request of server streaming
+	send(t, c, open("1", "SayStream"), nil)
+	send(t, c, message("1"), 3)
+	var got []int
+	for {
+		var n int
+		p := recv(t, c, &n)
+		if p.header.ID != "1" || !p.header.Stream {
+			t.Fatalf("recv() header = %+v, want stream 1", p.header)
+		}
+		if p.header.EndStream {
+			if p.header.Error != nil {
+				t.Errorf("recv() err = %v, want %v", p.header.Error, nil)
+			}
+			break
+		}
+		got = append(got, n)
+	}
+	if want := []int{0, 1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("recv() = %v, want %v", got, want)
+	}
+
+	// unary function can not be streamed
+	send(t, c, open("2", "SayHello"), nil)
+	if p := recv(t, c, nil); !p.header.EndStream || p.header.Error == nil {
+		t.Errorf("recv() header = %+v, want error", p.header)
+	}
+}
+
+func TestServer_StreamQueue(t *testing.T) {
+	address := "127.0.0.1:27331"
+	h := &Hello{release: make(chan struct{})}
+	s := newTestServer(t, address, h)
+	defer s.Stop()
+	c := dial(t, address)
+	defer c.Close()
+
+	// stream is canceled when client send more messages than size
+	// of queue, other requests on the socket are not blocked
+	send(t, c, open("1", "SayWait"), nil)
+	for i := 0; i < queue.DefaultSize*2; i++ {
+		send(t, c, message("1"), "a")
+	}
+	send(t, c, protocol{header: header{ID: "2", ServiceName: "Hello", FuncName: "SayHello"}}, "hello")
+	var rsp string
+	if p := recv(t, c, &rsp); p.header.ID != "2" || rsp != "hello dodo" {
+		t.Errorf("recv() = %v %v, want %v %v", p.header.ID, rsp, "2", "hello dodo")
+	}
+	close(h.release)
+	for {
+		p := recv(t, c, nil)
+		if p.header.EndStream {
+			if !errors.Is(p.header.Error, errors.ResourceExhausted) {
+				t.Errorf("recv() err = %v, want %v", p.header.Error, errors.ResourceExhausted)
+			}
+			break
+		}
+	}
+
+	// messages of stream finished without receiving are dropped,
+	// other requests on the socket are still served
+	send(t, c, open("3", "SayNothing"), nil)
+	for i := 0; i < 5; i++ {
+		send(t, c, message("3"), "x")
+	}
+	send(t, c, protocol{header: header{ID: "4", ServiceName: "Hello", FuncName: "SayHello"}}, "hello")
+	for {
+		var rsp string
+		p := recv(t, c, &rsp)
+		if p.header.ID == "4" {
+			if rsp != "hello dodo" {
+				t.Errorf("recv() = %v, want %v", rsp, "hello dodo")
+			}
+			break
+		}
+	}
+}